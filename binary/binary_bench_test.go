@@ -46,6 +46,15 @@ func BenchmarkBinaryEncoding(b *testing.B) {
 		}
 	})
 
+	b.Run("binary.AppendEvent", func(b *testing.B) {
+		var buf []byte
+		for i := 0; i < b.N; i++ {
+			for _, evt := range events {
+				buf, _ = AppendEvent(buf[:0], evt)
+			}
+		}
+	})
+
 	b.Run("binary.MarshalBinary", func(b *testing.B) {
 		for i := 0; i < b.N; i++ {
 			for _, bevt := range binaryEvents {
@@ -57,12 +66,14 @@ func BenchmarkBinaryEncoding(b *testing.B) {
 
 func BenchmarkBinaryDecoding(b *testing.B) {
 	events := make([][]byte, len(normalEvents))
+	v2events := make([][]byte, len(normalEvents))
 	gevents := make([][]byte, len(normalEvents))
 	for i, jevt := range normalEvents {
 		evt := &nostr.Event{}
 		json.Unmarshal([]byte(jevt), evt)
 		bevt, _ := Marshal(evt)
 		events[i] = bevt
+		v2events[i], _ = AppendEvent(nil, evt)
 
 		var buf bytes.Buffer
 		gob.NewEncoder(&buf).Encode(evt)
@@ -104,6 +115,18 @@ func BenchmarkBinaryDecoding(b *testing.B) {
 		}
 	})
 
+	b.Run("binary.Unmarshal/v2", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, bevt := range v2events {
+				evt := &nostr.Event{}
+				err := Unmarshal(bevt, evt)
+				if err != nil {
+					b.Fatalf("failed to unmarshal: %s", err)
+				}
+			}
+		}
+	})
+
 	b.Run("binary.UnmarshalBinary", func(b *testing.B) {
 		for i := 0; i < b.N; i++ {
 			for _, bevt := range events {
@@ -1,9 +1,12 @@
 package binary
 
 import (
+	"bytes"
 	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
+	"io"
+	"strings"
 	"testing"
 
 	"github.com/nbd-wtf/go-nostr"
@@ -58,6 +61,123 @@ func TestBinaryEncode(t *testing.T) {
 	}
 }
 
+func TestVersion2(t *testing.T) {
+	var buf []byte
+	for _, jevt := range normalEvents {
+		pevt := &nostr.Event{}
+		if err := json.Unmarshal([]byte(jevt), pevt); err != nil {
+			t.Fatalf("failed to decode normal json: %s", err)
+		}
+
+		var err error
+		buf, err = AppendEvent(buf[:0], pevt)
+		if err != nil {
+			t.Fatalf("failed to encode binary: %s", err)
+		}
+		if !IsVersion2(buf) {
+			t.Fatal("should be version 2")
+		}
+
+		evt := &nostr.Event{}
+		if err := Unmarshal(buf, evt); err != nil {
+			t.Fatalf("error unmarshalling binary: %s", err)
+		}
+		checkParsedCorrectly(t, evt, jevt)
+
+		view := View(buf)
+		if view.ID() != pevt.ID || view.PubKey() != pevt.PubKey || view.Sig() != pevt.Sig ||
+			view.CreatedAt() != pevt.CreatedAt || view.Kind() != pevt.Kind || view.Content() != pevt.Content {
+			t.Fatalf("partial access is wrong for %s", pevt.ID)
+		}
+
+		// the same view works with the old format
+		old, _ := Marshal(pevt)
+		view = View(old)
+		if view.ID() != pevt.ID || view.CreatedAt() != pevt.CreatedAt || view.Kind() != pevt.Kind || view.Content() != pevt.Content {
+			t.Fatalf("partial access is wrong for %s in the old format", pevt.ID)
+		}
+
+		// truncated data must fail, but not panic
+		if err := unmarshalV2(buf[:len(buf)-1], &nostr.Event{}); err != ErrMalformed {
+			t.Fatal("truncated data should have failed to decode")
+		}
+	}
+}
+
+func TestVersion2WithoutLimits(t *testing.T) {
+	evt := &nostr.Event{
+		ID:        strings.Repeat("a", 64),
+		PubKey:    strings.Repeat("b", 64),
+		Sig:       strings.Repeat("c", 128),
+		CreatedAt: MaxCreatedAt + 1,
+		Kind:      MaxKind + 1,
+		Content:   strings.Repeat("x", MaxContentSize+1),
+		Tags:      nostr.Tags{make(nostr.Tag, MaxTagItemCount+1), {strings.Repeat("y", MaxTagItemSize+1)}},
+	}
+	if EventEligibleForBinaryEncoding(evt) {
+		t.Fatal("this event shouldn't be encodable in the old format")
+	}
+
+	data, err := AppendEvent(nil, evt)
+	if err != nil {
+		t.Fatalf("failed to encode: %s", err)
+	}
+	decoded := &nostr.Event{}
+	if err := Unmarshal(data, decoded); err != nil {
+		t.Fatalf("failed to decode: %s", err)
+	}
+	if decoded.CreatedAt != evt.CreatedAt || decoded.Kind != evt.Kind || decoded.Content != evt.Content ||
+		len(decoded.Tags[0]) != MaxTagItemCount+1 || decoded.Tags[1][0] != evt.Tags[1][0] {
+		t.Fatal("decoded event is different")
+	}
+}
+
+func TestOldDataThatLooksLikeVersion2(t *testing.T) {
+	evt := &nostr.Event{}
+	json.Unmarshal([]byte(normalEvents[2]), evt)
+	evt.ID = "ff6e6202" + evt.ID[8:] // the version 2 header
+
+	old, err := Marshal(evt)
+	if err != nil {
+		t.Fatalf("failed to encode: %s", err)
+	}
+	if !IsVersion2(old) {
+		t.Fatal("should look like version 2")
+	}
+
+	decoded := &nostr.Event{}
+	if err := Unmarshal(old, decoded); err != nil {
+		t.Fatalf("failed to decode: %s", err)
+	}
+	if decoded.ID != evt.ID || decoded.Content != evt.Content {
+		t.Fatal("should have been decoded in the old format")
+	}
+}
+
+func TestStream(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	for _, jevt := range normalEvents {
+		evt := &nostr.Event{}
+		json.Unmarshal([]byte(jevt), evt)
+		if err := w.Write(evt); err != nil {
+			t.Fatalf("failed to write: %s", err)
+		}
+	}
+
+	r := NewReader(buf)
+	for _, jevt := range normalEvents {
+		evt := &nostr.Event{}
+		if err := r.Read(evt); err != nil {
+			t.Fatalf("failed to read: %s", err)
+		}
+		checkParsedCorrectly(t, evt, jevt)
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
+
 func checkParsedCorrectly(t *testing.T, evt *nostr.Event, jevt string) (isBad bool) {
 	var canonical nostr.Event
 	err := json.Unmarshal([]byte(jevt), &canonical)
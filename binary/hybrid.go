@@ -8,7 +8,19 @@ import (
 	"github.com/nbd-wtf/go-nostr"
 )
 
+// Unmarshal decodes an event in any of the formats: the one written by Marshal or version 2,
+// written by AppendEvent.
 func Unmarshal(data []byte, evt *nostr.Event) (err error) {
+	if IsVersion2(data) {
+		if err := unmarshalV2(data, evt); err == nil {
+			return nil
+		}
+		// it may still be an event in the old format that just happened to start like this
+	}
+	return unmarshalV1(data, evt)
+}
+
+func unmarshalV1(data []byte, evt *nostr.Event) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			err = fmt.Errorf("failed to decode binary: %v", r)
@@ -48,6 +60,9 @@ func Unmarshal(data []byte, evt *nostr.Event) (err error) {
 	return err
 }
 
+// Marshal encodes the event in the original format, which has the limits defined in limits.go
+// and can't be told apart from other data. AppendEvent writes the version 2 format, without these
+// problems.
 func Marshal(evt *nostr.Event) ([]byte, error) {
 	content := []byte(evt.Content)
 	buf := make([]byte, 32+32+64+4+2+2+len(content)+65536+len(evt.Tags)*40 /* blergh */)
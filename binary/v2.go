@@ -0,0 +1,286 @@
+package binary
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+/*
+The version 2 format has no limits other than the ones imposed by the integer types:
+
+	header       4 bytes:  0xff 'n' 'b' <version>
+	id          32 bytes
+	pubkey      32 bytes
+	sig         64 bytes
+	created_at   8 bytes:  big-endian
+	kind         uvarint
+	content      uvarint length + bytes
+	tags         uvarint count, then for each tag:
+	                 uvarint count, then for each item: uvarint length + bytes
+
+The first fields are always at the same offsets, so they can be read without decoding the rest,
+see View.
+
+Data in the old format (the one written by Marshal) doesn't have a header, so Unmarshal decodes
+it as before unless it happens to start with the header and also decode perfectly as version 2.
+*/
+
+const Version2 = 2
+
+var header = [4]byte{0xff, 'n', 'b', Version2}
+
+const (
+	v2IDStart        = 4
+	v2PubKeyStart    = v2IDStart + 32
+	v2SigStart       = v2PubKeyStart + 32
+	v2CreatedAtStart = v2SigStart + 64
+	v2FixedSize      = v2CreatedAtStart + 8
+)
+
+var ErrMalformed = errors.New("malformed binary event")
+
+// AppendEvent encodes the event in the version 2 format, appending it to dst.
+func AppendEvent(dst []byte, evt *nostr.Event) ([]byte, error) {
+	if len(evt.ID) != 64 || len(evt.PubKey) != 64 || len(evt.Sig) != 128 {
+		return dst, fmt.Errorf("event has invalid id, pubkey or sig")
+	}
+	if evt.CreatedAt < 0 || evt.Kind < 0 {
+		return dst, fmt.Errorf("can't encode negative created_at or kind")
+	}
+
+	start := len(dst)
+	dst = append(dst, header[:]...)
+	dst = append(dst, make([]byte, 32+32+64)...)
+	if _, err := hex.Decode(dst[start+v2IDStart:], []byte(evt.ID)); err != nil {
+		return dst[:start], fmt.Errorf("invalid id: %w", err)
+	}
+	if _, err := hex.Decode(dst[start+v2PubKeyStart:], []byte(evt.PubKey)); err != nil {
+		return dst[:start], fmt.Errorf("invalid pubkey: %w", err)
+	}
+	if _, err := hex.Decode(dst[start+v2SigStart:], []byte(evt.Sig)); err != nil {
+		return dst[:start], fmt.Errorf("invalid sig: %w", err)
+	}
+	dst = binary.BigEndian.AppendUint64(dst, uint64(evt.CreatedAt))
+	dst = binary.AppendUvarint(dst, uint64(evt.Kind))
+
+	dst = binary.AppendUvarint(dst, uint64(len(evt.Content)))
+	dst = append(dst, evt.Content...)
+
+	dst = binary.AppendUvarint(dst, uint64(len(evt.Tags)))
+	for _, tag := range evt.Tags {
+		dst = binary.AppendUvarint(dst, uint64(len(tag)))
+		for _, item := range tag {
+			dst = binary.AppendUvarint(dst, uint64(len(item)))
+			dst = append(dst, item...)
+		}
+	}
+
+	return dst, nil
+}
+
+// IsVersion2 tells if data looks like it is in the version 2 format.
+func IsVersion2(data []byte) bool {
+	return len(data) >= v2FixedSize && [4]byte(data[0:4]) == header
+}
+
+func unmarshalV2(data []byte, evt *nostr.Event) error {
+	if !IsVersion2(data) {
+		return ErrMalformed
+	}
+
+	evt.ID = hex.EncodeToString(data[v2IDStart:v2PubKeyStart])
+	evt.PubKey = hex.EncodeToString(data[v2PubKeyStart:v2SigStart])
+	evt.Sig = hex.EncodeToString(data[v2SigStart:v2CreatedAtStart])
+	evt.CreatedAt = nostr.Timestamp(binary.BigEndian.Uint64(data[v2CreatedAtStart:v2FixedSize]))
+
+	r := v2Reader{data: data, pos: v2FixedSize}
+	evt.Kind = int(r.uvarint())
+	evt.Content = string(r.bytes())
+
+	nTags := r.count()
+	evt.Tags = make(nostr.Tags, nTags)
+	for t := range evt.Tags {
+		tag := make(nostr.Tag, r.count())
+		for i := range tag {
+			tag[i] = string(r.bytes())
+		}
+		evt.Tags[t] = tag
+	}
+
+	if r.err || r.pos != len(data) {
+		return ErrMalformed
+	}
+	return nil
+}
+
+// v2Reader reads the variable-length fields, it never panics, it sets err instead.
+type v2Reader struct {
+	data []byte
+	pos  int
+	err  bool
+}
+
+func (r *v2Reader) uvarint() uint64 {
+	if r.err {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		r.err = true
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+// count reads a number of things that follow, each of them is at least one byte long.
+func (r *v2Reader) count() int {
+	v := r.uvarint()
+	if v > uint64(len(r.data)-r.pos) {
+		r.err = true
+		return 0
+	}
+	return int(v)
+}
+
+func (r *v2Reader) bytes() []byte {
+	size := r.uvarint()
+	if r.err || size > uint64(len(r.data)-r.pos) {
+		r.err = true
+		return nil
+	}
+	b := r.data[r.pos : r.pos+int(size)]
+	r.pos += int(size)
+	return b
+}
+
+// View reads fields from an encoded event without decoding all of it. It works with both
+// formats, but it doesn't check if the data is well-formed, so its methods may panic otherwise.
+type View []byte
+
+func (v View) base() int {
+	if IsVersion2(v) {
+		return v2IDStart
+	}
+	return 0
+}
+
+func (v View) RawID() []byte     { b := v.base(); return v[b : b+32] }
+func (v View) RawPubKey() []byte { b := v.base(); return v[b+32 : b+64] }
+func (v View) RawSig() []byte    { b := v.base(); return v[b+64 : b+128] }
+func (v View) ID() string        { return hex.EncodeToString(v.RawID()) }
+func (v View) PubKey() string    { return hex.EncodeToString(v.RawPubKey()) }
+func (v View) Sig() string       { return hex.EncodeToString(v.RawSig()) }
+
+func (v View) CreatedAt() nostr.Timestamp {
+	if IsVersion2(v) {
+		return nostr.Timestamp(binary.BigEndian.Uint64(v[v2CreatedAtStart:v2FixedSize]))
+	}
+	return nostr.Timestamp(binary.BigEndian.Uint32(v[128:132]))
+}
+
+func (v View) Kind() int {
+	if IsVersion2(v) {
+		kind, _ := binary.Uvarint(v[v2FixedSize:])
+		return int(kind)
+	}
+	return int(binary.BigEndian.Uint16(v[132:134]))
+}
+
+func (v View) Content() string {
+	if IsVersion2(v) {
+		r := v2Reader{data: v, pos: v2FixedSize}
+		r.uvarint()
+		return string(r.bytes())
+	}
+	return string(v[136 : 136+int(binary.BigEndian.Uint16(v[134:136]))])
+}
+
+// AppendFrame encodes the event like AppendEvent, prefixed by its length as an uvarint, so many
+// of them can be written one after the other to a file or stream and read back with a Reader.
+func AppendFrame(dst []byte, evt *nostr.Event) ([]byte, error) {
+	// reserve the longest possible length prefix, then move the event back if it's shorter
+	start := len(dst)
+	dst = append(dst, make([]byte, binary.MaxVarintLen64)...)
+	dst, err := AppendEvent(dst, evt)
+	if err != nil {
+		return dst[:start], err
+	}
+
+	size := len(dst) - start - binary.MaxVarintLen64
+	var prefix [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(prefix[:], uint64(size))
+	copy(dst[start:], prefix[:n])
+	copy(dst[start+n:], dst[start+binary.MaxVarintLen64:])
+	return dst[:start+n+size], nil
+}
+
+// Writer writes events to a stream as frames.
+type Writer struct {
+	w   io.Writer
+	buf []byte
+}
+
+func NewWriter(w io.Writer) *Writer { return &Writer{w: w} }
+
+func (w *Writer) Write(evt *nostr.Event) error {
+	var err error
+	w.buf, err = AppendFrame(w.buf[:0], evt)
+	if err != nil {
+		return err
+	}
+	_, err = w.w.Write(w.buf)
+	return err
+}
+
+// Reader reads events written as frames, in any of the formats.
+type Reader struct {
+	// MaxSize is the maximum size of a frame, defaults to 16MB.
+	MaxSize int
+
+	r   *bufio.Reader
+	buf []byte
+}
+
+func NewReader(r io.Reader) *Reader { return &Reader{r: bufio.NewReader(r)} }
+
+// Next returns the next encoded event, which is only valid until the next call.
+// It returns io.EOF when there are no more events.
+func (r *Reader) Next() (View, error) {
+	size, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return nil, err
+	}
+
+	maxSize := r.MaxSize
+	if maxSize == 0 {
+		maxSize = 16 << 20
+	}
+	if size > uint64(maxSize) {
+		return nil, fmt.Errorf("frame of %d bytes is too large", size)
+	}
+
+	if cap(r.buf) < int(size) {
+		r.buf = make([]byte, size)
+	}
+	r.buf = r.buf[:size]
+	if _, err := io.ReadFull(r.r, r.buf); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return View(r.buf), nil
+}
+
+// Read decodes the next event into evt.
+func (r *Reader) Read(evt *nostr.Event) error {
+	data, err := r.Next()
+	if err != nil {
+		return err
+	}
+	return Unmarshal(data, evt)
+}
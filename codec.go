@@ -0,0 +1,80 @@
+package nostr
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Codec encodes and decodes envelopes to and from websocket messages. JSONCodec is the one defined
+// by NIP-01 and is always used unless another one is negotiated as a websocket subprotocol, see
+// WithCodecs. See msgpack.Codec for a binary one.
+type Codec interface {
+	// Subprotocol is the websocket subprotocol that identifies the codec in the handshake.
+	Subprotocol() string
+
+	// Binary tells if messages are sent in binary frames instead of text frames.
+	Binary() bool
+
+	// AppendEnvelope encodes env, appending it to dst.
+	AppendEnvelope(dst []byte, env Envelope) ([]byte, error)
+
+	// DecodeEnvelope decodes an envelope, which must not keep references to data.
+	DecodeEnvelope(data []byte) (Envelope, error)
+}
+
+// JSONCodec is the default Codec, it doesn't have a subprotocol.
+type JSONCodec struct{}
+
+func (_ JSONCodec) Subprotocol() string { return "" }
+func (_ JSONCodec) Binary() bool        { return false }
+
+func (_ JSONCodec) AppendEnvelope(dst []byte, env Envelope) ([]byte, error) {
+	b, err := env.MarshalJSON()
+	if err != nil {
+		return dst, err
+	}
+	return append(dst, b...), nil
+}
+
+func (_ JSONCodec) DecodeEnvelope(data []byte) (Envelope, error) {
+	env := ParseMessage(data)
+	if env == nil {
+		return nil, fmt.Errorf("invalid envelope")
+	}
+	return env, nil
+}
+
+var _ Codec = JSONCodec{}
+
+// WithCodecs offers the given codecs to relays as websocket subprotocols when connecting, in order
+// of preference. If the relay picks one of them it is used for all messages in that connection,
+// otherwise JSONCodec is used.
+//
+// It can be given to NewRelay, to NewSimplePool, in which case it is used by all relays in the
+// pool, or to NewConnection.
+type WithCodecs []Codec
+
+func (_ WithCodecs) IsRelayOption()      {}
+func (_ WithCodecs) IsPoolOption()       {}
+func (_ WithCodecs) IsConnectionOption() {}
+func (o WithCodecs) Apply(pool *SimplePool) {
+	pool.relayOptions = append(pool.relayOptions, o)
+}
+
+var (
+	_ RelayOption      = WithCodecs{}
+	_ PoolOption       = WithCodecs{}
+	_ ConnectionOption = WithCodecs{}
+)
+
+// SelectCodec is for servers: given the subprotocols a client offered in the handshake, in its
+// order of preference, it returns the first of the codecs that matches one of them, or JSONCodec.
+// The subprotocol of the returned codec must be sent back in the handshake response when not empty.
+func SelectCodec(offered []string, codecs ...Codec) Codec {
+	for _, protocol := range offered {
+		if idx := slices.IndexFunc(codecs, func(c Codec) bool { return c.Subprotocol() == protocol }); idx != -1 {
+			return codecs[idx]
+		}
+	}
+	return JSONCodec{}
+}
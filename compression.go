@@ -0,0 +1,150 @@
+package nostr
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// WithCompression tunes the permessage-deflate compression (RFC 7692) that is negotiated with
+// relays. Without it messages are compressed at level 4, all of them, and the compression context
+// is reset after each one.
+//
+// It can be given to NewRelay, to NewSimplePool, in which case it is used by all relays in the
+// pool, or to NewConnection.
+type WithCompression struct {
+	// Disabled stops compression from being offered to the relay at all.
+	Disabled bool
+
+	// Level is the flate level used for the messages we send, from flate.BestSpeed to
+	// flate.BestCompression, or flate.HuffmanOnly. Zero means the default, 4.
+	Level int
+
+	// Threshold is the size in bytes below which messages are sent uncompressed, as small ones
+	// usually get bigger when compressed.
+	Threshold int
+
+	// ContextTakeover asks for the compression context to be kept from one message to the next
+	// in both directions, which compresses similar messages (like events from the same
+	// subscription) much better at the cost of keeping 32KB of state for each direction. Relays
+	// can still refuse it, in which case the context is reset after each message as usual.
+	ContextTakeover bool
+}
+
+func (_ WithCompression) IsRelayOption()      {}
+func (_ WithCompression) IsPoolOption()       {}
+func (_ WithCompression) IsConnectionOption() {}
+func (o WithCompression) Apply(pool *SimplePool) {
+	pool.relayOptions = append(pool.relayOptions, o)
+}
+
+var (
+	_ RelayOption      = WithCompression{}
+	_ PoolOption       = WithCompression{}
+	_ ConnectionOption = WithCompression{}
+)
+
+// ConnectionStats counts what went through a Connection. Raw bytes are the sizes of the messages
+// themselves and wire bytes the sizes of their payloads as sent over the websocket, that is, after
+// compression, without frame headers.
+type ConnectionStats struct {
+	MessagesIn            int64
+	MessagesOut           int64
+	CompressedMessagesIn  int64
+	CompressedMessagesOut int64
+	RawBytesIn            int64
+	RawBytesOut           int64
+	WireBytesIn           int64
+	WireBytesOut          int64
+}
+
+// CompressionRatio is how many raw bytes were transferred for each byte on the wire in both
+// directions, e.g. 3 if compression saved two thirds of the bandwidth. It is 1 when nothing was.
+func (s ConnectionStats) CompressionRatio() float64 {
+	return ratio(s.RawBytesIn+s.RawBytesOut, s.WireBytesIn+s.WireBytesOut)
+}
+
+// CompressionRatioIn is the same as CompressionRatio, only for the messages received.
+func (s ConnectionStats) CompressionRatioIn() float64 { return ratio(s.RawBytesIn, s.WireBytesIn) }
+
+// CompressionRatioOut is the same as CompressionRatio, only for the messages sent.
+func (s ConnectionStats) CompressionRatioOut() float64 { return ratio(s.RawBytesOut, s.WireBytesOut) }
+
+func ratio(raw, wire int64) float64 {
+	if wire == 0 {
+		return 1
+	}
+	return float64(raw) / float64(wire)
+}
+
+// connectionStats is what ConnectionStats is made from, it is updated by the reader and the
+// writer while Stats can be called from anywhere.
+type connectionStats struct {
+	messagesIn            atomic.Int64
+	messagesOut           atomic.Int64
+	compressedMessagesIn  atomic.Int64
+	compressedMessagesOut atomic.Int64
+	rawBytesIn            atomic.Int64
+	rawBytesOut           atomic.Int64
+	wireBytesIn           atomic.Int64
+	wireBytesOut          atomic.Int64
+}
+
+func (s *connectionStats) received(raw, wire int64, compressed bool) {
+	s.messagesIn.Add(1)
+	if compressed {
+		s.compressedMessagesIn.Add(1)
+	}
+	s.rawBytesIn.Add(raw)
+	s.wireBytesIn.Add(wire)
+}
+
+func (s *connectionStats) sent(raw, wire int64, compressed bool) {
+	s.messagesOut.Add(1)
+	if compressed {
+		s.compressedMessagesOut.Add(1)
+	}
+	s.rawBytesOut.Add(raw)
+	s.wireBytesOut.Add(wire)
+}
+
+func (s *connectionStats) snapshot() ConnectionStats {
+	return ConnectionStats{
+		MessagesIn:            s.messagesIn.Load(),
+		MessagesOut:           s.messagesOut.Load(),
+		CompressedMessagesIn:  s.compressedMessagesIn.Load(),
+		CompressedMessagesOut: s.compressedMessagesOut.Load(),
+		RawBytesIn:            s.rawBytesIn.Load(),
+		RawBytesOut:           s.rawBytesOut.Load(),
+		WireBytesIn:           s.wireBytesIn.Load(),
+		WireBytesOut:          s.wireBytesOut.Load(),
+	}
+}
+
+// deflateWindowSize is the biggest window deflate can refer back to.
+const deflateWindowSize = 1 << 15
+
+// deflateWindow keeps the last bytes that were decompressed, for when the relay keeps its
+// compression context and its next message may refer to them.
+type deflateWindow struct {
+	data []byte
+}
+
+func (w *deflateWindow) Write(p []byte) (int, error) {
+	w.data = append(w.data, p...)
+	if extra := len(w.data) - deflateWindowSize; extra > 0 {
+		w.data = append(w.data[:0], w.data[extra:]...)
+	}
+	return len(p), nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
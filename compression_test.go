@@ -0,0 +1,162 @@
+package nostr
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gobwas/httphead"
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsflate"
+	"github.com/gobwas/ws/wsutil"
+)
+
+func TestCompression(t *testing.T) {
+	server := newDeflateEchoServer(t)
+	defer server.Close()
+	url := NormalizeURL(server.URL)
+
+	// hex compresses to about half of it the first time and to almost nothing after that when
+	// the compression context is kept
+	message := make([]byte, 1500)
+	x := uint64(1)
+	for i := range message {
+		x = x*6364136223846793005 + 1442695040888963407
+		message[i] = "0123456789abcdef"[x>>60]
+	}
+
+	for _, test := range []struct {
+		name          string
+		option        WithCompression
+		compressedOut bool
+		compressedIn  bool // the server compresses everything when it can
+		takeover      bool
+	}{
+		{"default", WithCompression{}, true, true, false},
+		{"takeover", WithCompression{ContextTakeover: true, Level: flate.BestCompression}, true, true, true},
+		{"threshold", WithCompression{Threshold: 2000}, false, true, false},
+		{"disabled", WithCompression{Disabled: true}, false, false, false},
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		conn, err := NewConnection(ctx, url, nil, nil, test.option)
+		if err != nil {
+			t.Fatalf("%s: failed to connect: %s", test.name, err)
+		}
+
+		var wireSizes []int64
+		for i := 0; i < 3; i++ {
+			before := conn.Stats()
+			if err := conn.WriteMessage(message); err != nil {
+				t.Fatalf("%s: failed to write: %s", test.name, err)
+			}
+			buf := &bytes.Buffer{}
+			if err := conn.ReadMessage(ctx, buf); err != nil {
+				t.Fatalf("%s: failed to read: %s", test.name, err)
+			}
+			if !bytes.Equal(buf.Bytes(), message) {
+				t.Fatalf("%s: message %d came back as %q", test.name, i, buf.String())
+			}
+			after := conn.Stats()
+			wireSizes = append(wireSizes, after.WireBytesOut-before.WireBytesOut, after.WireBytesIn-before.WireBytesIn)
+		}
+
+		stats := conn.Stats()
+		if stats.MessagesOut != 3 || stats.MessagesIn != 3 ||
+			stats.RawBytesOut != 3*int64(len(message)) || stats.RawBytesIn != 3*int64(len(message)) {
+			t.Errorf("%s: wrong counts: %+v", test.name, stats)
+		}
+		if test.compressedOut != (stats.CompressedMessagesOut == 3 && stats.CompressionRatioOut() > 1.5) ||
+			!test.compressedOut && stats.CompressionRatioOut() != 1 {
+			t.Errorf("%s: wrong compression of messages sent: %+v", test.name, stats)
+		}
+		if test.compressedIn != (stats.CompressedMessagesIn == 3 && stats.CompressionRatioIn() > 1.5) ||
+			!test.compressedIn && stats.CompressionRatioIn() != 1 {
+			t.Errorf("%s: wrong compression of messages received: %+v", test.name, stats)
+		}
+		for i := 2; i < len(wireSizes); i++ {
+			smaller := wireSizes[i] < wireSizes[i%2]/10
+			if smaller != test.takeover {
+				t.Errorf("%s: message sizes on the wire were %v", test.name, wireSizes)
+				break
+			}
+		}
+
+		conn.Close()
+		cancel()
+	}
+
+	if _, err := NewConnection(context.Background(), url, nil, nil, WithCompression{Level: 20}); err == nil {
+		t.Errorf("expected an error for an invalid level")
+	}
+}
+
+// newDeflateEchoServer sends back every message it gets, compressed with the same parameters that
+// were negotiated, keeping the compression contexts when it is allowed to.
+func newDeflateEchoServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var params wsflate.Parameters
+		negotiated := false
+		upgrader := ws.HTTPUpgrader{
+			Negotiate: func(opt httphead.Option) (httphead.Option, error) {
+				if string(opt.Name) != wsflate.ExtensionName || negotiated {
+					return httphead.Option{}, nil
+				}
+				negotiated = true
+				if err := params.Parse(opt); err != nil {
+					return httphead.Option{}, err
+				}
+				return params.Option(), nil
+			},
+		}
+		conn, _, _, err := upgrader.Upgrade(r, w)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var history []byte // what the client compressed before, when it keeps its context
+		var out bytes.Buffer
+		fw, _ := flate.NewWriter(&out, flate.BestCompression)
+		for {
+			frame, err := ws.ReadFrame(conn)
+			if err != nil || frame.Header.OpCode == ws.OpClose {
+				return
+			}
+			frame = ws.UnmaskFrameInPlace(frame)
+			msg := frame.Payload
+
+			if frame.Header.Rsv1() {
+				tail := []byte{0, 0, 0xff, 0xff, 1, 0, 0, 0xff, 0xff}
+				fr := flate.NewReaderDict(io.MultiReader(bytes.NewReader(frame.Payload), bytes.NewReader(tail)), history)
+				if msg, err = io.ReadAll(fr); err != nil {
+					t.Errorf("failed to decompress: %s", err)
+					return
+				}
+				if !params.ClientNoContextTakeover {
+					history = append(history, msg...)
+				}
+			}
+
+			if !negotiated {
+				wsutil.WriteServerText(conn, msg)
+				continue
+			}
+			if params.ServerNoContextTakeover {
+				fw.Reset(&out)
+			}
+			out.Reset()
+			fw.Write(msg)
+			fw.Flush()
+			payload := out.Bytes()[:out.Len()-4]
+			ws.WriteFrame(conn, ws.Frame{
+				Header:  ws.Header{Fin: true, Rsv: ws.Rsv(true, false, false), OpCode: ws.OpText, Length: int64(len(payload))},
+				Payload: payload,
+			})
+		}
+	}))
+}
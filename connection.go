@@ -18,36 +18,96 @@ import (
 )
 
 type Connection struct {
-	conn              net.Conn
-	enableCompression bool
-	controlHandler    wsutil.FrameHandlerFunc
-	flateReader       *wsflate.Reader
-	reader            *wsutil.Reader
-	flateWriter       *wsflate.Writer
-	writer            *wsutil.Writer
-	msgStateR         *wsflate.MessageState
-	msgStateW         *wsflate.MessageState
+	conn                 net.Conn
+	enableCompression    bool
+	readContextTakeover  bool // the relay keeps its compression context between messages
+	writeContextTakeover bool // we keep ours
+	controlHandler       wsutil.FrameHandlerFunc
+	flateReader          *wsflate.Reader
+	window               *deflateWindow
+	reader               *wsutil.Reader
+	flateWriter          *flate.Writer
+	deflated             bytes.Buffer
+	writer               *wsutil.Writer
+	msgStateR            *wsflate.MessageState
+	msgStateW            *wsflate.MessageState
+	codec                Codec
+	compression          WithCompression
+	stats                connectionStats
 }
 
-func NewConnection(ctx context.Context, url string, requestHeader http.Header, tlsConfig *tls.Config) (*Connection, error) {
+// ConnectionOption is an option for NewConnection.
+type ConnectionOption interface {
+	IsConnectionOption()
+}
+
+func NewConnection(ctx context.Context, url string, requestHeader http.Header, tlsConfig *tls.Config, opts ...ConnectionOption) (*Connection, error) {
+	var codecs WithCodecs
+	var netDial WithNetDial
+	var compression WithCompression
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case WithCodecs:
+			codecs = o
+		case WithNetDial:
+			netDial = o
+		case WithCompression:
+			compression = o
+		}
+	}
+	if compression.Level == 0 {
+		compression.Level = 4
+	}
+
+	// fail early instead of after connecting
+	var flateWriter *flate.Writer
+	if !compression.Disabled {
+		var err error
+		if flateWriter, err = flate.NewWriter(nil, compression.Level); err != nil {
+			return nil, fmt.Errorf("invalid compression level: %w", err)
+		}
+	}
+
 	dialer := ws.Dialer{
-		Header: ws.HandshakeHeaderHTTP(requestHeader),
-		Extensions: []httphead.Option{
-			wsflate.DefaultParameters.Option(),
-		},
+		Header:    ws.HandshakeHeaderHTTP(requestHeader),
 		TLSConfig: tlsConfig,
+		NetDial:   netDial,
+	}
+	if !compression.Disabled {
+		dialer.Extensions = []httphead.Option{
+			wsflate.Parameters{
+				ServerNoContextTakeover: !compression.ContextTakeover,
+				ClientNoContextTakeover: !compression.ContextTakeover,
+			}.Option(),
+		}
+	}
+	for _, codec := range codecs {
+		if protocol := codec.Subprotocol(); protocol != "" {
+			dialer.Protocols = append(dialer.Protocols, protocol)
+		}
 	}
 	conn, _, hs, err := dialer.Dial(ctx, url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to dial: %w", err)
 	}
 
+	var codec Codec = JSONCodec{}
+	for _, c := range codecs {
+		if hs.Protocol != "" && c.Subprotocol() == hs.Protocol {
+			codec = c
+			break
+		}
+	}
+
 	enableCompression := false
+	var accepted wsflate.Parameters
 	state := ws.StateClientSide
 	for _, extension := range hs.Extensions {
 		if string(extension.Name) == wsflate.ExtensionName {
 			enableCompression = true
 			state |= ws.StateExtended
+			// if the relay sends parameters we can't parse we just don't keep any context
+			accepted.Parse(extension)
 			break
 		}
 	}
@@ -55,11 +115,13 @@ func NewConnection(ctx context.Context, url string, requestHeader http.Header, t
 	// reader
 	var flateReader *wsflate.Reader
 	var msgStateR wsflate.MessageState
+	window := &deflateWindow{}
 	if enableCompression {
 		msgStateR.SetCompressed(true)
 
 		flateReader = wsflate.NewReader(nil, func(r io.Reader) wsflate.Decompressor {
-			return flate.NewReader(r)
+			// the window stays empty when the relay doesn't keep its context
+			return flate.NewReaderDict(r, window.data)
 		})
 	}
 
@@ -75,56 +137,75 @@ func NewConnection(ctx context.Context, url string, requestHeader http.Header, t
 	}
 
 	// writer
-	var flateWriter *wsflate.Writer
 	var msgStateW wsflate.MessageState
-	if enableCompression {
-		msgStateW.SetCompressed(true)
-
-		flateWriter = wsflate.NewWriter(nil, func(w io.Writer) wsflate.Compressor {
-			fw, err := flate.NewWriter(w, 4)
-			if err != nil {
-				InfoLogger.Printf("Failed to create flate writer: %v", err)
-			}
-			return fw
-		})
+	op := ws.OpText
+	if codec.Binary() {
+		op = ws.OpBinary
 	}
-
-	writer := wsutil.NewWriter(conn, state, ws.OpText)
+	writer := wsutil.NewWriter(conn, state, op)
 	writer.SetExtensions(&msgStateW)
 
-	return &Connection{
-		conn:              conn,
-		enableCompression: enableCompression,
-		controlHandler:    controlHandler,
-		flateReader:       flateReader,
-		reader:            reader,
-		msgStateR:         &msgStateR,
-		flateWriter:       flateWriter,
-		writer:            writer,
-		msgStateW:         &msgStateW,
-	}, nil
+	c := &Connection{
+		conn:                 conn,
+		enableCompression:    enableCompression,
+		readContextTakeover:  enableCompression && !accepted.ServerNoContextTakeover,
+		writeContextTakeover: enableCompression && compression.ContextTakeover && !accepted.ClientNoContextTakeover,
+		controlHandler:       controlHandler,
+		flateReader:          flateReader,
+		window:               window,
+		reader:               reader,
+		msgStateR:            &msgStateR,
+		flateWriter:          flateWriter,
+		writer:               writer,
+		msgStateW:            &msgStateW,
+		codec:                codec,
+		compression:          compression,
+	}
+	if flateWriter != nil {
+		flateWriter.Reset(&c.deflated)
+	}
+
+	return c, nil
 }
 
+// Codec returns the codec that was negotiated for this connection.
+func (c *Connection) Codec() Codec { return c.codec }
+
+// Stats returns how many messages and bytes were sent and received through this connection so far
+// and how well they were compressed.
+func (c *Connection) Stats() ConnectionStats { return c.stats.snapshot() }
+
 func (c *Connection) WriteMessage(data []byte) error {
-	if c.msgStateW.IsCompressed() && c.enableCompression {
-		c.flateWriter.Reset(c.writer)
-		if _, err := io.Copy(c.flateWriter, bytes.NewReader(data)); err != nil {
-			return fmt.Errorf("failed to write message: %w", err)
-		}
+	compress := c.enableCompression && len(data) >= c.compression.Threshold
+	c.msgStateW.SetCompressed(compress)
 
-		if err := c.flateWriter.Close(); err != nil {
-			return fmt.Errorf("failed to close flate writer: %w", err)
+	payload := data
+	if compress {
+		if !c.writeContextTakeover {
+			c.flateWriter.Reset(&c.deflated)
 		}
-	} else {
-		if _, err := io.Copy(c.writer, bytes.NewReader(data)); err != nil {
-			return fmt.Errorf("failed to write message: %w", err)
+		c.deflated.Reset()
+		if _, err := c.flateWriter.Write(data); err != nil {
+			return fmt.Errorf("failed to compress message: %w", err)
+		}
+		if err := c.flateWriter.Flush(); err != nil {
+			return fmt.Errorf("failed to flush flate writer: %w", err)
 		}
+
+		// the flush ends with 0x00 0x00 0xff 0xff, which is left out of the message (RFC 7692, 7.2.1)
+		payload = c.deflated.Bytes()
+		payload = payload[:len(payload)-4]
+	}
+
+	if _, err := c.writer.Write(payload); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
 	}
 
 	if err := c.writer.Flush(); err != nil {
 		return fmt.Errorf("failed to flush writer: %w", err)
 	}
 
+	c.stats.sent(int64(len(data)), int64(len(payload)), compress)
 	return nil
 }
 
@@ -157,14 +238,23 @@ func (c *Connection) ReadMessage(ctx context.Context, buf io.Writer) error {
 	}
 
 	if c.msgStateR.IsCompressed() && c.enableCompression {
-		c.flateReader.Reset(c.reader)
-		if _, err := io.Copy(buf, c.flateReader); err != nil {
+		wire := &countingReader{r: c.reader}
+		c.flateReader.Reset(wire)
+		dst := buf
+		if c.readContextTakeover {
+			dst = io.MultiWriter(buf, c.window)
+		}
+		raw, err := io.Copy(dst, c.flateReader)
+		if err != nil {
 			return fmt.Errorf("failed to read message: %w", err)
 		}
+		c.stats.received(raw, wire.n, true)
 	} else {
-		if _, err := io.Copy(buf, c.reader); err != nil {
+		raw, err := io.Copy(buf, c.reader)
+		if err != nil {
 			return fmt.Errorf("failed to read message: %w", err)
 		}
+		c.stats.received(raw, raw, false)
 	}
 
 	return nil
@@ -0,0 +1,22 @@
+package nostr
+
+// WithEventDecoder replaces the JSON decoder used for the events relays send, for example with
+// one that is faster for some encoding that is still valid JSON. To use encodings relays must
+// agree to, negotiate them with WithCodecs instead, like nson.Codec does.
+//
+// It can be given to NewRelay or to NewSimplePool, in which case it is used by all relays in the pool.
+type WithEventDecoder struct {
+	// Decode decodes the event object from an EVENT envelope. It must not keep references to data.
+	Decode func(data []byte, evt *Event) error
+}
+
+func (_ WithEventDecoder) IsRelayOption() {}
+func (_ WithEventDecoder) IsPoolOption()  {}
+func (o WithEventDecoder) Apply(pool *SimplePool) {
+	pool.relayOptions = append(pool.relayOptions, o)
+}
+
+var (
+	_ RelayOption = WithEventDecoder{}
+	_ PoolOption  = WithEventDecoder{}
+)
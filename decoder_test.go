@@ -0,0 +1,62 @@
+package nostr
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mailru/easyjson"
+	"golang.org/x/net/websocket"
+)
+
+func TestEventDecoder(t *testing.T) {
+	priv, _ := makeKeyPair(t)
+	note := Event{Kind: KindTextNote, CreatedAt: Now(), Content: "hello"}
+	if err := note.Sign(priv); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	ws := newWebsocketServer(func(conn *websocket.Conn) {
+		for {
+			var raw []json.RawMessage
+			if err := websocket.JSON.Receive(conn, &raw); err != nil {
+				return
+			}
+			if string(raw[0]) != `"REQ"` {
+				continue
+			}
+			subid, _ := parseSubscriptionMessage(t, raw)
+			websocket.JSON.Send(conn, []any{"EVENT", subid, note})
+			websocket.JSON.Send(conn, []any{"EOSE", subid})
+		}
+	})
+	defer ws.Close()
+
+	var decoded atomic.Int32
+	decoder := WithEventDecoder{
+		Decode: func(data []byte, evt *Event) error {
+			decoded.Add(1)
+			return easyjson.Unmarshal(data, evt)
+		},
+	}
+	rl, err := RelayConnect(context.Background(), ws.URL, decoder)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer rl.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	received, err := rl.QuerySync(ctx, Filter{Kinds: []int{KindTextNote}})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(received) != 1 || received[0].ID != note.ID {
+		t.Fatalf("expected the note, got %v", received)
+	}
+	if decoded.Load() != 1 {
+		t.Errorf("decoder called %d times, expected 1", decoded.Load())
+	}
+}
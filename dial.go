@@ -0,0 +1,158 @@
+package nostr
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// WithNetDial makes connections to relays be opened with the given function instead of a direct
+// TCP connection, TLS is still done on top of what it returns for wss:// relays. See DialProxy.
+//
+// It can be given to NewRelay, to NewSimplePool, in which case it is used by all relays in the
+// pool, or to NewConnection.
+type WithNetDial func(ctx context.Context, network, addr string) (net.Conn, error)
+
+func (_ WithNetDial) IsRelayOption()      {}
+func (_ WithNetDial) IsPoolOption()       {}
+func (_ WithNetDial) IsConnectionOption() {}
+func (o WithNetDial) Apply(pool *SimplePool) {
+	pool.relayOptions = append(pool.relayOptions, o)
+}
+
+var (
+	_ RelayOption      = WithNetDial(nil)
+	_ PoolOption       = WithNetDial(nil)
+	_ ConnectionOption = WithNetDial(nil)
+)
+
+// HTTPClient returns an http.Client that opens its connections with this function, or
+// http.DefaultClient if there isn't one, for making other requests to relays that must go through
+// the same proxy, like fetching their NIP-11 documents.
+func (o WithNetDial) HTTPClient() *http.Client {
+	if o == nil {
+		return http.DefaultClient
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // the environment must not send these elsewhere
+	transport.DialContext = o
+	transport.DisableKeepAlives = true // these clients are not reused
+	return &http.Client{Transport: transport}
+}
+
+// DialProxy returns a WithNetDial that connects to all relays through the proxy given as an URL:
+//
+//   - socks5://[user:password@]host:port for a SOCKS5 proxy, which resolves the relay hostnames
+//     itself, so it can be Tor (usually at socks5://127.0.0.1:9050) for reaching .onion relays;
+//   - http://[user:password@]host:port for an HTTP proxy that supports CONNECT;
+//   - unix:///path/to/socket for sending everything to a unix socket, whatever the relay URL is.
+func DialProxy(proxyURL string) (WithNetDial, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url: %w", err)
+	}
+
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		dialer, err := proxy.FromURL(u, &net.Dialer{})
+		if err != nil {
+			return nil, err
+		}
+		contextDialer, ok := dialer.(proxy.ContextDialer)
+		if !ok {
+			return nil, fmt.Errorf("proxy dialer doesn't support contexts")
+		}
+		return contextDialer.DialContext, nil
+	case "http":
+		return dialHTTPConnect(u), nil
+	case "unix":
+		path := u.Path
+		if path == "" {
+			path = u.Opaque
+		}
+		return func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported proxy scheme '%s'", u.Scheme)
+}
+
+func dialHTTPConnect(proxyURL *url.URL) WithNetDial {
+	var authorization string
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username()+":"+password))
+	}
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		proxyAddr = net.JoinHostPort(proxyURL.Hostname(), "80")
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := (&net.Dialer{}).DialContext(ctx, network, proxyAddr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to proxy: %w", err)
+		}
+
+		// the handshake with the proxy must respect the context too
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		}
+		stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+		defer stop()
+
+		req := &http.Request{
+			Method: http.MethodConnect,
+			URL:    &url.URL{Opaque: addr},
+			Host:   addr,
+			Header: make(http.Header),
+		}
+		if authorization != "" {
+			req.Header.Set("Proxy-Authorization", authorization)
+		}
+		if err := req.Write(conn); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to write CONNECT request: %w", err)
+		}
+
+		reader := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(reader, req)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to read CONNECT response: %w", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			conn.Close()
+			return nil, fmt.Errorf("proxy refused to connect: %s", resp.Status)
+		}
+
+		if !stop() {
+			// the context was canceled while we were at it
+			conn.Close()
+			return nil, ctx.Err()
+		}
+		conn.SetDeadline(time.Time{})
+
+		if reader.Buffered() > 0 {
+			// the relay has already said something, don't lose it
+			return &bufferedConn{Conn: conn, reader: reader}, nil
+		}
+		return conn, nil
+	}
+}
+
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) { return c.reader.Read(p) }
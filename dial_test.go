@@ -0,0 +1,150 @@
+package nostr
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDialProxy(t *testing.T) {
+	priv, _ := makeKeyPair(t)
+	note := &Event{Kind: KindTextNote, CreatedAt: Now(), Content: "hello"}
+	note.Sign(priv)
+	store := newStoreServer(t, note)
+	defer store.Close()
+	storeAddr := store.Listener.Addr().String()
+
+	pipe := func(a, b net.Conn) {
+		go func() { io.Copy(a, b); a.Close() }()
+		io.Copy(b, a)
+		b.Close()
+	}
+
+	// a unix socket that leads to the relay
+	socketPath := filepath.Join(t.TempDir(), "relay.sock")
+	unixListener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer unixListener.Close()
+	go func() {
+		for {
+			conn, err := unixListener.Accept()
+			if err != nil {
+				return
+			}
+			upstream, err := net.Dial("tcp", storeAddr)
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			go pipe(conn, upstream)
+		}
+	}()
+
+	// an http proxy that requires a password
+	var connected atomic.Int32
+	proxyListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer proxyListener.Close()
+	go func() {
+		for {
+			conn, err := proxyListener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				req, err := http.ReadRequest(bufio.NewReader(conn))
+				if err != nil || req.Method != http.MethodConnect {
+					conn.Close()
+					return
+				}
+				if req.Header.Get("Proxy-Authorization") != "Basic "+base64.StdEncoding.EncodeToString([]byte("user:pass")) {
+					io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+					conn.Close()
+					return
+				}
+				upstream, err := net.Dial("tcp", req.Host)
+				if err != nil {
+					io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+					conn.Close()
+					return
+				}
+				connected.Add(1)
+				io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+				pipe(conn, upstream)
+			}()
+		}
+	}()
+
+	for _, tc := range []struct {
+		proxy    string
+		relayURL string
+		fails    bool
+	}{
+		{"unix://" + socketPath, "ws://relay.example.com", false},
+		{"http://user:pass@" + proxyListener.Addr().String(), store.URL, false},
+		{"http://user:wrong@" + proxyListener.Addr().String(), store.URL, true},
+	} {
+		dial, err := DialProxy(tc.proxy)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.proxy, err)
+		}
+
+		// the limits must be fetched through the proxy too
+		var fetched atomic.Bool
+		negotiation := WithCapabilityNegotiation{
+			FetchLimits: func(ctx context.Context, url string, client *http.Client) (*RelayLimits, error) {
+				resp, err := client.Get("http" + url[2:])
+				if err != nil {
+					return nil, err
+				}
+				resp.Body.Close()
+				fetched.Store(true)
+				return nil, nil
+			},
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		rl, err := RelayConnect(ctx, tc.relayURL, dial, negotiation)
+		if tc.fails {
+			if err == nil {
+				t.Errorf("%s: should have failed", tc.proxy)
+				rl.Close()
+			}
+			cancel()
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: connect: %v", tc.proxy, err)
+		}
+		if !fetched.Load() {
+			t.Errorf("%s: limits weren't fetched through the proxy", tc.proxy)
+		}
+		received, err := rl.QuerySync(ctx, Filter{Kinds: []int{KindTextNote}})
+		if err != nil || len(received) != 1 {
+			t.Errorf("%s: query: %v %v", tc.proxy, received, err)
+		}
+		rl.Close()
+		cancel()
+	}
+	if connected.Load() != 2 {
+		t.Errorf("expected two connections through the http proxy, got %d", connected.Load())
+	}
+
+	if _, err := DialProxy("socks5://127.0.0.1:9050"); err != nil {
+		t.Errorf("socks5: %v", err)
+	}
+	if _, err := DialProxy("ftp://x"); err == nil {
+		t.Errorf("ftp proxies aren't a thing")
+	}
+}
@@ -390,3 +390,98 @@ func (v AuthEnvelope) MarshalJSON() ([]byte, error) {
 	w.RawString(`]`)
 	return w.BuildBytes()
 }
+
+// PeekEnvelope reads the label of an envelope and, for the ones that have it (EVENT, EOSE,
+// CLOSED, COUNT, REQ and CLOSE), the subscription id, without decoding anything else.
+// rest is what comes after the subscription id and the comma that follows it, so for EVENT
+// envelopes it is the event object followed by the closing bracket. For OK, NOTICE and AUTH,
+// which have no subscription id, rest is what comes after the label and its comma.
+//
+// ok is false if the message can't be read this way (it may still be a valid envelope that
+// ParseMessage understands, e.g. if the subscription id has escaped characters).
+func PeekEnvelope(message []byte) (label string, subscriptionID string, rest []byte, ok bool) {
+	i := skipWhitespace(message, 0)
+	if i >= len(message) || message[i] != '[' {
+		return "", "", nil, false
+	}
+	i = skipWhitespace(message, i+1)
+
+	rawLabel, i, ok := peekString(message, i)
+	if !ok {
+		return "", "", nil, false
+	}
+
+	// switching on string(bytes) doesn't allocate
+	switch string(rawLabel) {
+	case "EVENT":
+		label = "EVENT"
+	case "EOSE":
+		label = "EOSE"
+	case "CLOSED":
+		label = "CLOSED"
+	case "COUNT":
+		label = "COUNT"
+	case "REQ":
+		label = "REQ"
+	case "CLOSE":
+		label = "CLOSE"
+	case "OK":
+		label = "OK"
+	case "NOTICE":
+		label = "NOTICE"
+	case "AUTH":
+		label = "AUTH"
+	default:
+		return "", "", nil, false
+	}
+
+	i = skipWhitespace(message, i)
+	if i >= len(message) || message[i] != ',' {
+		return "", "", nil, false
+	}
+	i = skipWhitespace(message, i+1)
+
+	switch label {
+	case "OK", "NOTICE", "AUTH":
+		return label, "", message[i:], true
+	}
+
+	rawID, i, ok := peekString(message, i)
+	if !ok {
+		if label == "EVENT" && i < len(message) && message[i] == '{' {
+			// EVENT envelopes sent by clients don't have a subscription id
+			return label, "", message[i:], true
+		}
+		return "", "", nil, false
+	}
+
+	i = skipWhitespace(message, i)
+	if i < len(message) && message[i] == ',' {
+		i = skipWhitespace(message, i+1)
+	}
+
+	return label, string(rawID), message[i:], true
+}
+
+// peekString reads a JSON string starting at i, it fails if it has escape sequences.
+func peekString(data []byte, i int) (value []byte, next int, ok bool) {
+	if i >= len(data) || data[i] != '"' {
+		return nil, i, false
+	}
+	end := bytes.IndexByte(data[i+1:], '"')
+	if end == -1 {
+		return nil, i, false
+	}
+	value = data[i+1 : i+1+end]
+	if bytes.IndexByte(value, '\\') != -1 {
+		return nil, i, false
+	}
+	return value, i + 1 + end + 1, true
+}
+
+func skipWhitespace(data []byte, i int) int {
+	for i < len(data) && (data[i] == ' ' || data[i] == '\n' || data[i] == '\r' || data[i] == '\t') {
+		i++
+	}
+	return i
+}
@@ -1,8 +1,12 @@
 package nostr
 
 import (
+	"bytes"
 	"encoding/json"
 	"testing"
+
+	"github.com/mailru/easyjson"
+	"github.com/puzpuzpuz/xsync/v3"
 )
 
 func TestEventEnvelopeEncodingAndDecoding(t *testing.T) {
@@ -182,3 +186,92 @@ func TestParseMessage(t *testing.T) {
 }
 
 func ptr[S any](s S) *S { return &s }
+
+func TestPeekEnvelope(t *testing.T) {
+	testCases := []struct {
+		Message        string
+		Label          string
+		SubscriptionID string
+		Rest           string
+		OK             bool
+	}{
+		{`["EVENT","sub",{"kind":1}]`, "EVENT", "sub", `{"kind":1}]`, true},
+		{`[ "EVENT" , "sub" , {"kind":1} ]`, "EVENT", "sub", `{"kind":1} ]`, true},
+		{`["EVENT",{"kind":1}]`, "EVENT", "", `{"kind":1}]`, true},
+		{`["EOSE","sub"]`, "EOSE", "sub", `]`, true},
+		{`["CLOSED","sub","error: no"]`, "CLOSED", "sub", `"error: no"]`, true},
+		{`["OK","abc",true,""]`, "OK", "", `"abc",true,""]`, true},
+		{`["NOTICE", "hello"]`, "NOTICE", "", `"hello"]`, true},
+		{`["EVENT","s\"ub",{}]`, "", "", "", false},
+		{`["WHAT","sub"]`, "", "", "", false},
+		{`{"EVENT":"sub"}`, "", "", "", false},
+		{``, "", "", "", false},
+	}
+
+	for _, tc := range testCases {
+		label, subID, rest, ok := PeekEnvelope([]byte(tc.Message))
+		if ok != tc.OK || label != tc.Label || subID != tc.SubscriptionID || string(rest) != tc.Rest {
+			t.Errorf("PeekEnvelope(%s) = %q, %q, %q, %v", tc.Message, label, subID, rest, ok)
+		}
+	}
+}
+
+var benchmarkEventMessage = []byte(`["EVENT","_",{"kind":3,"id":"9e662bdd7d8abc40b5b15ee1ff5e9320efc87e9274d8d440c58e6eed2dddfbe2","pubkey":"373ebe3d45ec91977296a178d9f19f326c70631d2a1b0bbba5c5ecc2eb53b9e7","created_at":1644844224,"tags":[["p","3bf0c63fcb93463407af97a5e5ee64fa883d107ef9e558472c4eb9aaaefa459d"],["p","75fc5ac2487363293bd27fb0d14fb966477d0f1dbc6361d37806a6a740eda91e"],["p","46d0dfd3a724a302ca9175163bdf788f3606b3fd1bb12d5fe055d1e418cb60ea"]],"content":"{\"wss://nostr-pub.wellorder.net\":{\"read\":true,\"write\":true},\"wss://nostr.bitcoiner.social\":{\"read\":false,\"write\":true},\"wss://expensive-relay.fiatjaf.com\":{\"read\":true,\"write\":true},\"wss://relayer.fiatjaf.com\":{\"read\":true,\"write\":true},\"wss://relay.bitid.nz\":{\"read\":true,\"write\":true},\"wss://nostr.rocks\":{\"read\":true,\"write\":true}}","sig":"811355d3484d375df47581cb5d66bed05002c2978894098304f20b595e571b7e01b2efd906c5650080ffe49cf1c62b36715698e9d88b9e8be43029a2f3fa66be"}]`)
+
+func BenchmarkParseEventMessage(b *testing.B) {
+	b.Run("ParseMessage", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if ParseMessage(benchmarkEventMessage) == nil {
+				b.Fatal("failed to parse")
+			}
+		}
+	})
+
+	b.Run("PeekEnvelope", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _, rest, ok := PeekEnvelope(benchmarkEventMessage)
+			if !ok {
+				b.Fatal("failed to peek")
+			}
+			evt := eventPool.Get().(*Event)
+			*evt = Event{}
+			if err := easyjson.Unmarshal(rest[:bytes.LastIndexByte(rest, ']')], evt); err != nil {
+				b.Fatal(err)
+			}
+			eventPool.Put(evt)
+		}
+	})
+
+	// what happens to events for subscriptions we don't have
+	b.Run("PeekEnvelope/unknown subscription", func(b *testing.B) {
+		b.ReportAllocs()
+		subscriptions := xsync.NewMapOf[string, *Subscription]()
+		for i := 0; i < b.N; i++ {
+			_, subID, _, ok := PeekEnvelope(benchmarkEventMessage)
+			if !ok {
+				b.Fatal("failed to peek")
+			}
+			if _, ok := subscriptions.Load(subID); ok {
+				b.Fatal("shouldn't be there")
+			}
+		}
+	})
+}
+
+type testCodec struct{ JSONCodec }
+
+func (_ testCodec) Subprotocol() string { return "test" }
+
+func TestSelectCodec(t *testing.T) {
+	if codec := SelectCodec([]string{"other", "test"}, testCodec{}); codec != (testCodec{}) {
+		t.Errorf("expected testCodec, got %T", codec)
+	}
+	if codec := SelectCodec([]string{"other"}, testCodec{}); codec != (JSONCodec{}) {
+		t.Errorf("expected JSONCodec, got %T", codec)
+	}
+	if codec := SelectCodec(nil); codec != (JSONCodec{}) {
+		t.Errorf("expected JSONCodec, got %T", codec)
+	}
+}
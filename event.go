@@ -55,6 +55,14 @@ const (
 	KindMuteList                    int = 10000
 	KindPinList                     int = 10001
 	KindRelayListMetadata           int = 10002
+	KindBookmarkList                int = 10003
+	KindCommunityList               int = 10004
+	KindPublicChatList              int = 10005
+	KindBlockedRelayList            int = 10006
+	KindSearchRelayList             int = 10007
+	KindSimpleGroupList             int = 10009
+	KindInterestList                int = 10015
+	KindEmojiList                   int = 10030
 	KindNWCWalletInfo               int = 13194
 	KindClientAuthentication        int = 22242
 	KindNWCWalletRequest            int = 23194
@@ -62,11 +70,16 @@ const (
 	KindNostrConnect                int = 24133
 	KindCategorizedPeopleList       int = 30000
 	KindCategorizedBookmarksList    int = 30001
+	KindRelaySets                   int = 30002
+	KindBookmarkSets                int = 30003
+	KindCurationSets                int = 30004
 	KindProfileBadges               int = 30008
 	KindBadgeDefinition             int = 30009
+	KindInterestSets                int = 30015
 	KindStallDefinition             int = 30017
 	KindProductDefinition           int = 30018
 	KindArticle                     int = 30023
+	KindEmojiSets                   int = 30030
 	KindApplicationSpecificData     int = 30078
 	KindRepositoryAnnouncement      int = 30617
 	KindSimpleGroupMetadata         int = 39000
@@ -118,6 +131,12 @@ func (evt *Event) Serialize() []byte {
 // (which is a hash of the serialized event content).
 // returns an error if the signature itself is invalid.
 func (evt Event) CheckSignature() (bool, error) {
+	hash := sha256.Sum256(evt.Serialize())
+	return evt.checkSignature(hash[:])
+}
+
+// checkSignature is CheckSignature for when we have the hash already.
+func (evt *Event) checkSignature(hash []byte) (bool, error) {
 	// read and check pubkey
 	pk, err := hex.DecodeString(evt.PubKey)
 	if err != nil {
@@ -140,8 +159,7 @@ func (evt Event) CheckSignature() (bool, error) {
 	}
 
 	// check signature
-	hash := sha256.Sum256(evt.Serialize())
-	return sig.Verify(hash[:], pubkey), nil
+	return sig.Verify(hash, pubkey), nil
 }
 
 // Sign signs an event with a given privateKey.
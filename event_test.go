@@ -2,6 +2,7 @@ package nostr
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 )
 
@@ -142,3 +143,44 @@ func mustSignEvent(t *testing.T, privkey string, event *Event) {
 		t.Fatalf("event.Sign: %v", err)
 	}
 }
+
+func TestEventVerify(t *testing.T) {
+	priv, _ := makeKeyPair(t)
+	valid := Event{Kind: KindTextNote, CreatedAt: Now(), Tags: Tags{{"t", "test"}}, Content: "hello"}
+	if err := valid.Sign(priv); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if err := valid.Verify(); err != nil {
+		t.Fatalf("valid event failed to verify: %v", err)
+	}
+
+	for expected, tamper := range map[RejectionReason]func(evt *Event){
+		RejectedBadID:        func(evt *Event) { evt.Content = "changed" },
+		RejectedBadPubKey:    func(evt *Event) { evt.PubKey = strings.Repeat("f", 64); evt.ID = evt.GetID() }, // not on the curve
+		RejectedBadSignature: func(evt *Event) { evt.Sig = "00" + evt.Sig[2:] },
+		RejectedEmptyTag:     func(evt *Event) { evt.Tags = append(evt.Tags, Tag{}); evt.ID = evt.GetID() },
+		RejectedBadCreatedAt: func(evt *Event) { evt.CreatedAt = -1; evt.ID = evt.GetID() },
+	} {
+		evt := valid
+		evt.Tags = append(Tags{}, valid.Tags...)
+		tamper(&evt)
+
+		err := evt.Verify()
+		invalid, ok := err.(*InvalidEventError)
+		if !ok {
+			t.Errorf("%s: expected an *InvalidEventError, got %v", expected, err)
+			continue
+		}
+		if invalid.Reason != expected {
+			t.Errorf("expected %q, got %q", expected, invalid.Reason)
+		}
+	}
+
+	if !valid.CheckID() {
+		t.Error("CheckID failed on a valid event")
+	}
+	valid.Content = "changed"
+	if valid.CheckID() {
+		t.Error("CheckID passed on a tampered event")
+	}
+}
@@ -0,0 +1,86 @@
+package nostr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+)
+
+// RejectionReason is why Verify considered an event invalid.
+type RejectionReason string
+
+const (
+	RejectedBadID        RejectionReason = "id doesn't match the event"
+	RejectedBadPubKey    RejectionReason = "invalid pubkey"
+	RejectedBadSignature RejectionReason = "invalid signature"
+	RejectedEmptyTag     RejectionReason = "empty tag"
+	RejectedBadCreatedAt RejectionReason = "created_at out of bounds"
+)
+
+// InvalidEventError is returned by Verify.
+type InvalidEventError struct {
+	ID     string // the id the event claims to have
+	Reason RejectionReason
+	Detail string
+}
+
+func (e *InvalidEventError) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("event %s: %s", e.ID, e.Reason)
+	}
+	return fmt.Sprintf("event %s: %s: %s", e.ID, e.Reason, e.Detail)
+}
+
+// CheckID checks if the id of the event is the hash of its contents.
+func (evt *Event) CheckID() bool {
+	return evt.GetID() == evt.ID
+}
+
+// Verify checks everything that can be checked about an event without knowing what it is for:
+// that the id matches the contents, that the pubkey and the signature are well-formed and valid,
+// that there are no empty tags and that created_at is not negative nor absurdly large.
+// It returns an *InvalidEventError if something is wrong.
+func (evt *Event) Verify() error {
+	hash := sha256.Sum256(evt.Serialize())
+	if err := evt.verifyStructure(hash[:]); err != nil {
+		return err
+	}
+	return evt.verifySignature(hash[:])
+}
+
+// verifyStructure does everything Verify does except checking the signature.
+func (evt *Event) verifyStructure(hash []byte) error {
+	if len(evt.ID) != 64 || hex.EncodeToString(hash) != evt.ID {
+		return &InvalidEventError{ID: evt.ID, Reason: RejectedBadID}
+	}
+	if !IsValidPublicKeyHex(evt.PubKey) {
+		return &InvalidEventError{ID: evt.ID, Reason: RejectedBadPubKey, Detail: evt.PubKey}
+	}
+	if len(evt.Sig) != 128 {
+		return &InvalidEventError{ID: evt.ID, Reason: RejectedBadSignature, Detail: "wrong length"}
+	}
+	for i, tag := range evt.Tags {
+		if len(tag) == 0 {
+			return &InvalidEventError{ID: evt.ID, Reason: RejectedEmptyTag, Detail: fmt.Sprintf("tag %d", i)}
+		}
+	}
+	if evt.CreatedAt < 0 || evt.CreatedAt > math.MaxUint32 {
+		return &InvalidEventError{ID: evt.ID, Reason: RejectedBadCreatedAt, Detail: fmt.Sprint(evt.CreatedAt)}
+	}
+	return nil
+}
+
+func (evt *Event) verifySignature(hash []byte) error {
+	ok, err := evt.checkSignature(hash)
+	if err != nil {
+		if !IsValidPublicKey(evt.PubKey) {
+			return &InvalidEventError{ID: evt.ID, Reason: RejectedBadPubKey, Detail: err.Error()}
+		}
+		return &InvalidEventError{ID: evt.ID, Reason: RejectedBadSignature, Detail: err.Error()}
+	}
+	if !ok {
+		return &InvalidEventError{ID: evt.ID, Reason: RejectedBadSignature}
+	}
+	return nil
+}
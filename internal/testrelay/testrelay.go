@@ -0,0 +1,57 @@
+// Package testrelay has a minimal relay for tests that need to talk to one.
+package testrelay
+
+import (
+	"net/http/httptest"
+	"sync"
+
+	"github.com/nbd-wtf/go-nostr"
+	"golang.org/x/net/websocket"
+)
+
+// New starts a relay that keeps nothing and just broadcasts events to matching subscriptions.
+// It must be closed by the caller.
+func New() *httptest.Server {
+	var mu sync.Mutex
+	type sub struct {
+		conn    *websocket.Conn
+		filters nostr.Filters
+	}
+	subs := make(map[string]sub)
+
+	return httptest.NewServer(websocket.Server{
+		Handler: func(conn *websocket.Conn) {
+			for {
+				var msg string
+				if err := websocket.Message.Receive(conn, &msg); err != nil {
+					return
+				}
+				switch env := nostr.ParseMessage([]byte(msg)).(type) {
+				case *nostr.ReqEnvelope:
+					mu.Lock()
+					subs[env.SubscriptionID] = sub{conn, env.Filters}
+					mu.Unlock()
+					eose := nostr.EOSEEnvelope(env.SubscriptionID)
+					j, _ := eose.MarshalJSON()
+					websocket.Message.Send(conn, string(j))
+				case *nostr.CloseEnvelope:
+					mu.Lock()
+					delete(subs, string(*env))
+					mu.Unlock()
+				case *nostr.EventEnvelope:
+					mu.Lock()
+					for id, s := range subs {
+						if s.filters.Match(&env.Event) {
+							id := id
+							j, _ := nostr.EventEnvelope{SubscriptionID: &id, Event: env.Event}.MarshalJSON()
+							websocket.Message.Send(s.conn, string(j))
+						}
+					}
+					mu.Unlock()
+					j, _ := nostr.OKEnvelope{EventID: env.Event.ID, OK: true}.MarshalJSON()
+					websocket.Message.Send(conn, string(j))
+				}
+			}
+		},
+	})
+}
@@ -0,0 +1,43 @@
+// Package tlv has the TLV encoding NIP-19 uses for nprofile, nevent, naddr and nrelay codes, so
+// nostr and nip19 share it.
+package tlv
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcutil/bech32"
+)
+
+// Encoder collects TLV entries and then encodes them as a bech32 code. The first error it finds
+// is returned by Bech32.
+type Encoder struct {
+	buf bytes.Buffer
+	err error
+}
+
+// Write adds an entry, its value can't be longer than 255 bytes as the length is a single byte.
+func (e *Encoder) Write(typ uint8, value []byte) {
+	if e.err != nil {
+		return
+	}
+	if len(value) > 255 {
+		e.err = fmt.Errorf("value of TLV entry %d has %d bytes, the maximum is 255", typ, len(value))
+		return
+	}
+	e.buf.WriteByte(typ)
+	e.buf.WriteByte(uint8(len(value)))
+	e.buf.Write(value)
+}
+
+// Bech32 encodes the entries written so far with the given prefix.
+func (e *Encoder) Bech32(prefix string) (string, error) {
+	if e.err != nil {
+		return "", e.err
+	}
+	bits5, err := bech32.ConvertBits(e.buf.Bytes(), 8, 5, true)
+	if err != nil {
+		return "", fmt.Errorf("failed to convert bits: %w", err)
+	}
+	return bech32.Encode(prefix, bits5)
+}
@@ -0,0 +1,125 @@
+// Package jsonl moves events in bulk between relays, stores and files.
+//
+// The default format is JSON Lines: one event per line, as JSON. Lines can also be NSON, which is
+// still valid JSON, or the events can be encoded with the binary package, in which case they are
+// framed as by binary.Writer: each one prefixed by its length as an uvarint instead of being
+// terminated by a newline.
+package jsonl
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/mailru/easyjson/jwriter"
+	"github.com/nbd-wtf/go-nostr"
+	nostrbinary "github.com/nbd-wtf/go-nostr/binary"
+	"github.com/nbd-wtf/go-nostr/nson"
+)
+
+type Format int
+
+const (
+	JSON Format = iota
+	NSON
+	Binary
+)
+
+func (f Format) String() string {
+	switch f {
+	case JSON:
+		return "json"
+	case NSON:
+		return "nson"
+	case Binary:
+		return "binary"
+	}
+	return fmt.Sprintf("<unknown format %d>", int(f))
+}
+
+// Writer writes events to an io.Writer in one of the formats. It is buffered, so Flush must be
+// called when done.
+type Writer struct {
+	w       *bufio.Writer
+	format  Format
+	scratch []byte
+}
+
+func NewWriter(w io.Writer, format Format) *Writer {
+	return &Writer{w: bufio.NewWriter(w), format: format}
+}
+
+func (w *Writer) Write(evt *nostr.Event) error {
+	switch w.format {
+	case JSON:
+		jw := jwriter.Writer{}
+		evt.MarshalEasyJSON(&jw)
+		if jw.Error != nil {
+			return jw.Error
+		}
+		if _, err := jw.DumpTo(w.w); err != nil {
+			return err
+		}
+		return w.w.WriteByte('\n')
+	case NSON:
+		text, err := nson.Marshal(evt)
+		if err != nil {
+			return fmt.Errorf("event %s: %w", evt.ID, err)
+		}
+		w.w.WriteString(text)
+		return w.w.WriteByte('\n')
+	case Binary:
+		var err error
+		w.scratch, err = nostrbinary.AppendFrame(w.scratch[:0], evt)
+		if err != nil {
+			return fmt.Errorf("event %s: %w", evt.ID, err)
+		}
+		_, err = w.w.Write(w.scratch)
+		return err
+	}
+	return fmt.Errorf("unknown format %d", int(w.format))
+}
+
+func (w *Writer) Flush() error { return w.w.Flush() }
+
+// ExportQuery writes all the events store returns for filter to w and returns how many were written.
+func ExportQuery(ctx context.Context, store nostr.RelayStore, filter nostr.Filter, w io.Writer, format Format) (int, error) {
+	events, err := store.QuerySync(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query: %w", err)
+	}
+
+	writer := NewWriter(w, format)
+	for i, evt := range events {
+		if err := writer.Write(evt); err != nil {
+			return i, err
+		}
+	}
+	return len(events), writer.Flush()
+}
+
+// ExportChannel writes events as they come from a channel, like the ones returned by
+// SimplePool.SubMany or SimplePool.SubManyEose, until it is closed or ctx is canceled.
+// It returns how many events were written.
+func ExportChannel(ctx context.Context, events <-chan nostr.IncomingEvent, w io.Writer, format Format) (int, error) {
+	writer := NewWriter(w, format)
+	count := 0
+	for {
+		select {
+		case ie, ok := <-events:
+			if !ok {
+				return count, writer.Flush()
+			}
+			if err := writer.Write(ie.Event); err != nil {
+				return count, err
+			}
+			count++
+		case <-ctx.Done():
+			if err := writer.Flush(); err != nil {
+				return count, err
+			}
+			return count, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,400 @@
+package jsonl
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	nostrbinary "github.com/nbd-wtf/go-nostr/binary"
+	"github.com/nbd-wtf/go-nostr/nson"
+)
+
+var ErrEventTooLarge = errors.New("event is too large")
+
+// DecodeError is returned by Reader.Read when a single event can't be decoded.
+type DecodeError struct {
+	Offset int64
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("invalid event at offset %d: %s", e.Offset, e.Err)
+}
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+// DefaultMaxEventSize is used by readers when MaxEventSize is not set.
+const DefaultMaxEventSize = 1 << 20
+
+// Reader reads events written by a Writer, one at a time, so files of any size can be read.
+type Reader struct {
+	// MaxEventSize is the maximum size of a single encoded event, larger events are skipped
+	// and ErrEventTooLarge is returned for them.
+	MaxEventSize int
+
+	r      *bufio.Reader
+	format Format
+	offset int64
+	buf    []byte
+}
+
+func NewReader(r io.Reader, format Format) *Reader {
+	return &Reader{r: bufio.NewReaderSize(r, 64*1024), format: format}
+}
+
+// Offset is how many bytes of the input were consumed so far.
+func (r *Reader) Offset() int64 { return r.offset }
+
+// Read decodes the next event into evt. It returns io.EOF when there are no more events.
+// After a *DecodeError or ErrEventTooLarge Read can be called again to get the next event, other
+// errors come from the underlying reader.
+func (r *Reader) Read(evt *nostr.Event) error {
+	maxSize := r.MaxEventSize
+	if maxSize == 0 {
+		maxSize = DefaultMaxEventSize
+	}
+
+	if r.format == Binary {
+		return r.readBinary(evt, maxSize)
+	}
+
+	var line []byte
+	for {
+		var err error
+		line, err = r.readLine(maxSize)
+		if err != nil {
+			return err
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			break
+		}
+	}
+
+	*evt = nostr.Event{}
+	decode := evt.UnmarshalJSON
+	if r.format == NSON {
+		decode = func(line []byte) error { return nson.DecodeBytes(line, evt) }
+	}
+	if err := decode(line); err != nil {
+		return &DecodeError{r.offset, err}
+	}
+	return nil
+}
+
+func (r *Reader) readLine(maxSize int) ([]byte, error) {
+	r.buf = r.buf[:0]
+	tooLarge := false
+	for {
+		chunk, err := r.r.ReadSlice('\n')
+		r.offset += int64(len(chunk))
+		if !tooLarge {
+			if len(r.buf)+len(chunk) > maxSize {
+				tooLarge = true
+				r.buf = r.buf[:0]
+			} else {
+				r.buf = append(r.buf, chunk...)
+			}
+		}
+
+		switch {
+		case err == bufio.ErrBufferFull:
+			continue
+		case err == io.EOF && (len(r.buf) > 0 || tooLarge):
+			// last line without a trailing newline
+		case err != nil:
+			return nil, err
+		}
+
+		if tooLarge {
+			return nil, ErrEventTooLarge
+		}
+		return r.buf, nil
+	}
+}
+
+func (r *Reader) readBinary(evt *nostr.Event, maxSize int) error {
+	size, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		if err == io.EOF {
+			return err
+		}
+		return fmt.Errorf("failed to read size at offset %d: %w", r.offset, err)
+	}
+	r.offset += int64(uvarintLength(size))
+
+	if size > uint64(maxSize) {
+		n, err := io.CopyN(io.Discard, r.r, int64(size))
+		r.offset += n
+		if err != nil {
+			return err
+		}
+		return ErrEventTooLarge
+	}
+
+	if cap(r.buf) < int(size) {
+		r.buf = make([]byte, size)
+	}
+	r.buf = r.buf[:size]
+	n, err := io.ReadFull(r.r, r.buf)
+	r.offset += int64(n)
+	if err != nil {
+		return io.ErrUnexpectedEOF
+	}
+
+	*evt = nostr.Event{}
+	if err := nostrbinary.Unmarshal(r.buf, evt); err != nil {
+		return &DecodeError{r.offset, err}
+	}
+	return nil
+}
+
+func uvarintLength(v uint64) int {
+	n := 1
+	for v >= 0x80 {
+		v >>= 7
+		n++
+	}
+	return n
+}
+
+// Importer reads events from a file (or anything else), verifies them and publishes them to a store.
+type Importer struct {
+	Store  nostr.RelayStore
+	Format Format
+
+	// Workers is the number of goroutines verifying ids and signatures, defaults to runtime.NumCPU().
+	Workers int
+
+	// RateLimit is the maximum number of events published per second, zero means no limit.
+	RateLimit int
+
+	// MaxEventSize is passed to the Reader.
+	MaxEventSize int
+
+	// DedupWindow is how many ids are remembered for skipping duplicates. Memory usage is bounded
+	// by this, so duplicates that are too far apart in the input are published again.
+	// Defaults to 1,000,000.
+	DedupWindow int
+
+	// OnProgress is called every ProgressInterval events (defaults to 1000) and when done.
+	OnProgress       func(Progress)
+	ProgressInterval int
+
+	// OnInvalid, if set, is called for each event that couldn't be decoded or verified, or that
+	// the store didn't accept. evt is nil if it couldn't be decoded.
+	OnInvalid func(evt *nostr.Event, err error)
+}
+
+// Progress of an import. Counters start at zero when Import is called, even when resuming.
+type Progress struct {
+	// Offset in the input up to which all events were handled. Pass it to Import to resume from there.
+	Offset int64
+
+	Read       int
+	Published  int
+	Duplicates int
+	Invalid    int
+	Failed     int
+}
+
+type importItem struct {
+	evt    *nostr.Event
+	offset int64
+	err    error
+	done   chan struct{}
+}
+
+// Import reads all events from r and publishes them to the store in the order they are read,
+// starting at resumeFrom bytes into r (if r is an io.Seeker it is seeked, otherwise bytes are
+// skipped). Events that fail Event.Verify are not published.
+//
+// It returns when r is exhausted, when reading from it fails or when ctx is canceled, along
+// with the progress made until then.
+func (im Importer) Import(ctx context.Context, r io.Reader, resumeFrom int64) (Progress, error) {
+	progress := Progress{Offset: resumeFrom}
+
+	if resumeFrom > 0 {
+		if seeker, ok := r.(io.Seeker); ok {
+			if _, err := seeker.Seek(resumeFrom, io.SeekStart); err != nil {
+				return progress, fmt.Errorf("failed to seek to %d: %w", resumeFrom, err)
+			}
+		} else if _, err := io.CopyN(io.Discard, r, resumeFrom); err != nil {
+			return progress, fmt.Errorf("failed to skip to %d: %w", resumeFrom, err)
+		}
+	}
+
+	workers := im.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	interval := im.ProgressInterval
+	if interval <= 0 {
+		interval = 1000
+	}
+	dedup := newSeenSet(im.DedupWindow)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// items go to the workers to be verified and, in the same order, to the queue from which
+	// they are published, so the offset we report is always safe to resume from
+	jobs := make(chan *importItem, workers*4)
+	queue := make(chan *importItem, workers*4)
+	var readErr error
+
+	go func() {
+		defer close(jobs)
+		defer close(queue)
+
+		reader := NewReader(r, im.Format)
+		reader.MaxEventSize = im.MaxEventSize
+		for {
+			evt := &nostr.Event{}
+			err := reader.Read(evt)
+			if err == io.EOF {
+				return
+			}
+
+			item := &importItem{evt: evt, offset: resumeFrom + reader.Offset(), done: make(chan struct{})}
+			if err != nil {
+				var decodeErr *DecodeError
+				if !errors.As(err, &decodeErr) && err != ErrEventTooLarge {
+					readErr = err
+					return
+				}
+				item.evt = nil
+				item.err = err
+				close(item.done)
+			} else {
+				select {
+				case jobs <- item:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case queue <- item:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for w := 0; w < workers; w++ {
+		go func() {
+			for item := range jobs {
+				item.err = item.evt.Verify()
+				close(item.done)
+			}
+		}()
+	}
+
+	var ticker *time.Ticker
+	if im.RateLimit > 0 {
+		ticker = time.NewTicker(time.Second / time.Duration(im.RateLimit))
+		defer ticker.Stop()
+	}
+
+	report := func() {
+		if im.OnProgress != nil {
+			im.OnProgress(progress)
+		}
+	}
+	invalid := func(evt *nostr.Event, err error) {
+		if im.OnInvalid != nil {
+			im.OnInvalid(evt, err)
+		}
+	}
+
+	for item := range queue {
+		select {
+		case <-item.done:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			report()
+			return progress, ctx.Err()
+		}
+
+		progress.Read++
+		switch {
+		case item.err != nil:
+			progress.Invalid++
+			invalid(item.evt, item.err)
+		case !dedup.add(item.evt.ID):
+			progress.Duplicates++
+		default:
+			if ticker != nil {
+				select {
+				case <-ticker.C:
+				case <-ctx.Done():
+					report()
+					return progress, ctx.Err()
+				}
+			}
+
+			var rejected *nostr.RejectedError
+			if err := im.Store.Publish(ctx, *item.evt); err == nil {
+				progress.Published++
+			} else if errors.As(err, &rejected) && strings.HasPrefix(rejected.Reason, "duplicate:") {
+				progress.Duplicates++
+			} else if ctx.Err() != nil {
+				report()
+				return progress, ctx.Err()
+			} else {
+				progress.Failed++
+				invalid(item.evt, err)
+			}
+		}
+
+		progress.Offset = item.offset
+		if progress.Read%interval == 0 {
+			report()
+		}
+	}
+
+	report()
+	if readErr != nil {
+		return progress, fmt.Errorf("failed to read at offset %d: %w", progress.Offset, readErr)
+	}
+	return progress, ctx.Err()
+}
+
+// seenSet remembers up to about size ids, forgetting the oldest half when it gets full.
+type seenSet struct {
+	size     int
+	current  map[string]struct{}
+	previous map[string]struct{}
+}
+
+func newSeenSet(size int) *seenSet {
+	if size <= 0 {
+		size = 1_000_000
+	}
+	return &seenSet{size: size, current: make(map[string]struct{})}
+}
+
+// add returns false if id was seen already.
+func (s *seenSet) add(id string) bool {
+	if _, ok := s.current[id]; ok {
+		return false
+	}
+	if _, ok := s.previous[id]; ok {
+		return false
+	}
+	if len(s.current) >= s.size/2 {
+		s.previous = s.current
+		s.current = make(map[string]struct{}, s.size/2)
+	}
+	s.current[id] = struct{}{}
+	return true
+}
@@ -0,0 +1,222 @@
+package jsonl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryStore struct {
+	sync.Mutex
+	events []*nostr.Event
+}
+
+func (s *memoryStore) Publish(ctx context.Context, event nostr.Event) error {
+	s.Lock()
+	defer s.Unlock()
+	s.events = append(s.events, &event)
+	return nil
+}
+
+func (s *memoryStore) QuerySync(ctx context.Context, filter nostr.Filter, opts ...nostr.SubscriptionOption) ([]*nostr.Event, error) {
+	var results []*nostr.Event
+	for _, evt := range s.events {
+		if filter.Matches(evt) {
+			results = append(results, evt)
+		}
+	}
+	return results, nil
+}
+
+func makeEvents(t *testing.T, n int) []*nostr.Event {
+	sk := nostr.GeneratePrivateKey()
+	events := make([]*nostr.Event, n)
+	for i := range events {
+		events[i] = &nostr.Event{
+			Kind:      nostr.KindTextNote,
+			CreatedAt: nostr.Timestamp(1700000000 + i),
+			Content:   fmt.Sprintf("event %d\nwith a newline", i),
+			Tags:      nostr.Tags{{"t", "test"}},
+		}
+		require.NoError(t, events[i].Sign(sk))
+	}
+	return events
+}
+
+func TestRoundTrip(t *testing.T) {
+	events := makeEvents(t, 20)
+
+	for _, format := range []Format{JSON, NSON, Binary} {
+		t.Run(format.String(), func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			n, err := ExportQuery(context.Background(), &memoryStore{events: events}, nostr.Filter{}, buf, format)
+			require.NoError(t, err)
+			require.Equal(t, len(events), n)
+
+			reader := NewReader(buf, format)
+			for _, expected := range events {
+				evt := &nostr.Event{}
+				require.NoError(t, reader.Read(evt))
+				require.Equal(t, expected.ID, evt.ID)
+				require.Equal(t, expected.Content, evt.Content)
+				require.Equal(t, expected.Tags, evt.Tags)
+				require.Equal(t, expected.Sig, evt.Sig)
+			}
+			require.Equal(t, io.EOF, reader.Read(&nostr.Event{}))
+		})
+	}
+}
+
+func TestExportChannel(t *testing.T) {
+	events := makeEvents(t, 3)
+	ch := make(chan nostr.IncomingEvent, len(events))
+	for _, evt := range events {
+		ch <- nostr.IncomingEvent{Event: evt}
+	}
+	close(ch)
+
+	buf := &bytes.Buffer{}
+	n, err := ExportChannel(context.Background(), ch, buf, JSON)
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+	require.Equal(t, 3, strings.Count(buf.String(), "\n"))
+}
+
+func TestImport(t *testing.T) {
+	events := makeEvents(t, 50)
+
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf, JSON)
+	for i, evt := range events {
+		require.NoError(t, w.Write(evt))
+		if i == 10 {
+			require.NoError(t, w.Write(evt)) // duplicate
+			require.NoError(t, w.Flush())
+			buf.WriteString("\n{not json}\n")
+		}
+		if i == 20 {
+			tampered := *evt
+			tampered.Content = "tampered"
+			require.NoError(t, w.Write(&tampered))
+		}
+	}
+	require.NoError(t, w.Flush())
+
+	store := &memoryStore{}
+	var invalid int
+	progress, err := Importer{
+		Store:     store,
+		Workers:   4,
+		OnInvalid: func(evt *nostr.Event, err error) { invalid++ },
+	}.Import(context.Background(), bytes.NewReader(buf.Bytes()), 0)
+	require.NoError(t, err)
+	require.Equal(t, Progress{
+		Offset:     int64(buf.Len()),
+		Read:       53,
+		Published:  50,
+		Duplicates: 1,
+		Invalid:    2,
+	}, progress)
+	require.Equal(t, 2, invalid)
+	for i, evt := range store.events {
+		require.Equal(t, events[i].ID, evt.ID) // in order
+	}
+}
+
+// rejectingStore answers like a relay would for events it already has.
+type rejectingStore struct {
+	memoryStore
+	stored map[string]bool
+}
+
+func (s *rejectingStore) Publish(ctx context.Context, event nostr.Event) error {
+	if s.stored[event.ID] {
+		return errors.Join(&nostr.RejectedError{EventID: event.ID, Reason: "duplicate: already have this event"})
+	}
+	if event.Kind == nostr.KindReaction {
+		return fmt.Errorf("msg: not a duplicate: but an unrelated failure")
+	}
+	return s.memoryStore.Publish(ctx, event)
+}
+
+func TestImportRejected(t *testing.T) {
+	events := makeEvents(t, 5)
+	events[4].Kind = nostr.KindReaction
+	require.NoError(t, events[4].Sign(nostr.GeneratePrivateKey()))
+
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf, JSON)
+	for _, evt := range events {
+		require.NoError(t, w.Write(evt))
+	}
+	require.NoError(t, w.Flush())
+
+	store := &rejectingStore{stored: map[string]bool{events[1].ID: true, events[3].ID: true}}
+	progress, err := Importer{Store: store}.Import(context.Background(), bytes.NewReader(buf.Bytes()), 0)
+	require.NoError(t, err)
+	require.Equal(t, 2, progress.Published)
+	require.Equal(t, 2, progress.Duplicates)
+	require.Equal(t, 1, progress.Failed)
+}
+
+func TestImportResume(t *testing.T) {
+	events := makeEvents(t, 10)
+
+	buf := &bytes.Buffer{}
+	_, err := ExportQuery(context.Background(), &memoryStore{events: events}, nostr.Filter{}, buf, Binary)
+	require.NoError(t, err)
+	data := buf.Bytes()
+
+	// stop after a few events
+	ctx, cancel := context.WithCancel(context.Background())
+	store := &memoryStore{}
+	importer := Importer{
+		Store:            store,
+		Format:           Binary,
+		ProgressInterval: 1,
+		OnProgress: func(p Progress) {
+			if p.Published == 4 {
+				cancel()
+			}
+		},
+	}
+	progress, err := importer.Import(ctx, bytes.NewReader(data), 0)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, 4, progress.Published)
+
+	// then continue, with a reader that can't seek
+	importer.OnProgress = nil
+	progress, err = importer.Import(context.Background(), io.MultiReader(bytes.NewReader(data)), progress.Offset)
+	require.NoError(t, err)
+	require.Equal(t, 6, progress.Published)
+	require.Equal(t, int64(len(data)), progress.Offset)
+
+	require.Len(t, store.events, 10)
+	for i, evt := range store.events {
+		require.Equal(t, events[i].ID, evt.ID)
+	}
+}
+
+func TestReaderTooLarge(t *testing.T) {
+	events := makeEvents(t, 2)
+	events[0].Content = strings.Repeat("x", 1000)
+
+	buf := &bytes.Buffer{}
+	_, err := ExportQuery(context.Background(), &memoryStore{events: events}, nostr.Filter{}, buf, JSON)
+	require.NoError(t, err)
+
+	reader := NewReader(buf, JSON)
+	reader.MaxEventSize = 800
+	evt := &nostr.Event{}
+	require.ErrorIs(t, reader.Read(evt), ErrEventTooLarge)
+	require.NoError(t, reader.Read(evt))
+	require.Equal(t, events[1].ID, evt.ID)
+}
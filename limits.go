@@ -0,0 +1,100 @@
+package nostr
+
+import (
+	"context"
+	"net/http"
+)
+
+// RelayLimits are the restrictions a relay announces (usually on its NIP-11 information document)
+// that a Relay created WithCapabilityNegotiation will respect. Zero values mean no limit.
+type RelayLimits struct {
+	MaxMessageLength int
+	MaxSubscriptions int
+	MaxFilters       int
+	MaxLimit         int
+	MinPowDifficulty int
+	AuthRequired     bool
+}
+
+// WithCapabilityNegotiation makes relays fetch their limits when connecting and adapt to them:
+// filters are split across multiple REQs when there are too many, limits are clamped, subscriptions
+// beyond the maximum wait for others to be closed, relays that require auth are authenticated to
+// right away and proof-of-work is added to events published with Relay.PublishWithResult when the
+// relay asks for it.
+//
+// It can be given to NewRelay or to NewSimplePool, in which case it applies to all relays in the pool.
+// See nip11.CapabilityNegotiation for one that uses NIP-11 documents and NIP-13 proof-of-work.
+type WithCapabilityNegotiation struct {
+	// FetchLimits is called when connecting, relays whose limits can't be fetched are treated as unlimited.
+	// client connects the same way the relay does (see WithNetDial), so it must be used for any
+	// request made to the relay.
+	FetchLimits func(ctx context.Context, url string, client *http.Client) (*RelayLimits, error)
+
+	// Sign is used to authenticate to relays that require it and to sign events again after
+	// proof-of-work was added to them. Without it neither of these things will happen.
+	Sign func(event *Event) error
+
+	// GeneratePoW must add proof-of-work of at least the given difficulty to the event (which
+	// means changing its tags and created_at), or leave it untouched if it has enough already.
+	GeneratePoW func(ctx context.Context, event *Event, difficulty int) error
+}
+
+func (_ WithCapabilityNegotiation) IsRelayOption() {}
+func (_ WithCapabilityNegotiation) IsPoolOption()  {}
+func (o WithCapabilityNegotiation) Apply(pool *SimplePool) {
+	pool.relayOptions = append(pool.relayOptions, o)
+}
+
+var (
+	_ RelayOption = WithCapabilityNegotiation{}
+	_ PoolOption  = WithCapabilityNegotiation{}
+)
+
+// clamp returns a copy of filters with their limits lowered to MaxLimit.
+func (l *RelayLimits) clamp(filters Filters) Filters {
+	if l.MaxLimit <= 0 {
+		return filters
+	}
+
+	clamped := make(Filters, len(filters))
+	for i, filter := range filters {
+		if filter.Limit > l.MaxLimit {
+			filter.Limit = l.MaxLimit
+		}
+		clamped[i] = filter
+	}
+	return clamped
+}
+
+// split breaks filters into groups of at most MaxFilters, each to be sent in its own REQ.
+func (l *RelayLimits) split(filters Filters) []Filters {
+	if l.MaxFilters <= 0 || len(filters) <= l.MaxFilters {
+		return []Filters{filters}
+	}
+
+	chunks := make([]Filters, 0, (len(filters)+l.MaxFilters-1)/l.MaxFilters)
+	for start := 0; start < len(filters); start += l.MaxFilters {
+		chunks = append(chunks, filters[start:min(start+l.MaxFilters, len(filters))])
+	}
+	return chunks
+}
+
+// acquireSubscriptionSlots blocks until n subscriptions can be opened on slots or ctx is done.
+// Only one subscription acquires at a time so they are served in order and never deadlock
+// holding part of what they need.
+func (r *Relay) acquireSubscriptionSlots(ctx context.Context, slots chan struct{}, n int) error {
+	r.slotsMutex.Lock()
+	defer r.slotsMutex.Unlock()
+
+	for i := 0; i < n; i++ {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			for ; i > 0; i-- {
+				<-slots
+			}
+			return ctx.Err()
+		}
+	}
+	return nil
+}
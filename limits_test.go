@@ -0,0 +1,272 @@
+package nostr
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestCapabilityNegotiation(t *testing.T) {
+	priv, pub := makeKeyPair(t)
+	note := Event{Kind: KindTextNote, Content: "hello", CreatedAt: Now(), PubKey: pub}
+	if err := note.Sign(priv); err != nil {
+		t.Fatalf("note.Sign: %v", err)
+	}
+
+	// fake relay server that answers every REQ with the same event and an EOSE
+	var mu sync.Mutex // guards the things below
+	var reqs [][]Filter
+	var closes int
+	var published Event
+	ws := newWebsocketServer(func(conn *websocket.Conn) {
+		for {
+			var raw []json.RawMessage
+			if err := websocket.JSON.Receive(conn, &raw); err != nil {
+				return
+			}
+			var typ string
+			json.Unmarshal(raw[0], &typ)
+			switch typ {
+			case "REQ":
+				subid, filters := parseSubscriptionMessage(t, raw)
+				mu.Lock()
+				reqs = append(reqs, filters)
+				mu.Unlock()
+				websocket.JSON.Send(conn, []any{"EVENT", subid, note})
+				websocket.JSON.Send(conn, []any{"EOSE", subid})
+			case "CLOSE":
+				mu.Lock()
+				closes++
+				mu.Unlock()
+			case "EVENT":
+				event := parseEventMessage(t, raw)
+				mu.Lock()
+				published = event
+				mu.Unlock()
+				websocket.JSON.Send(conn, []any{"OK", event.ID, true, ""})
+			}
+		}
+	})
+	defer ws.Close()
+
+	rl := NewRelay(context.Background(), ws.URL, WithCapabilityNegotiation{
+		FetchLimits: func(ctx context.Context, url string, client *http.Client) (*RelayLimits, error) {
+			return &RelayLimits{MaxFilters: 2, MaxLimit: 10, MaxSubscriptions: 2, MinPowDifficulty: 1}, nil
+		},
+		Sign: func(event *Event) error { return event.Sign(priv) },
+		GeneratePoW: func(ctx context.Context, event *Event, difficulty int) error {
+			event.Tags = append(event.Tags, Tag{"nonce", "1", "1"})
+			return nil
+		},
+	})
+	if err := rl.Connect(context.Background()); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer rl.Close()
+
+	// three filters are sent in two REQs, with their limits clamped
+	sub, err := rl.Subscribe(context.Background(), Filters{{Limit: 50}, {Limit: 5}, {Kinds: []int{1}}})
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+
+	events := 0
+	timeout := time.After(2 * time.Second)
+wait:
+	for {
+		select {
+		case <-sub.Events:
+			events++
+		case <-sub.EndOfStoredEvents:
+			break wait
+		case <-timeout:
+			t.Fatal("timed out waiting for EOSE")
+		}
+	}
+	if events != 1 {
+		t.Errorf("got %d events, the same event should only be dispatched once", events)
+	}
+
+	mu.Lock()
+	if len(reqs) != 2 || len(reqs[0]) != 2 || len(reqs[1]) != 1 {
+		t.Errorf("filters should have been split in two REQs, got %v", reqs)
+	} else if reqs[0][0].Limit != 10 || reqs[0][1].Limit != 5 {
+		t.Errorf("limits should have been clamped, got %v", reqs[0])
+	}
+	mu.Unlock()
+
+	// the subscription above took both slots, so this one must wait for it to be closed
+	fired := make(chan struct{})
+	go func() {
+		sub2, err := rl.Subscribe(context.Background(), Filters{{Kinds: []int{1}}})
+		if err != nil {
+			t.Errorf("second subscribe: %v", err)
+		}
+		defer sub2.Unsub()
+		close(fired)
+	}()
+	select {
+	case <-fired:
+		t.Fatal("second subscription shouldn't have been fired while the first is open")
+	case <-time.After(100 * time.Millisecond):
+	}
+	sub.Unsub()
+	select {
+	case <-fired:
+	case <-time.After(2 * time.Second):
+		t.Fatal("second subscription wasn't fired after the first was closed")
+	}
+
+	// Publish sends the event untouched
+	if err := rl.Publish(context.Background(), note); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	mu.Lock()
+	if published.ID != note.ID {
+		t.Errorf("Publish shouldn't have changed the event: %v", published)
+	}
+	mu.Unlock()
+
+	// PublishWithResult adds proof-of-work, signs again and tells us what was sent
+	sent, err := rl.PublishWithResult(context.Background(), note)
+	if err != nil {
+		t.Fatalf("publish with result: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if closes < 2 {
+		t.Errorf("expected a CLOSE for each REQ, got %d", closes)
+	}
+	if published.ID == note.ID || published.Tags.GetFirst([]string{"nonce"}) == nil {
+		t.Errorf("published event should have proof-of-work: %v", published)
+	}
+	if sent.ID != published.ID {
+		t.Errorf("returned event %s isn't the one that was sent, %s", sent.ID, published.ID)
+	}
+	if ok, _ := published.CheckSignature(); !ok {
+		t.Errorf("published event should have been signed again")
+	}
+	if len(note.Tags) != 0 {
+		t.Errorf("original event shouldn't have been modified")
+	}
+}
+
+func TestCapabilityTooManyChunks(t *testing.T) {
+	var reqs atomic.Int32
+	ws := newWebsocketServer(func(conn *websocket.Conn) {
+		for {
+			var raw []json.RawMessage
+			if err := websocket.JSON.Receive(conn, &raw); err != nil {
+				return
+			}
+			var typ string
+			json.Unmarshal(raw[0], &typ)
+			if typ == "REQ" {
+				reqs.Add(1)
+				subid, _ := parseSubscriptionMessage(t, raw)
+				websocket.JSON.Send(conn, []any{"EOSE", subid})
+			}
+		}
+	})
+	defer ws.Close()
+
+	rl := NewRelay(context.Background(), ws.URL, WithCapabilityNegotiation{
+		FetchLimits: func(ctx context.Context, url string, client *http.Client) (*RelayLimits, error) {
+			return &RelayLimits{MaxFilters: 1, MaxSubscriptions: 2}, nil
+		},
+	})
+	if err := rl.Connect(context.Background()); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer rl.Close()
+
+	// three REQs would be needed, one more than the relay allows
+	_, err := rl.Subscribe(context.Background(), Filters{{Kinds: []int{1}}, {Kinds: []int{2}}, {Kinds: []int{3}}})
+	if err == nil {
+		t.Fatal("subscribe should have failed")
+	}
+
+	// two are fine
+	sub, err := rl.Subscribe(context.Background(), Filters{{Kinds: []int{1}}, {Kinds: []int{2}}})
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	select {
+	case <-sub.EndOfStoredEvents:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for EOSE")
+	}
+	sub.Unsub()
+	if n := reqs.Load(); n != 2 {
+		t.Errorf("expected 2 REQs, got %d", n)
+	}
+}
+
+func TestCapabilitySplitClosed(t *testing.T) {
+	closes := make(chan string, 2)
+	ws := newWebsocketServer(func(conn *websocket.Conn) {
+		for {
+			var raw []json.RawMessage
+			if err := websocket.JSON.Receive(conn, &raw); err != nil {
+				return
+			}
+			var typ string
+			json.Unmarshal(raw[0], &typ)
+			switch typ {
+			case "REQ":
+				subid, filters := parseSubscriptionMessage(t, raw)
+				if filters[0].Kinds[0] == 2 {
+					websocket.JSON.Send(conn, []any{"CLOSED", subid, "blocked: no kind 2"})
+				} else {
+					websocket.JSON.Send(conn, []any{"EOSE", subid})
+				}
+			case "CLOSE":
+				var subid string
+				json.Unmarshal(raw[1], &subid)
+				closes <- subid
+			}
+		}
+	})
+	defer ws.Close()
+
+	rl := NewRelay(context.Background(), ws.URL, WithCapabilityNegotiation{
+		FetchLimits: func(ctx context.Context, url string, client *http.Client) (*RelayLimits, error) {
+			return &RelayLimits{MaxFilters: 1}, nil
+		},
+	})
+	if err := rl.Connect(context.Background()); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer rl.Close()
+
+	sub, err := rl.Subscribe(context.Background(), Filters{{Kinds: []int{1}}, {Kinds: []int{2}}})
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	defer sub.Unsub()
+
+	select {
+	case reason := <-sub.ClosedReason:
+		if reason != "blocked: no kind 2" {
+			t.Errorf("wrong reason: %s", reason)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for CLOSED")
+	}
+
+	// the REQ that wasn't closed by the relay is closed by us
+	select {
+	case id := <-closes:
+		if id != sub.GetID() {
+			t.Errorf("expected a CLOSE for %s, got %s", sub.GetID(), id)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the other REQ wasn't closed")
+	}
+}
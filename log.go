@@ -1,14 +1,105 @@
 package nostr
 
 import (
+	"bytes"
+	"context"
+	"io"
 	"log"
+	"log/slog"
 	"os"
 )
 
 var (
 	// call SetOutput on InfoLogger to enable info logging
+	//
+	// Deprecated: use WithLogger or replace DefaultLogger, this is only where DefaultLogger writes info
+	// messages to.
 	InfoLogger = log.New(os.Stderr, "[go-nostr][info] ", log.LstdFlags)
 
 	// call SetOutput on DebugLogger to enable debug logging
+	//
+	// Deprecated: use WithLogger or replace DefaultLogger, this is only where DefaultLogger writes debug
+	// messages to when LogLevel is set to slog.LevelDebug.
 	DebugLogger = log.New(os.Stderr, "[go-nostr][debug] ", log.LstdFlags)
 )
+
+// LogLevel is the minimum level of the messages written by DefaultLogger, it can be changed at any
+// time, e.g. with LogLevel.Set(slog.LevelDebug).
+var LogLevel = new(slog.LevelVar)
+
+// DefaultLogger is used by relays and pools that weren't given WithLogger.
+var DefaultLogger = slog.New(defaultHandler{
+	info:  slog.NewTextHandler(loggerWriter{&InfoLogger}, &slog.HandlerOptions{Level: slog.LevelDebug, ReplaceAttr: dropTime}),
+	debug: slog.NewTextHandler(loggerWriter{&DebugLogger}, &slog.HandlerOptions{Level: slog.LevelDebug, ReplaceAttr: dropTime}),
+})
+
+// WithLogger makes relays and pools write their logs to the given logger instead of DefaultLogger.
+// Relays add the "relay" attribute to it.
+//
+// It can be given to NewRelay or to NewSimplePool, in which case it is used by all relays in the pool.
+type WithLogger struct {
+	Logger *slog.Logger
+}
+
+func (_ WithLogger) IsRelayOption() {}
+func (_ WithLogger) IsPoolOption()  {}
+func (o WithLogger) Apply(pool *SimplePool) {
+	if o.Logger != nil {
+		pool.logger = o.Logger
+	}
+	pool.relayOptions = append(pool.relayOptions, o)
+}
+
+var (
+	_ RelayOption = WithLogger{}
+	_ PoolOption  = WithLogger{}
+)
+
+// defaultHandler sends messages to InfoLogger or DebugLogger according to their level.
+type defaultHandler struct {
+	info  slog.Handler
+	debug slog.Handler
+}
+
+func (h defaultHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= LogLevel.Level()
+}
+
+func (h defaultHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level < slog.LevelInfo {
+		return h.debug.Handle(ctx, r)
+	}
+	return h.info.Handle(ctx, r)
+}
+
+func (h defaultHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return defaultHandler{h.info.WithAttrs(attrs), h.debug.WithAttrs(attrs)}
+}
+
+func (h defaultHandler) WithGroup(name string) slog.Handler {
+	return defaultHandler{h.info.WithGroup(name), h.debug.WithGroup(name)}
+}
+
+// loggerWriter writes to whatever logger is there at the time, so they can still be replaced.
+type loggerWriter struct{ logger **log.Logger }
+
+func (w loggerWriter) Write(p []byte) (int, error) {
+	logger := *w.logger
+	if len(p) == 0 || logger.Writer() == io.Discard {
+		return len(p), nil
+	}
+	return len(p), logger.Output(2, string(bytes.TrimSuffix(p, []byte{'\n'})))
+}
+
+// dropTime removes the time from the messages, as the log.Logger adds it already.
+func dropTime(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) == 0 && a.Key == slog.TimeKey {
+		return slog.Attr{}
+	}
+	return a
+}
+
+// rawMessage is for logging websocket messages, they are only turned into strings when logged.
+type rawMessage []byte
+
+func (m rawMessage) LogValue() slog.Value { return slog.StringValue(string(m)) }
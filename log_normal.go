@@ -1,6 +0,0 @@
-//go:build !debug
-
-package nostr
-
-func debugLogf(str string, args ...any) {
-}
@@ -0,0 +1,85 @@
+package nostr
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLogger(t *testing.T) {
+	priv, _ := makeKeyPair(t)
+	note := &Event{Kind: KindTextNote, CreatedAt: Now(), Content: "hello"}
+	note.Sign(priv)
+	store := newStoreServer(t, note)
+	defer store.Close()
+
+	buf := &syncBuffer{}
+	logger := slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	rl, err := RelayConnect(context.Background(), store.URL, WithLogger{logger})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer rl.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	sub, err := rl.Subscribe(ctx, Filters{{Kinds: []int{KindTextNote}}})
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	<-sub.Events
+	<-sub.EndOfStoredEvents
+	sub.Unsub()
+
+	output := buf.String()
+	for _, expected := range []string{
+		`level=DEBUG msg=sending relay=` + rl.URL + ` sub=` + sub.GetID() + ` message="[\"REQ\"`,
+		`level=DEBUG msg=received relay=` + rl.URL + ` message="[\"EOSE\"`,
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("missing %q in:\n%s", expected, output)
+		}
+	}
+
+	// the default logger only writes debug messages when asked to
+	defer InfoLogger.SetOutput(InfoLogger.Writer())
+	defer DebugLogger.SetOutput(DebugLogger.Writer())
+	info, debug := &bytes.Buffer{}, &bytes.Buffer{}
+	InfoLogger.SetOutput(info)
+	DebugLogger.SetOutput(debug)
+
+	defer LogLevel.Set(LogLevel.Level())
+	LogLevel.Set(slog.LevelInfo)
+	DefaultLogger.Debug("hidden")
+	DefaultLogger.Info("shown", "relay", "wss://x")
+	LogLevel.Set(slog.LevelDebug)
+	DefaultLogger.Debug("now shown")
+
+	if !strings.Contains(info.String(), "[go-nostr][info] ") || !strings.HasSuffix(info.String(), "level=INFO msg=shown relay=wss://x\n") {
+		t.Errorf("unexpected info output: %q", info.String())
+	}
+	if strings.Contains(debug.String(), "hidden") || !strings.Contains(debug.String(), "msg=\"now shown\"") {
+		t.Errorf("unexpected debug output: %q", debug.String())
+	}
+}
+
+type syncBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
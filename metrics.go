@@ -0,0 +1,306 @@
+package nostr
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics is an Observer that keeps counters and latency histograms for each relay and can write
+// them in the Prometheus text format, either with WritePrometheus or by serving them over HTTP:
+//
+//	metrics := nostr.NewMetrics()
+//	pool := nostr.NewSimplePool(ctx, nostr.WithObserver{metrics})
+//	http.Handle("/metrics", metrics)
+type Metrics struct {
+	mutex  sync.Mutex
+	relays map[string]*relayMetrics
+}
+
+// latencyBuckets are the upper bounds of the histogram buckets, in seconds.
+var latencyBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type relayMetrics struct {
+	connected     bool
+	connects      int64
+	connectErrors int64
+	disconnects   int64
+	bytesIn       int64
+	bytesOut      int64
+	messagesIn    map[string]int64
+	messagesOut   map[string]int64
+	published     map[string]*histogram // by result
+	eose          histogram
+	invalid       map[string]int64
+	dropped       map[string]int64
+}
+
+type histogram struct {
+	buckets []int64 // one for each of latencyBuckets, not cumulative
+	count   int64
+	sum     float64
+}
+
+func (h *histogram) observe(d time.Duration) {
+	if h.buckets == nil {
+		h.buckets = make([]int64, len(latencyBuckets))
+	}
+	seconds := d.Seconds()
+	if i, _ := slices.BinarySearch(latencyBuckets, seconds); i < len(latencyBuckets) {
+		h.buckets[i]++
+	}
+	h.count++
+	h.sum += seconds
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{relays: make(map[string]*relayMetrics)}
+}
+
+var _ Observer = (*Metrics)(nil)
+
+// relay must be called with the mutex held.
+func (m *Metrics) relay(url string) *relayMetrics {
+	rm, ok := m.relays[url]
+	if !ok {
+		rm = &relayMetrics{
+			messagesIn:  make(map[string]int64),
+			messagesOut: make(map[string]int64),
+			published:   make(map[string]*histogram),
+			invalid:     make(map[string]int64),
+			dropped:     make(map[string]int64),
+		}
+		m.relays[url] = rm
+	}
+	return rm
+}
+
+func (m *Metrics) OnConnect(url string, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	rm := m.relay(url)
+	if err != nil {
+		rm.connectErrors++
+		return
+	}
+	rm.connects++
+	rm.connected = true
+}
+
+func (m *Metrics) OnDisconnect(url string, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	rm := m.relay(url)
+	rm.disconnects++
+	rm.connected = false
+}
+
+func (m *Metrics) OnMessageIn(url string, label string, size int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	rm := m.relay(url)
+	rm.bytesIn += int64(size)
+	rm.messagesIn[label]++
+}
+
+func (m *Metrics) OnMessageOut(url string, label string, size int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	rm := m.relay(url)
+	rm.bytesOut += int64(size)
+	rm.messagesOut[label]++
+}
+
+func (m *Metrics) OnPublish(url string, latency time.Duration, err error) {
+	result := "accepted"
+	if err != nil {
+		result = "failed"
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	rm := m.relay(url)
+	h, ok := rm.published[result]
+	if !ok {
+		h = &histogram{}
+		rm.published[result] = h
+	}
+	h.observe(latency)
+}
+
+func (m *Metrics) OnEOSE(url string, subscriptionID string, elapsed time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.relay(url).eose.observe(elapsed)
+}
+
+func (m *Metrics) OnInvalidEvent(url string, reason RejectionReason) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.relay(url).invalid[string(reason)]++
+}
+
+func (m *Metrics) OnDroppedEvent(url string, reason string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.relay(url).dropped[reason]++
+}
+
+// WritePrometheus writes all the metrics in the Prometheus text exposition format.
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	urls := make([]string, 0, len(m.relays))
+	for url := range m.relays {
+		urls = append(urls, url)
+	}
+	slices.Sort(urls)
+
+	bw := bufio.NewWriter(w)
+	p := promWriter{w: bw}
+
+	p.header("nostr_relay_connected", "gauge", "Whether the relay is currently connected.")
+	for _, url := range urls {
+		connected := 0
+		if m.relays[url].connected {
+			connected = 1
+		}
+		p.sample("nostr_relay_connected", labels("relay", url), float64(connected))
+	}
+
+	p.header("nostr_relay_connections_total", "counter", "Connection attempts.")
+	for _, url := range urls {
+		rm := m.relays[url]
+		p.sample("nostr_relay_connections_total", labels("relay", url, "result", "ok"), float64(rm.connects))
+		p.sample("nostr_relay_connections_total", labels("relay", url, "result", "error"), float64(rm.connectErrors))
+	}
+
+	p.header("nostr_relay_disconnections_total", "counter", "Connections that were closed.")
+	for _, url := range urls {
+		p.sample("nostr_relay_disconnections_total", labels("relay", url), float64(m.relays[url].disconnects))
+	}
+
+	p.header("nostr_relay_received_bytes_total", "counter", "Bytes received in websocket messages.")
+	for _, url := range urls {
+		p.sample("nostr_relay_received_bytes_total", labels("relay", url), float64(m.relays[url].bytesIn))
+	}
+
+	p.header("nostr_relay_sent_bytes_total", "counter", "Bytes sent in websocket messages.")
+	for _, url := range urls {
+		p.sample("nostr_relay_sent_bytes_total", labels("relay", url), float64(m.relays[url].bytesOut))
+	}
+
+	p.header("nostr_relay_received_messages_total", "counter", "Messages received, by label.")
+	for _, url := range urls {
+		p.counters("nostr_relay_received_messages_total", url, "label", m.relays[url].messagesIn)
+	}
+
+	p.header("nostr_relay_sent_messages_total", "counter", "Messages sent, by label.")
+	for _, url := range urls {
+		p.counters("nostr_relay_sent_messages_total", url, "label", m.relays[url].messagesOut)
+	}
+
+	p.header("nostr_relay_publish_duration_seconds", "histogram", "Time from sending an EVENT until getting an OK or giving up.")
+	for _, url := range urls {
+		rm := m.relays[url]
+		for _, result := range sortedKeys(rm.published) {
+			p.histogram("nostr_relay_publish_duration_seconds", labels("relay", url, "result", result), rm.published[result])
+		}
+	}
+
+	p.header("nostr_relay_eose_duration_seconds", "histogram", "Time from sending a REQ until getting all the EOSEs.")
+	for _, url := range urls {
+		if rm := m.relays[url]; rm.eose.count > 0 {
+			p.histogram("nostr_relay_eose_duration_seconds", labels("relay", url), &rm.eose)
+		}
+	}
+
+	p.header("nostr_relay_invalid_events_total", "counter", "Events that failed verification, by reason.")
+	for _, url := range urls {
+		p.counters("nostr_relay_invalid_events_total", url, "reason", m.relays[url].invalid)
+	}
+
+	p.header("nostr_relay_dropped_events_total", "counter", "Events that were dropped, by reason.")
+	for _, url := range urls {
+		p.counters("nostr_relay_dropped_events_total", url, "reason", m.relays[url].dropped)
+	}
+
+	if p.err != nil {
+		return p.err
+	}
+	return bw.Flush()
+}
+
+// ServeHTTP serves the metrics for Prometheus to scrape.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WritePrometheus(w)
+}
+
+type promWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (p *promWriter) printf(format string, args ...any) {
+	if p.err == nil {
+		_, p.err = fmt.Fprintf(p.w, format, args...)
+	}
+}
+
+func (p *promWriter) header(name, typ, help string) {
+	p.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func (p *promWriter) sample(name string, labels string, value float64) {
+	p.printf("%s{%s} %s\n", name, labels, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+func (p *promWriter) counters(name string, url string, key string, counters map[string]int64) {
+	for _, k := range sortedKeys(counters) {
+		p.sample(name, labels("relay", url, key, k), float64(counters[k]))
+	}
+}
+
+func (p *promWriter) histogram(name string, labels string, h *histogram) {
+	cumulative := int64(0)
+	for i, le := range latencyBuckets {
+		if h.buckets != nil {
+			cumulative += h.buckets[i]
+		}
+		p.sample(name+"_bucket", labels+`,le="`+strconv.FormatFloat(le, 'g', -1, 64)+`"`, float64(cumulative))
+	}
+	p.sample(name+"_bucket", labels+`,le="+Inf"`, float64(h.count))
+	p.sample(name+"_sum", labels, h.sum)
+	p.sample(name+"_count", labels, float64(h.count))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels formats pairs of label names and values.
+func labels(pairs ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(pairs[i] + `="` + labelEscaper.Replace(pairs[i+1]) + `"`)
+	}
+	return b.String()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,62 @@
+package nostr
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	priv, _ := makeKeyPair(t)
+	events := make([]*Event, 3)
+	for i := range events {
+		events[i] = &Event{Kind: KindTextNote, CreatedAt: Now(), Content: strings.Repeat("x", i+1)}
+		if err := events[i].Sign(priv); err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+	}
+	events[1].Content = "forged"
+	events[2].Content = strings.Repeat("x", 1000)
+	events[2].Sign(priv)
+
+	store := newStoreServer(t, events...)
+	defer store.Close()
+
+	metrics := NewMetrics()
+	policy := NewValidationPolicy(MaxContentLength(100))
+	rl, err := RelayConnect(context.Background(), store.URL, WithObserver{metrics}, WithValidationPolicy{policy})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer rl.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if received, err := rl.QuerySync(ctx, Filter{Kinds: []int{KindTextNote}}); err != nil || len(received) != 1 {
+		t.Fatalf("query: %v %v", received, err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := metrics.WritePrometheus(buf); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	output := buf.String()
+	url := rl.URL
+	for _, line := range []string{
+		`nostr_relay_connected{relay="` + url + `"} 1`,
+		`nostr_relay_connections_total{relay="` + url + `",result="ok"} 1`,
+		`nostr_relay_received_messages_total{relay="` + url + `",label="EVENT"} 3`,
+		`nostr_relay_received_messages_total{relay="` + url + `",label="EOSE"} 1`,
+		`nostr_relay_sent_messages_total{relay="` + url + `",label="REQ"} 1`,
+		`nostr_relay_eose_duration_seconds_count{relay="` + url + `"} 1`,
+		`nostr_relay_invalid_events_total{relay="` + url + `",reason="id doesn't match the event"} 1`,
+		`nostr_relay_dropped_events_total{relay="` + url + `",reason="content longer than 100"} 1`,
+		`# TYPE nostr_relay_publish_duration_seconds histogram`,
+	} {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, output)
+		}
+	}
+}
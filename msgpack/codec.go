@@ -0,0 +1,310 @@
+package msgpack
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Subprotocol identifies Codec in the websocket handshake.
+const Subprotocol = "nostr.msgpack"
+
+// Codec sends envelopes as MessagePack in binary frames. Messages have exactly the structure of
+// their NIP-01 JSON versions, so they can be converted from and to JSON by any MessagePack
+// library. Give it to nostr.WithCodecs and it will only be used with relays that agree to it in
+// the handshake, the others get plain JSON.
+type Codec struct{}
+
+func (_ Codec) Subprotocol() string { return Subprotocol }
+func (_ Codec) Binary() bool        { return true }
+
+func (_ Codec) AppendEnvelope(dst []byte, env nostr.Envelope) ([]byte, error) {
+	switch v := env.(type) {
+	case *nostr.EventEnvelope:
+		if v.SubscriptionID != nil {
+			dst = appendString(appendArrayHeader(dst, 3), "EVENT")
+			dst = appendString(dst, *v.SubscriptionID)
+		} else {
+			dst = appendString(appendArrayHeader(dst, 2), "EVENT")
+		}
+		return appendEvent(dst, &v.Event), nil
+	case *nostr.ReqEnvelope:
+		dst = appendString(appendArrayHeader(dst, 2+len(v.Filters)), "REQ")
+		dst = appendString(dst, v.SubscriptionID)
+		return appendFilters(dst, v.Filters), nil
+	case *nostr.CountEnvelope:
+		if v.Count != nil {
+			dst = appendString(appendArrayHeader(dst, 3), "COUNT")
+			dst = appendString(dst, v.SubscriptionID)
+			dst = appendString(appendMapHeader(dst, 1), "count")
+			return appendInt(dst, *v.Count), nil
+		}
+		dst = appendString(appendArrayHeader(dst, 2+len(v.Filters)), "COUNT")
+		dst = appendString(dst, v.SubscriptionID)
+		return appendFilters(dst, v.Filters), nil
+	case *nostr.NoticeEnvelope:
+		return appendString(appendString(appendArrayHeader(dst, 2), "NOTICE"), string(*v)), nil
+	case *nostr.EOSEEnvelope:
+		return appendString(appendString(appendArrayHeader(dst, 2), "EOSE"), string(*v)), nil
+	case *nostr.CloseEnvelope:
+		return appendString(appendString(appendArrayHeader(dst, 2), "CLOSE"), string(*v)), nil
+	case *nostr.ClosedEnvelope:
+		dst = appendString(appendArrayHeader(dst, 3), "CLOSED")
+		dst = appendString(dst, v.SubscriptionID)
+		return appendString(dst, v.Reason), nil
+	case *nostr.OKEnvelope:
+		dst = appendString(appendArrayHeader(dst, 4), "OK")
+		dst = appendString(dst, v.EventID)
+		dst = appendBool(dst, v.OK)
+		return appendString(dst, v.Reason), nil
+	case *nostr.AuthEnvelope:
+		dst = appendString(appendArrayHeader(dst, 2), "AUTH")
+		if v.Challenge != nil {
+			return appendString(dst, *v.Challenge), nil
+		}
+		return appendEvent(dst, &v.Event), nil
+	default:
+		return dst, fmt.Errorf("unsupported envelope %T", env)
+	}
+}
+
+func (_ Codec) DecodeEnvelope(data []byte) (nostr.Envelope, error) {
+	r := &reader{data: data}
+	n := r.arrayLen()
+	if n < 2 {
+		r.fail("envelopes have at least 2 items")
+	}
+	label := r.string()
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	var env nostr.Envelope
+	switch label {
+	case "EVENT":
+		v := &nostr.EventEnvelope{}
+		switch n {
+		case 3:
+			id := r.string()
+			v.SubscriptionID = &id
+		case 2:
+		default:
+			r.fail("EVENT with %d items", n)
+		}
+		r.event(&v.Event)
+		env = v
+	case "REQ":
+		v := &nostr.ReqEnvelope{SubscriptionID: r.string()}
+		v.Filters = r.filters(n - 2)
+		env = v
+	case "COUNT":
+		v := &nostr.CountEnvelope{SubscriptionID: r.string()}
+		if n == 3 && isMap(r.peek()) && r.isCount() {
+			v.Count = r.countResult()
+		} else {
+			v.Filters = r.filters(n - 2)
+		}
+		env = v
+	case "NOTICE", "EOSE", "CLOSE":
+		if n != 2 {
+			r.fail("%s with %d items", label, n)
+		}
+		s := r.string()
+		switch label {
+		case "NOTICE":
+			env = (*nostr.NoticeEnvelope)(&s)
+		case "EOSE":
+			env = (*nostr.EOSEEnvelope)(&s)
+		case "CLOSE":
+			env = (*nostr.CloseEnvelope)(&s)
+		}
+	case "CLOSED":
+		if n != 3 {
+			r.fail("CLOSED with %d items", n)
+		}
+		env = &nostr.ClosedEnvelope{SubscriptionID: r.string(), Reason: r.string()}
+	case "OK":
+		if n != 4 {
+			r.fail("OK with %d items", n)
+		}
+		env = &nostr.OKEnvelope{EventID: r.string(), OK: r.bool(), Reason: r.string()}
+	case "AUTH":
+		if n != 2 {
+			r.fail("AUTH with %d items", n)
+		}
+		v := &nostr.AuthEnvelope{}
+		if isString(r.peek()) {
+			challenge := r.string()
+			v.Challenge = &challenge
+		} else {
+			r.event(&v.Event)
+		}
+		env = v
+	default:
+		r.fail("unknown label %q", label)
+	}
+
+	if r.err == nil && r.pos != len(data) {
+		r.fail("%d extra bytes", len(data)-r.pos)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return env, nil
+}
+
+var _ nostr.Codec = Codec{}
+
+func appendEvent(dst []byte, evt *nostr.Event) []byte {
+	dst = appendMapHeader(dst, 7)
+	dst = appendString(appendString(dst, "id"), evt.ID)
+	dst = appendString(appendString(dst, "pubkey"), evt.PubKey)
+	dst = appendInt(appendString(dst, "created_at"), int64(evt.CreatedAt))
+	dst = appendInt(appendString(dst, "kind"), int64(evt.Kind))
+	dst = appendArrayHeader(appendString(dst, "tags"), len(evt.Tags))
+	for _, tag := range evt.Tags {
+		dst = appendStrings(dst, tag)
+	}
+	dst = appendString(appendString(dst, "content"), evt.Content)
+	return appendString(appendString(dst, "sig"), evt.Sig)
+}
+
+// appendFilters writes the fields the same way as their JSON encoding, tags sorted by key so the
+// same filter is always encoded the same way.
+func appendFilters(dst []byte, filters nostr.Filters) []byte {
+	for _, filter := range filters {
+		keys := make([]string, 0, len(filter.Tags))
+		for key := range filter.Tags {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+
+		fields := len(keys)
+		for _, has := range []bool{
+			len(filter.IDs) > 0, len(filter.Kinds) > 0, len(filter.Authors) > 0,
+			filter.Since != nil, filter.Until != nil, filter.Limit != 0 || filter.LimitZero, filter.Search != "",
+		} {
+			if has {
+				fields++
+			}
+		}
+		dst = appendMapHeader(dst, fields)
+
+		if len(filter.IDs) > 0 {
+			dst = appendStrings(appendString(dst, "ids"), filter.IDs)
+		}
+		if len(filter.Kinds) > 0 {
+			dst = appendArrayHeader(appendString(dst, "kinds"), len(filter.Kinds))
+			for _, kind := range filter.Kinds {
+				dst = appendInt(dst, int64(kind))
+			}
+		}
+		if len(filter.Authors) > 0 {
+			dst = appendStrings(appendString(dst, "authors"), filter.Authors)
+		}
+		for _, key := range keys {
+			dst = appendStrings(appendString(dst, "#"+key), filter.Tags[key])
+		}
+		if filter.Since != nil {
+			dst = appendInt(appendString(dst, "since"), int64(*filter.Since))
+		}
+		if filter.Until != nil {
+			dst = appendInt(appendString(dst, "until"), int64(*filter.Until))
+		}
+		if filter.Limit != 0 || filter.LimitZero {
+			dst = appendInt(appendString(dst, "limit"), int64(filter.Limit))
+		}
+		if filter.Search != "" {
+			dst = appendString(appendString(dst, "search"), filter.Search)
+		}
+	}
+	return dst
+}
+
+func (r *reader) event(evt *nostr.Event) {
+	for n := r.mapLen(); n > 0 && r.err == nil; n-- {
+		switch key := r.string(); key {
+		case "id":
+			evt.ID = r.string()
+		case "pubkey":
+			evt.PubKey = r.string()
+		case "created_at":
+			evt.CreatedAt = nostr.Timestamp(r.int())
+		case "kind":
+			evt.Kind = int(r.int())
+		case "tags":
+			evt.Tags = make(nostr.Tags, r.arrayLen())
+			for i := range evt.Tags {
+				evt.Tags[i] = r.strings()
+			}
+		case "content":
+			evt.Content = r.string()
+		case "sig":
+			evt.Sig = r.string()
+		default:
+			r.skip()
+		}
+	}
+}
+
+func (r *reader) filters(n int) nostr.Filters {
+	if n < 1 {
+		r.fail("no filters")
+		return nil
+	}
+	filters := make(nostr.Filters, r.fits(uint64(n)))
+	for i := range filters {
+		filter := &filters[i]
+		for fields := r.mapLen(); fields > 0 && r.err == nil; fields-- {
+			switch key := r.string(); {
+			case key == "ids":
+				filter.IDs = r.strings()
+			case key == "kinds":
+				filter.Kinds = make([]int, r.arrayLen())
+				for k := range filter.Kinds {
+					filter.Kinds[k] = int(r.int())
+				}
+			case key == "authors":
+				filter.Authors = r.strings()
+			case key == "since":
+				since := nostr.Timestamp(r.int())
+				filter.Since = &since
+			case key == "until":
+				until := nostr.Timestamp(r.int())
+				filter.Until = &until
+			case key == "limit":
+				filter.Limit = int(r.int())
+				filter.LimitZero = filter.Limit == 0
+			case key == "search":
+				filter.Search = r.string()
+			case strings.HasPrefix(key, "#") && len(key) > 1:
+				if filter.Tags == nil {
+					filter.Tags = make(nostr.TagMap)
+				}
+				filter.Tags[key[1:]] = r.strings()
+			default:
+				r.skip()
+			}
+		}
+	}
+	return filters
+}
+
+// isCount checks if the map that comes next is the {"count": n} of a COUNT response.
+func (r *reader) isCount() bool {
+	look := *r
+	if look.mapLen() != 1 {
+		return false
+	}
+	return look.string() == "count" && look.err == nil
+}
+
+// countResult reads the {"count": n} of a COUNT response.
+func (r *reader) countResult() *int64 {
+	r.mapLen()
+	r.string()
+	count := r.int()
+	return &count
+}
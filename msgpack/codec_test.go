@@ -0,0 +1,205 @@
+package msgpack
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func testEvent(t *testing.T) nostr.Event {
+	evt := nostr.Event{
+		CreatedAt: 1700000000,
+		Kind:      1,
+		Tags:      nostr.Tags{{"e", "7fa56f5d6962ab1e3cd424e758c3002b8665f7b0d8dcee9fe9e288d7751abb88", "wss://relay.example.com"}, {"t", "msgpack"}},
+		Content:   "hello from a binary world, with some more text so this is longer than 32 bytes",
+	}
+	if err := evt.Sign(nostr.GeneratePrivateKey()); err != nil {
+		t.Fatalf("failed to sign: %s", err)
+	}
+	return evt
+}
+
+func TestCodec(t *testing.T) {
+	evt := testEvent(t)
+
+	subID := "sub"
+	challenge := "challenge"
+	since := nostr.Timestamp(1700000000)
+	count := int64(42)
+	filters := nostr.Filters{
+		{Kinds: []int{1, 30023}, Authors: []string{evt.PubKey}, Since: &since, Limit: 10},
+		{IDs: []string{evt.ID}, Tags: nostr.TagMap{"e": {evt.ID}, "t": {"a", "b"}}, Search: "x", LimitZero: true},
+	}
+	notice := nostr.NoticeEnvelope("hello")
+	eose := nostr.EOSEEnvelope(subID)
+	closeEnv := nostr.CloseEnvelope(subID)
+
+	codec := Codec{}
+	for _, env := range []nostr.Envelope{
+		&nostr.EventEnvelope{SubscriptionID: &subID, Event: evt},
+		&nostr.EventEnvelope{Event: evt},
+		&nostr.ReqEnvelope{SubscriptionID: subID, Filters: filters},
+		&nostr.CountEnvelope{SubscriptionID: subID, Filters: filters},
+		&nostr.CountEnvelope{SubscriptionID: subID, Count: &count},
+		&notice,
+		&eose,
+		&closeEnv,
+		&nostr.ClosedEnvelope{SubscriptionID: subID, Reason: "error: no"},
+		&nostr.OKEnvelope{EventID: evt.ID, OK: true, Reason: ""},
+		&nostr.AuthEnvelope{Challenge: &challenge},
+		&nostr.AuthEnvelope{Event: evt},
+	} {
+		data, err := codec.AppendEnvelope(nil, env)
+		if err != nil {
+			t.Fatalf("%s: failed to encode: %s", env.Label(), err)
+		}
+		decoded, err := codec.DecodeEnvelope(data)
+		if err != nil {
+			t.Fatalf("%s: failed to decode: %s", env.Label(), err)
+		}
+		if !reflect.DeepEqual(decoded, env) {
+			t.Errorf("%s: decoded differently:\n%s\n%s", env.Label(), decoded, env)
+		}
+
+		// truncated or with extra data must fail
+		if _, err := codec.DecodeEnvelope(data[:len(data)-1]); err == nil {
+			t.Errorf("%s: decoded truncated data", env.Label())
+		}
+		if _, err := codec.DecodeEnvelope(append(data, 0)); err == nil {
+			t.Errorf("%s: decoded data with extra bytes", env.Label())
+		}
+	}
+}
+
+func TestCodecWireFormat(t *testing.T) {
+	codec := Codec{}
+	for _, tc := range []struct {
+		env  nostr.Envelope
+		wire string
+	}{
+		{
+			// ["REQ", "s", {"kinds": [1], "limit": 0}]
+			&nostr.ReqEnvelope{SubscriptionID: "s", Filters: nostr.Filters{{Kinds: []int{1}, LimitZero: true}}},
+			"93a3524551a17382a56b696e64739101a56c696d697400",
+		},
+		{
+			// ["EOSE", "sub"]
+			ptr(nostr.EOSEEnvelope("sub")),
+			"92a4454f5345a3737562",
+		},
+		{
+			// ["OK", "ab", false, "no"]
+			&nostr.OKEnvelope{EventID: "ab", OK: false, Reason: "no"},
+			"94a24f4ba26162c2a26e6f",
+		},
+	} {
+		data, err := codec.AppendEnvelope(nil, tc.env)
+		if err != nil {
+			t.Fatalf("%s: failed to encode: %s", tc.env.Label(), err)
+		}
+		if hex.EncodeToString(data) != tc.wire {
+			t.Errorf("%s: encoded as %x, expected %s", tc.env.Label(), data, tc.wire)
+		}
+	}
+
+	// what another encoder could write for ["EVENT", {"content": "hi", "x": [nil], "created_at": 1.7e9, "kind": 1}]:
+	// keys in a different order, an unknown key, a float timestamp and a bin content
+	wire, _ := hex.DecodeString("92a54556454e5484a7636f6e74656e74c4026869a17891c0aa637265617465645f6174cb41d954fc40000000a46b696e6401")
+	env, err := codec.DecodeEnvelope(wire)
+	if err != nil {
+		t.Fatalf("failed to decode: %s", err)
+	}
+	evt := env.(*nostr.EventEnvelope).Event
+	if evt.Content != "hi" || evt.CreatedAt != 1700000000 || evt.Kind != 1 {
+		t.Errorf("decoded wrong event %v", evt)
+	}
+}
+
+func TestCodecMalformed(t *testing.T) {
+	codec := Codec{}
+	for _, wire := range []string{
+		"",
+		"91a4454f5345",               // ["EOSE"]
+		"92a3464f4fa3737562",         // ["FOO", "sub"]
+		"92a4454f534501",             // ["EOSE", 1]
+		"92a3524551a173",             // ["REQ", "s"]
+		"93a3524551a173dd7fffffff",   // ["REQ", "s", <array claiming 2^31 items>]
+		"94a24f4ba26162a474727565a0", // ["OK", "ab", "true", ""]
+	} {
+		data, _ := hex.DecodeString(wire)
+		if env, err := codec.DecodeEnvelope(data); err == nil {
+			t.Errorf("%s should have failed, got %v", wire, env)
+		}
+	}
+}
+
+func TestCodecRelay(t *testing.T) {
+	evt := testEvent(t)
+
+	codec := Codec{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgrader := ws.HTTPUpgrader{Protocol: func(p string) bool { return p == Subprotocol }}
+		conn, _, _, err := upgrader.Upgrade(r, w)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			data, op, err := wsutil.ReadClientData(conn)
+			if err != nil {
+				return
+			}
+			if op != ws.OpBinary {
+				t.Errorf("got a %v frame", op)
+				return
+			}
+			env, err := codec.DecodeEnvelope(data)
+			if err != nil {
+				t.Errorf("failed to decode: %s", err)
+				return
+			}
+			req, ok := env.(*nostr.ReqEnvelope)
+			if !ok {
+				continue
+			}
+			for _, reply := range []nostr.Envelope{
+				&nostr.EventEnvelope{SubscriptionID: &req.SubscriptionID, Event: evt},
+				(*nostr.EOSEEnvelope)(&req.SubscriptionID),
+			} {
+				data, _ := codec.AppendEnvelope(nil, reply)
+				wsutil.WriteServerMessage(conn, ws.OpBinary, data)
+			}
+		}
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	relay, err := nostr.RelayConnect(ctx, nostr.NormalizeURL(server.URL), nostr.WithCodecs{codec})
+	if err != nil {
+		t.Fatalf("failed to connect: %s", err)
+	}
+	defer relay.Close()
+	if relay.Connection.Codec() != codec {
+		t.Fatalf("codec wasn't negotiated")
+	}
+
+	events, err := relay.QuerySync(ctx, nostr.Filter{Kinds: []int{1}})
+	if err != nil {
+		t.Fatalf("failed to query: %s", err)
+	}
+	if len(events) != 1 || events[0].ID != evt.ID || !bytes.Equal([]byte(events[0].Content), []byte(evt.Content)) {
+		t.Fatalf("expected the event, got %v", events)
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
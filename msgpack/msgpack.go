@@ -0,0 +1,323 @@
+// Package msgpack has a Codec that sends the relay protocol messages as MessagePack, see the
+// README for how each of them is laid out.
+package msgpack
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrMalformed is returned when a message isn't valid MessagePack or doesn't have the layout of
+// any envelope.
+var ErrMalformed = errors.New("malformed message")
+
+func appendArrayHeader(dst []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(dst, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(dst, 0xdc), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(dst, 0xdd), uint32(n))
+	}
+}
+
+func appendMapHeader(dst []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(dst, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(dst, 0xde), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(dst, 0xdf), uint32(n))
+	}
+}
+
+func appendString(dst []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		dst = append(dst, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		dst = append(dst, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		dst = binary.BigEndian.AppendUint16(append(dst, 0xda), uint16(n))
+	default:
+		dst = binary.BigEndian.AppendUint32(append(dst, 0xdb), uint32(n))
+	}
+	return append(dst, s...)
+}
+
+func appendStrings(dst []byte, ss []string) []byte {
+	dst = appendArrayHeader(dst, len(ss))
+	for _, s := range ss {
+		dst = appendString(dst, s)
+	}
+	return dst
+}
+
+// appendInt uses the smallest encoding that fits v.
+func appendInt(dst []byte, v int64) []byte {
+	switch {
+	case v >= 0 && v < 128:
+		return append(dst, byte(v))
+	case v >= 0 && v <= math.MaxUint8:
+		return append(dst, 0xcc, byte(v))
+	case v >= 0 && v <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(dst, 0xcd), uint16(v))
+	case v >= 0 && v <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(dst, 0xce), uint32(v))
+	case v >= 0:
+		return binary.BigEndian.AppendUint64(append(dst, 0xcf), uint64(v))
+	case v >= -32:
+		return append(dst, byte(v))
+	case v >= math.MinInt8:
+		return append(dst, 0xd0, byte(v))
+	case v >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(dst, 0xd1), uint16(v))
+	case v >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(dst, 0xd2), uint32(v))
+	default:
+		return binary.BigEndian.AppendUint64(append(dst, 0xd3), uint64(v))
+	}
+}
+
+func appendBool(dst []byte, v bool) []byte {
+	if v {
+		return append(dst, 0xc3)
+	}
+	return append(dst, 0xc2)
+}
+
+// reader reads MessagePack values, after the first error it only returns zero values.
+type reader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *reader) fail(format string, args ...any) {
+	if r.err == nil {
+		r.err = fmt.Errorf("%w: "+format, append([]any{ErrMalformed}, args...)...)
+	}
+}
+
+// peek returns the type byte of the next value without reading it.
+func (r *reader) peek() byte {
+	if r.err != nil || r.pos >= len(r.data) {
+		r.fail("unexpected end")
+		return 0xc1 // never used
+	}
+	return r.data[r.pos]
+}
+
+func (r *reader) next() byte {
+	b := r.peek()
+	if r.err == nil {
+		r.pos++
+	}
+	return b
+}
+
+func (r *reader) take(n uint64) []byte {
+	if r.err != nil || n > uint64(len(r.data)-r.pos) {
+		r.fail("unexpected end")
+		return nil
+	}
+	b := r.data[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b
+}
+
+func (r *reader) uint(size int) uint64 {
+	b := r.take(uint64(size))
+	switch size {
+	case 1:
+		if len(b) == 1 {
+			return uint64(b[0])
+		}
+	case 2:
+		if len(b) == 2 {
+			return uint64(binary.BigEndian.Uint16(b))
+		}
+	case 4:
+		if len(b) == 4 {
+			return uint64(binary.BigEndian.Uint32(b))
+		}
+	case 8:
+		if len(b) == 8 {
+			return binary.BigEndian.Uint64(b)
+		}
+	}
+	return 0
+}
+
+// fits checks that n elements, each taking at least one byte, can fit in what is left, so
+// nothing huge is allocated for bogus lengths.
+func (r *reader) fits(n uint64) int {
+	if r.err == nil && n > uint64(len(r.data)-r.pos) {
+		r.fail("%d elements can't fit in the message", n)
+	}
+	if r.err != nil {
+		return 0
+	}
+	return int(n)
+}
+
+func (r *reader) arrayLen() int {
+	switch b := r.next(); {
+	case b&0xf0 == 0x90:
+		return r.fits(uint64(b & 0x0f))
+	case b == 0xdc:
+		return r.fits(r.uint(2))
+	case b == 0xdd:
+		return r.fits(r.uint(4))
+	default:
+		r.fail("expected an array, got 0x%x", b)
+		return 0
+	}
+}
+
+func (r *reader) mapLen() int {
+	switch b := r.next(); {
+	case b&0xf0 == 0x80:
+		return r.fits(uint64(b & 0x0f))
+	case b == 0xde:
+		return r.fits(r.uint(2))
+	case b == 0xdf:
+		return r.fits(r.uint(4))
+	default:
+		r.fail("expected a map, got 0x%x", b)
+		return 0
+	}
+}
+
+func isString(b byte) bool {
+	return b&0xe0 == 0xa0 || (b >= 0xd9 && b <= 0xdb) || (b >= 0xc4 && b <= 0xc6)
+}
+
+func isMap(b byte) bool {
+	return b&0xf0 == 0x80 || b == 0xde || b == 0xdf
+}
+
+// string reads a str, or a bin, which some encoders use for strings.
+func (r *reader) string() string {
+	switch b := r.next(); {
+	case b&0xe0 == 0xa0:
+		return string(r.take(uint64(b & 0x1f)))
+	case b == 0xd9 || b == 0xc4:
+		return string(r.take(r.uint(1)))
+	case b == 0xda || b == 0xc5:
+		return string(r.take(r.uint(2)))
+	case b == 0xdb || b == 0xc6:
+		return string(r.take(r.uint(4)))
+	default:
+		r.fail("expected a string, got 0x%x", b)
+		return ""
+	}
+}
+
+func (r *reader) strings() []string {
+	n := r.arrayLen()
+	if n == 0 {
+		return nil
+	}
+	ss := make([]string, n)
+	for i := range ss {
+		ss[i] = r.string()
+	}
+	return ss
+}
+
+// int reads any integer, or a float with an integer value, which some encoders use for numbers
+// that came from JSON.
+func (r *reader) int() int64 {
+	switch b := r.next(); {
+	case b < 0x80:
+		return int64(b)
+	case b >= 0xe0:
+		return int64(int8(b))
+	case b == 0xcc:
+		return int64(r.uint(1))
+	case b == 0xcd:
+		return int64(r.uint(2))
+	case b == 0xce:
+		return int64(r.uint(4))
+	case b == 0xcf:
+		v := r.uint(8)
+		if v > math.MaxInt64 {
+			r.fail("integer overflow")
+		}
+		return int64(v)
+	case b == 0xd0:
+		return int64(int8(r.uint(1)))
+	case b == 0xd1:
+		return int64(int16(r.uint(2)))
+	case b == 0xd2:
+		return int64(int32(r.uint(4)))
+	case b == 0xd3:
+		return int64(r.uint(8))
+	case b == 0xca || b == 0xcb:
+		var f float64
+		if b == 0xca {
+			f = float64(math.Float32frombits(uint32(r.uint(4))))
+		} else {
+			f = math.Float64frombits(r.uint(8))
+		}
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			r.fail("%v is not an integer", f)
+			return 0
+		}
+		return int64(f)
+	default:
+		r.fail("expected an integer, got 0x%x", b)
+		return 0
+	}
+}
+
+func (r *reader) bool() bool {
+	switch b := r.next(); b {
+	case 0xc3:
+		return true
+	case 0xc2:
+		return false
+	default:
+		r.fail("expected a boolean, got 0x%x", b)
+		return false
+	}
+}
+
+// skip reads a value of any type and throws it away.
+func (r *reader) skip() {
+	switch b := r.peek(); {
+	case r.err != nil:
+	case isString(b):
+		r.string()
+	case b < 0x80 || b >= 0xe0 || (b >= 0xcc && b <= 0xd3):
+		r.next()
+		if b >= 0xcc && b <= 0xd3 {
+			r.take(1 << ((b - 0xcc) % 4))
+		}
+	case b&0xf0 == 0x90 || b == 0xdc || b == 0xdd:
+		for n := r.arrayLen(); n > 0 && r.err == nil; n-- {
+			r.skip()
+		}
+	case isMap(b):
+		for n := r.mapLen(); n > 0 && r.err == nil; n-- {
+			r.skip()
+			r.skip()
+		}
+	case b == 0xc0 || b == 0xc2 || b == 0xc3:
+		r.next()
+	case b == 0xca:
+		r.next()
+		r.take(4)
+	case b == 0xcb:
+		r.next()
+		r.take(8)
+	default:
+		// ext types are never used in envelopes
+		r.fail("unexpected type 0x%x", b)
+	}
+}
@@ -53,3 +53,35 @@ func GetImmediateReply(tags nostr.Tags) *nostr.Tag {
 	// if we reached this point and we have at least one "e" we'll use that (the last)
 	return lastE
 }
+
+// ReplyTags returns the tags an event replying to parent must have: an "e" tag marked "root" and
+// another marked "reply" pointing to the parent (or just the "root" one when the parent is the root
+// itself) and "p" tags for the parent author and everybody that was already in the conversation.
+// relay is a hint of where the parent can be found, it can be empty.
+func ReplyTags(parent *nostr.Event, relay string) nostr.Tags {
+	tags := make(nostr.Tags, 0, 2+len(parent.Tags))
+
+	if GetImmediateReply(parent.Tags) == nil {
+		// parent is not replying to anything, so it is the root
+		tags = append(tags, nostr.Tag{"e", parent.ID, relay, "root", parent.PubKey})
+	} else {
+		root := *GetThreadRoot(parent.Tags)
+		rootTag := nostr.Tag{"e", root[1], "", "root"}
+		if len(root) >= 3 {
+			rootTag[2] = root[2]
+		}
+		if len(root) >= 5 {
+			rootTag = append(rootTag, root[4])
+		}
+		tags = append(tags, rootTag, nostr.Tag{"e", parent.ID, relay, "reply", parent.PubKey})
+	}
+
+	tags = append(tags, nostr.Tag{"p", parent.PubKey})
+	for _, tag := range parent.Tags {
+		if len(tag) >= 2 && tag[0] == "p" {
+			tags = tags.AppendUnique(nostr.Tag{"p", tag[1]})
+		}
+	}
+
+	return tags
+}
@@ -0,0 +1,107 @@
+package nip10
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryStore []*nostr.Event
+
+func (s memoryStore) Publish(ctx context.Context, event nostr.Event) error { return nil }
+
+func (s memoryStore) QuerySync(ctx context.Context, filter nostr.Filter, opts ...nostr.SubscriptionOption) ([]*nostr.Event, error) {
+	var results []*nostr.Event
+	for _, evt := range s {
+		if filter.Matches(evt) {
+			results = append(results, evt)
+		}
+	}
+	return results, nil
+}
+
+func makeEvent(id string, createdAt nostr.Timestamp, tags ...nostr.Tag) *nostr.Event {
+	return &nostr.Event{ID: id, PubKey: "pk-" + id, CreatedAt: createdAt, Kind: nostr.KindTextNote, Tags: tags}
+}
+
+func TestBuildThread(t *testing.T) {
+	root := makeEvent("r", 1)
+	a := makeEvent("a", 2, nostr.Tag{"e", "r", "", "root"})
+	b := makeEvent("b", 3, nostr.Tag{"e", "r", "", "root"}, nostr.Tag{"e", "a", "", "reply"}, nostr.Tag{"p", "pk-a"})
+	c := makeEvent("c", 4, nostr.Tag{"e", "r"}, nostr.Tag{"e", "b"}) // positional
+	d := makeEvent("d", 5, nostr.Tag{"e", "r", "", "root"}, nostr.Tag{"e", "x", "wss://hint.example.com", "reply"})
+	e := makeEvent("e", 1, nostr.Tag{"e", "r", "", "root"}) // older than a, so it comes first
+	other := makeEvent("o", 6, nostr.Tag{"e", "somewhere-else", "", "root"})
+
+	thread := BuildThread("r", []*nostr.Event{d, c, b, a, other, root, e, a})
+
+	structure := make([]string, 0, 8)
+	thread.Walk(func(node *Node, depth int) bool {
+		structure = append(structure, string(rune('0'+depth))+node.ID)
+		return true
+	})
+	require.Equal(t, []string{"0r", "1x", "2d", "1e", "1a", "2b", "3c"}, structure)
+
+	require.Nil(t, thread.Get("o"))
+	require.Nil(t, thread.Get("x").Event)
+	require.Equal(t, []string{"wss://hint.example.com"}, thread.Get("x").RelayHints)
+	require.Equal(t, []string{"x"}, thread.Missing())
+
+	require.Equal(t, nostr.Tags{
+		{"e", "r", "", "root"},
+		{"e", "b", "wss://relay.example.com", "reply", "pk-b"},
+		{"p", "pk-b"},
+		{"p", "pk-a"},
+	}, thread.Get("b").ReplyTags("wss://relay.example.com"))
+
+	require.Equal(t, nostr.Tags{
+		{"e", "r", "", "root", "pk-r"},
+		{"e", "x", "", "reply"},
+	}, thread.Get("x").ReplyTags(""))
+}
+
+func TestBuildThreadCycle(t *testing.T) {
+	a := makeEvent("a", 2, nostr.Tag{"e", "r", "", "root"}, nostr.Tag{"e", "b", "", "reply"})
+	b := makeEvent("b", 3, nostr.Tag{"e", "r", "", "root"}, nostr.Tag{"e", "a", "", "reply"})
+
+	thread := BuildThread("r", []*nostr.Event{a, b})
+	count := 0
+	thread.Walk(func(node *Node, depth int) bool {
+		count++
+		return true
+	})
+	require.Equal(t, 3, count)
+	require.Equal(t, []string{"r"}, thread.Missing())
+}
+
+func TestBuildThreadMention(t *testing.T) {
+	root := makeEvent("r", 1)
+	quote := makeEvent("q", 2, nostr.Tag{"e", "r", "", "mention"})
+	a := makeEvent("a", 3, nostr.Tag{"e", "r", "", "root"})
+
+	thread := BuildThread("r", []*nostr.Event{root, quote, a})
+	require.Nil(t, thread.Get("q"))
+	require.Equal(t, []*Node{thread.Get("a")}, thread.Root.Replies)
+}
+
+func TestFetchThread(t *testing.T) {
+	root := makeEvent("r", 1)
+	a := makeEvent("a", 2, nostr.Tag{"e", "r", "", "root"}, nostr.Tag{"e", "x", "wss://hint.example.com", "reply"})
+	x := makeEvent("x", 3, nostr.Tag{"e", "r", "", "root"})
+
+	store := memoryStore{root, a}
+	hinted := memoryStore{x}
+
+	var asked []string
+	thread, err := FetchThread(context.Background(), store, "r", func(url string) (nostr.RelayStore, error) {
+		asked = append(asked, url)
+		return hinted, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"wss://hint.example.com"}, asked)
+	require.Empty(t, thread.Missing())
+	require.Equal(t, x, thread.Get("x").Event)
+	require.Equal(t, thread.Get("x"), thread.Get("a").Parent)
+}
@@ -0,0 +1,258 @@
+package nip10
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Node is an event in a thread.
+type Node struct {
+	ID string
+
+	// Event is nil when we only know about this event because others are replying to it.
+	Event *nostr.Event
+
+	// Parent is nil for the root. Nodes whose parent is unknown (because their own event is
+	// missing) are put directly under the root.
+	Parent  *Node
+	Replies []*Node // oldest first
+
+	// RelayHints are the relays that replies to this say it can be found at.
+	RelayHints []string
+}
+
+// Thread is a tree of events built by BuildThread or FetchThread.
+type Thread struct {
+	Root  *Node
+	nodes map[string]*Node
+}
+
+// BuildThread arranges events in a tree under the event with rootID. Both marked and positional
+// (deprecated) "e" tags are understood. Events that are not part of the thread, including the
+// ones that only mention its events, are ignored.
+func BuildThread(rootID string, events []*nostr.Event) *Thread {
+	thread := &Thread{nodes: make(map[string]*Node, len(events)+1)}
+	thread.Root = thread.node(rootID)
+
+	inThread := make([]*Node, 0, len(events))
+	for _, evt := range events {
+		if evt.ID == rootID {
+			thread.Root.Event = evt
+			continue
+		}
+
+		root := GetThreadRoot(evt.Tags)
+		if root == nil || len(*root) < 2 || (*root)[1] != rootID {
+			continue
+		}
+		if reply := GetImmediateReply(evt.Tags); reply == nil || len(*reply) < 2 {
+			continue // only mentions the root, e.g. a quote
+		}
+
+		node := thread.node(evt.ID)
+		if node.Event != nil {
+			continue // duplicate
+		}
+		node.Event = evt
+		inThread = append(inThread, node)
+
+		for _, tag := range evt.Tags {
+			if len(tag) >= 3 && tag[0] == "e" && tag[2] != "" && nostr.IsValidRelayURL(tag[2]) {
+				hinted := thread.node(tag[1])
+				if !slices.Contains(hinted.RelayHints, tag[2]) {
+					hinted.RelayHints = append(hinted.RelayHints, tag[2])
+				}
+			}
+		}
+	}
+
+	referenced := make(map[*Node]struct{}, len(inThread))
+	for _, node := range inThread {
+		parentID := (*GetImmediateReply(node.Event.Tags))[1]
+		if parentID == node.ID {
+			continue
+		}
+		node.Parent = thread.node(parentID)
+		referenced[node.Parent] = struct{}{}
+	}
+
+	for _, node := range thread.nodes {
+		if _, isParent := referenced[node]; node == thread.Root || (node.Event == nil && !isParent) {
+			// the root or hinted events that aren't actually part of the thread
+			continue
+		}
+		if node.Parent == nil || thread.isCyclic(node) {
+			node.Parent = thread.Root
+		}
+		node.Parent.Replies = append(node.Parent.Replies, node)
+	}
+
+	for _, node := range thread.nodes {
+		slices.SortFunc(node.Replies, func(a, b *Node) int {
+			return cmp.Compare(a.createdAt(), b.createdAt())
+		})
+	}
+
+	return thread
+}
+
+// FetchThread queries store for the root event and all the replies to it and builds a thread.
+//
+// If forRelay is given it will be used to look for events that are missing from the thread in
+// the relays that replies to them have hinted at, on a best-effort basis. It can be something like
+//
+//	func(url string) (nostr.RelayStore, error) { return pool.EnsureRelay(url) }
+func FetchThread(
+	ctx context.Context,
+	store nostr.RelayStore,
+	rootID string,
+	forRelay func(url string) (nostr.RelayStore, error),
+) (*Thread, error) {
+	events, err := store.QuerySync(ctx, nostr.Filter{IDs: []string{rootID}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query root: %w", err)
+	}
+	replies, err := store.QuerySync(ctx, nostr.Filter{
+		Kinds: []int{nostr.KindTextNote},
+		Tags:  nostr.TagMap{"e": []string{rootID}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query replies: %w", err)
+	}
+	events = append(events, replies...)
+
+	thread := BuildThread(rootID, events)
+	missing := thread.Missing()
+	if len(missing) == 0 {
+		return thread, nil
+	}
+
+	// try to find the missing events in the store and then in the relays we were told about
+	found, err := store.QuerySync(ctx, nostr.Filter{IDs: missing})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query missing events: %w", err)
+	}
+
+	if forRelay != nil {
+		byRelay := make(map[string][]string)
+		for _, id := range missing {
+			if slices.ContainsFunc(found, func(evt *nostr.Event) bool { return evt.ID == id }) {
+				continue
+			}
+			for _, url := range thread.nodes[id].RelayHints {
+				byRelay[url] = append(byRelay[url], id)
+			}
+		}
+
+		for url, ids := range byRelay {
+			relay, err := forRelay(url)
+			if err != nil {
+				continue
+			}
+			res, _ := relay.QuerySync(ctx, nostr.Filter{IDs: ids})
+			found = append(found, res...)
+		}
+	}
+
+	for _, evt := range found {
+		if slices.Contains(missing, evt.ID) {
+			events = append(events, evt)
+		}
+	}
+	return BuildThread(rootID, events), nil
+}
+
+// Get returns the node for an event in the thread, or nil.
+func (t *Thread) Get(id string) *Node {
+	node := t.nodes[id]
+	if node == nil || (node != t.Root && node.Parent == nil) {
+		return nil
+	}
+	return node
+}
+
+// Missing returns the ids of the events that are in the thread but that we don't have.
+func (t *Thread) Missing() []string {
+	var missing []string
+	if t.Root.Event == nil {
+		missing = append(missing, t.Root.ID)
+	}
+	for id, node := range t.nodes {
+		if node.Event == nil && node.Parent != nil {
+			missing = append(missing, id)
+		}
+	}
+	return missing
+}
+
+// Walk calls fn for each node in the thread, depth first, starting at the root (depth 0).
+// If fn returns false the replies to that node are skipped.
+func (t *Thread) Walk(fn func(node *Node, depth int) bool) {
+	var walk func(node *Node, depth int)
+	walk = func(node *Node, depth int) {
+		if !fn(node, depth) {
+			return
+		}
+		for _, reply := range node.Replies {
+			walk(reply, depth+1)
+		}
+	}
+	walk(t.Root, 0)
+}
+
+// ReplyTags returns the tags for a new reply to this node, as in the ReplyTags function.
+// If the event for this node is missing only the "e" tags can be built.
+func (n *Node) ReplyTags(relay string) nostr.Tags {
+	if n.Event != nil {
+		return ReplyTags(n.Event, relay)
+	}
+
+	if n.Parent == nil {
+		return nostr.Tags{{"e", n.ID, relay, "root"}}
+	}
+
+	root := n.Parent
+	for root.Parent != nil {
+		root = root.Parent
+	}
+	rootTag := nostr.Tag{"e", root.ID, "", "root"}
+	if len(root.RelayHints) > 0 {
+		rootTag[2] = root.RelayHints[0]
+	}
+	if root.Event != nil {
+		rootTag = append(rootTag, root.Event.PubKey)
+	}
+	return nostr.Tags{rootTag, {"e", n.ID, relay, "reply"}}
+}
+
+func (t *Thread) node(id string) *Node {
+	node, ok := t.nodes[id]
+	if !ok {
+		node = &Node{ID: id}
+		t.nodes[id] = node
+	}
+	return node
+}
+
+// isCyclic checks if following the parents of node never gets us to the root.
+func (t *Thread) isCyclic(node *Node) bool {
+	seen := make(map[*Node]struct{})
+	for current := node; current != nil && current != t.Root; current = current.Parent {
+		if _, ok := seen[current]; ok {
+			return true
+		}
+		seen[current] = struct{}{}
+	}
+	return false
+}
+
+func (n *Node) createdAt() nostr.Timestamp {
+	if n.Event == nil {
+		return 0
+	}
+	return n.Event.CreatedAt
+}
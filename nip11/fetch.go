@@ -12,6 +12,12 @@ import (
 
 // Fetch fetches the NIP-11 RelayInformationDocument.
 func Fetch(ctx context.Context, u string) (info *RelayInformationDocument, err error) {
+	return FetchWithClient(ctx, http.DefaultClient, u)
+}
+
+// FetchWithClient is like Fetch, but makes the request with the given client, e.g. one from
+// nostr.WithNetDial.HTTPClient so it goes through the same proxy as the relay connection.
+func FetchWithClient(ctx context.Context, client *http.Client, u string) (info *RelayInformationDocument, err error) {
 	if _, ok := ctx.Deadline(); !ok {
 		// if no timeout is set, force it to 7 seconds
 		var cancel context.CancelFunc
@@ -29,7 +35,7 @@ func Fetch(ctx context.Context, u string) (info *RelayInformationDocument, err e
 	req.Header.Add("Accept", "application/nostr+json")
 
 	// send the request
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
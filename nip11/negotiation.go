@@ -0,0 +1,55 @@
+package nip11
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip13"
+)
+
+// CapabilityNegotiation returns an option for nostr.NewRelay or nostr.NewSimplePool that makes relays
+// fetch their NIP-11 document when connecting and respect the limitations announced there.
+//
+// sign is used to authenticate to relays that require it and to sign events again after NIP-13
+// proof-of-work is added to them, it can be nil if neither of these things should happen.
+func CapabilityNegotiation(sign func(event *nostr.Event) error) nostr.WithCapabilityNegotiation {
+	return nostr.WithCapabilityNegotiation{
+		FetchLimits: FetchLimits,
+		Sign:        sign,
+		GeneratePoW: generatePoW,
+	}
+}
+
+// FetchLimits fetches the NIP-11 document of a relay with the given client and returns the limits
+// it announces, or nil if it doesn't have any.
+func FetchLimits(ctx context.Context, url string, client *http.Client) (*nostr.RelayLimits, error) {
+	info, err := FetchWithClient(ctx, client, url)
+	if err != nil {
+		return nil, err
+	}
+	if info.Limitation == nil {
+		return nil, nil
+	}
+
+	return &nostr.RelayLimits{
+		MaxMessageLength: info.Limitation.MaxMessageLength,
+		MaxSubscriptions: info.Limitation.MaxSubscriptions,
+		MaxFilters:       info.Limitation.MaxFilters,
+		MaxLimit:         info.Limitation.MaxLimit,
+		MinPowDifficulty: info.Limitation.MinPowDifficulty,
+		AuthRequired:     info.Limitation.AuthRequired,
+	}, nil
+}
+
+func generatePoW(ctx context.Context, event *nostr.Event, difficulty int) error {
+	if nip13.Difficulty(event.ID) >= difficulty {
+		return nil
+	}
+
+	if _, err := nip13.DoWork(ctx, event, difficulty); err != nil {
+		return fmt.Errorf("difficulty %d: %w", difficulty, err)
+	}
+	return nil
+}
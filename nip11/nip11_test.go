@@ -2,7 +2,12 @@ package nip11
 
 import (
 	"context"
+	"net"
+	"net/http"
+	"path/filepath"
 	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
 )
 
 func TestAddSupportedNIP(t *testing.T) {
@@ -46,3 +51,33 @@ func TestFetch(t *testing.T) {
 		t.Errorf("failed to fetch without protocol")
 	}
 }
+
+func TestFetchLimitsThroughProxy(t *testing.T) {
+	// the relay is only reachable through this socket
+	socketPath := filepath.Join(t.TempDir(), "relay.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "relay.example.onion" || r.Header.Get("Accept") != "application/nostr+json" {
+			http.Error(w, "wrong request", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"name":"hidden","limitation":{"max_subscriptions":3,"auth_required":true}}`))
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	dial, err := nostr.DialProxy("unix://" + socketPath)
+	if err != nil {
+		t.Fatalf("proxy: %v", err)
+	}
+	limits, err := FetchLimits(context.Background(), "ws://relay.example.onion", dial.HTTPClient())
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if limits == nil || limits.MaxSubscriptions != 3 || !limits.AuthRequired {
+		t.Errorf("wrong limits: %+v", limits)
+	}
+}
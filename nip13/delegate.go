@@ -0,0 +1,148 @@
+package nip13
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	nostr "github.com/nbd-wtf/go-nostr"
+)
+
+var ErrBadCreatedAt = errors.New("nip13: proof of work has an unexpected created_at")
+
+// WorkRequest is sent to a proof of work provider so it can do the work on behalf of a client
+// that can't afford to. The event is an unsigned template: it must have everything that goes into
+// its id except for the "nonce" tag and created_at, which is what the provider sends back.
+type WorkRequest struct {
+	Event      nostr.Event `json:"event"`
+	Difficulty int         `json:"difficulty"`
+}
+
+// WorkResponse has what the client must add to its event: a ["nonce", <nonce>, <difficulty>] tag
+// at the end of its tags and the created_at.
+type WorkResponse struct {
+	Nonce     string          `json:"nonce"`
+	CreatedAt nostr.Timestamp `json:"created_at"`
+}
+
+// ApplyWork adds the work done by a provider to the event, committing to the requested difficulty,
+// and checks that the resulting id actually has it. After this the event is ready to be signed.
+// The event is not changed if the work is not valid.
+func ApplyWork(event *nostr.Event, difficulty int, resp WorkResponse) error {
+	if _, err := strconv.ParseUint(resp.Nonce, 10, 64); err != nil {
+		return fmt.Errorf("invalid nonce '%s'", resp.Nonce)
+	}
+
+	pow := *event
+	pow.Tags = append(event.Tags[:len(event.Tags):len(event.Tags)],
+		nostr.Tag{"nonce", resp.Nonce, strconv.Itoa(difficulty)})
+	pow.CreatedAt = resp.CreatedAt
+
+	if err := Check(pow.GetID(), difficulty); err != nil {
+		return err
+	}
+
+	*event = pow
+	return nil
+}
+
+// WorkProvider is an http.Handler that does proof of work for the WorkRequests it receives.
+type WorkProvider struct {
+	// MaxDifficulty is the highest difficulty that will be accepted, 0 means no limit.
+	MaxDifficulty int
+
+	// Timeout is how long we will work on each request, defaults to one minute.
+	Timeout time.Duration
+
+	// Workers is passed to DoWork, the default is to use all CPUs.
+	Workers int
+}
+
+func (p WorkProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req WorkRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Difficulty < 1 {
+		http.Error(w, "difficulty must be at least 1", http.StatusBadRequest)
+		return
+	}
+	if p.MaxDifficulty > 0 && req.Difficulty > p.MaxDifficulty {
+		http.Error(w, fmt.Sprintf("difficulty can't be higher than %d", p.MaxDifficulty), http.StatusBadRequest)
+		return
+	}
+
+	timeout := p.Timeout
+	if timeout == 0 {
+		timeout = time.Minute
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	pow, err := DoWork(ctx, &req.Event, req.Difficulty, WithWorkers(p.Workers))
+	if err != nil {
+		http.Error(w, "failed to do work: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(WorkResponse{
+		Nonce:     pow.Tags[len(pow.Tags)-1][1],
+		CreatedAt: pow.CreatedAt,
+	})
+}
+
+// RequestWork asks the provider at url to do proof of work on the unsigned event, then applies
+// the result to it and checks it. The event must be signed afterwards.
+func RequestWork(ctx context.Context, url string, event *nostr.Event, difficulty int) error {
+	if _, ok := ctx.Deadline(); !ok {
+		// if no timeout is set, give the provider a minute
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Minute)
+		defer cancel()
+	}
+
+	body, _ := json.Marshal(WorkRequest{Event: *event, Difficulty: difficulty})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid provider url '%s': %w", url, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	start := nostr.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("provider returned %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	var work WorkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&work); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+
+	// the work must have been done for this request, not taken from somewhere else
+	if work.CreatedAt < start-60 || work.CreatedAt > nostr.Now()+60 {
+		return ErrBadCreatedAt
+	}
+
+	return ApplyWork(event, difficulty, work)
+}
@@ -3,10 +3,10 @@
 package nip13
 
 import (
+	"context"
 	"encoding/hex"
 	"errors"
 	"math/bits"
-	"strconv"
 	"time"
 
 	nostr "github.com/nbd-wtf/go-nostr"
@@ -56,22 +56,26 @@ func Check(eventID string, minDifficulty int) error {
 //
 // Upon success, the returned event always contains a "nonce" tag with the target difficulty
 // commitment, and an updated event.CreatedAt.
+//
+// It is the same as DoWork, but with a timeout instead of a context.
 func Generate(event *nostr.Event, targetDifficulty int, timeout time.Duration) (*nostr.Event, error) {
-	tag := nostr.Tag{"nonce", "", strconv.Itoa(targetDifficulty)}
-	event.Tags = append(event.Tags, tag)
-	var nonce uint64
-	start := time.Now()
-	for {
-		nonce++
-		tag[1] = strconv.FormatUint(nonce, 10)
-		event.CreatedAt = nostr.Now()
-		if Difficulty(event.GetID()) >= targetDifficulty {
-			return event, nil
-		}
-		// benchmarks show one iteration is approx 3000ns on i7-8565U @ 1.8GHz.
-		// so, check every 3ms; arbitrary
-		if nonce%1000 == 0 && time.Since(start) > timeout {
-			return nil, ErrGenerateTimeout
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	pow, err := DoWork(ctx, event, targetDifficulty)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, ErrGenerateTimeout
+	}
+	return pow, err
+}
+
+// MinDifficultyValidator returns a nostr.Validator that drops events with less than the given
+// difficulty, to be used in a nostr.ValidationPolicy.
+func MinDifficultyValidator(minDifficulty int) nostr.Validator {
+	return func(evt *nostr.Event) string {
+		if Difficulty(evt.ID) < minDifficulty {
+			return "insufficient proof-of-work"
 		}
+		return ""
 	}
 }
@@ -1,9 +1,15 @@
 package nip13
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
 	"strconv"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -31,6 +37,19 @@ func TestCheck(t *testing.T) {
 	}
 }
 
+func TestMinDifficultyValidator(t *testing.T) {
+	policy := nostr.NewValidationPolicy(MinDifficultyValidator(36))
+	if reason := policy.Validate(&nostr.Event{ID: "000000000e9d97a1ab09fc381030b346cdd7a142ad57e6df0b46dc9bef6c7e2d"}); reason != "" {
+		t.Errorf("event with enough work was dropped: %s", reason)
+	}
+	if reason := policy.Validate(&nostr.Event{ID: "00000000fe9d97a1ab09fc381030b346cdd7a142ad57e6df0b46dc9bef6c7e2d"}); reason == "" {
+		t.Error("event with little work wasn't dropped")
+	}
+	if dropped := policy.Dropped(); dropped["insufficient proof-of-work"] != 1 {
+		t.Errorf("dropped counts are %v", dropped)
+	}
+}
+
 func TestGenerateShort(t *testing.T) {
 	event := &nostr.Event{
 		Kind:    nostr.KindTextNote,
@@ -108,6 +127,103 @@ func TestGenerateTimeout(t *testing.T) {
 	}
 }
 
+func TestDoWork(t *testing.T) {
+	event := &nostr.Event{
+		Kind:    nostr.KindTextNote,
+		Content: "It's just me mining my own \"business\"\n",
+		Tags:    nostr.Tags{{"t", "mining"}},
+		PubKey:  "a48380f4cfcc1ad5378294fcac36439770f9c878dd880ffa94bb74ea54a6f243",
+	}
+	pow, err := DoWork(context.Background(), event, 12, WithWorkers(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Check(pow.GetID(), 12); err != nil {
+		t.Errorf("the midstate hash doesn't match the event id: %v", err)
+	}
+	if len(pow.Tags) != 2 || pow.Tags[0][0] != "t" {
+		t.Errorf("existing tags should be kept: %v", pow.Tags)
+	}
+	testNonceTag(t, pow, 12)
+}
+
+func TestDoWorkCanceled(t *testing.T) {
+	event := &nostr.Event{
+		Kind:      nostr.KindTextNote,
+		Content:   "It's just me mining my own business",
+		PubKey:    "a48380f4cfcc1ad5378294fcac36439770f9c878dd880ffa94bb74ea54a6f243",
+		CreatedAt: 1,
+	}
+
+	var reports atomic.Int32
+	var last Progress
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+	_, err := DoWork(ctx, event, 256, WithProgress(func(p Progress) {
+		reports.Add(1)
+		last = p
+	}))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("DoWork returned %v; want context.DeadlineExceeded", err)
+	}
+	if len(event.Tags) != 0 || event.CreatedAt != 1 {
+		t.Errorf("event should be left untouched: %v", event)
+	}
+	if reports.Load() == 0 {
+		t.Fatal("progress was never reported")
+	}
+	if last.Hashes == 0 || last.Hashrate <= 0 || last.BestDifficulty == 0 {
+		t.Errorf("unexpected progress report: %+v", last)
+	}
+}
+
+func TestRequestWork(t *testing.T) {
+	provider := httptest.NewServer(WorkProvider{MaxDifficulty: 16})
+	defer provider.Close()
+
+	sk := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(sk)
+	event := &nostr.Event{
+		Kind:    nostr.KindTextNote,
+		Content: "someone else is mining my business",
+		PubKey:  pk,
+	}
+	if err := RequestWork(context.Background(), provider.URL, event, 10); err != nil {
+		t.Fatal(err)
+	}
+	testNonceTag(t, event, 10)
+	if err := event.Sign(sk); err != nil {
+		t.Fatal(err)
+	}
+	if err := Check(event.ID, 10); err != nil {
+		t.Error(err)
+	}
+
+	// above the provider limit
+	if err := RequestWork(context.Background(), provider.URL, event, 20); err == nil {
+		t.Error("provider should have refused to do that much work")
+	}
+}
+
+func TestRequestWorkBadProvider(t *testing.T) {
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(WorkResponse{Nonce: "1", CreatedAt: nostr.Now()})
+	}))
+	defer provider.Close()
+
+	event := &nostr.Event{
+		Kind:    nostr.KindTextNote,
+		Content: "It's just me mining my own business",
+		PubKey:  "a48380f4cfcc1ad5378294fcac36439770f9c878dd880ffa94bb74ea54a6f243",
+	}
+	if err := RequestWork(context.Background(), provider.URL, event, 20); !errors.Is(err, ErrDifficultyTooLow) {
+		t.Errorf("RequestWork returned %v; want ErrDifficultyTooLow", err)
+	}
+	if len(event.Tags) != 0 || event.CreatedAt != 0 {
+		t.Errorf("event shouldn't have been changed: %v", event)
+	}
+}
+
 func BenchmarkCheck(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		Check("000000000e9d97a1ab09fc381030b346cdd7a142ad57e6df0b46dc9bef6c7e2d", 36)
@@ -127,6 +243,23 @@ func BenchmarkGenerateOneIteration(b *testing.B) {
 	}
 }
 
+func BenchmarkDoWork(b *testing.B) {
+	for _, workers := range []int{1, runtime.NumCPU()} {
+		b.Run(fmt.Sprintf("%dworkers", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				event := &nostr.Event{
+					Kind:    nostr.KindTextNote,
+					Content: "It's just me mining my own business",
+					PubKey:  "a48380f4cfcc1ad5378294fcac36439770f9c878dd880ffa94bb74ea54a6f243",
+				}
+				if _, err := DoWork(context.Background(), event, 16, WithWorkers(workers)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
 func BenchmarkGenerate(b *testing.B) {
 	if testing.Short() {
 		b.Skip("too consuming for short mode")
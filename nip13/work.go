@@ -0,0 +1,202 @@
+package nip13
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"math/bits"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	nostr "github.com/nbd-wtf/go-nostr"
+)
+
+// how many nonces a worker takes at a time
+const nonceBatchSize = 1 << 12
+
+// Progress is what DoWork reports while it is running.
+type Progress struct {
+	Hashes         uint64        // how many nonces were tried so far
+	Elapsed        time.Duration // since the work started
+	Hashrate       float64       // hashes per second
+	BestDifficulty int           // the highest difficulty seen so far
+}
+
+// WorkOption changes how DoWork is performed, see WithWorkers and WithProgress.
+type WorkOption interface {
+	IsWorkOption()
+}
+
+// WithWorkers sets the number of goroutines mining in parallel, the default is runtime.NumCPU().
+type WithWorkers int
+
+func (_ WithWorkers) IsWorkOption() {}
+
+// WithProgress is called about once per second while the work is being done.
+type WithProgress func(Progress)
+
+func (_ WithProgress) IsWorkOption() {}
+
+var (
+	_ WorkOption = WithWorkers(0)
+	_ WorkOption = WithProgress(nil)
+)
+
+// DoWork performs proof of work on the specified event using multiple goroutines until the
+// target difficulty is reached or ctx is canceled, in which case ctx.Err() is returned and the
+// event is left as it was.
+//
+// The event is serialized only once with a "nonce" tag at the end of its tags and the SHA-256
+// state over everything that comes before the nonce value is reused for all attempts, so only
+// the nonce and what follows it (the commitment and the content) are hashed each time.
+//
+// Upon success the event contains the "nonce" tag with the target difficulty commitment and an
+// updated event.CreatedAt, but it must still be signed.
+func DoWork(ctx context.Context, event *nostr.Event, targetDifficulty int, opts ...WorkOption) (*nostr.Event, error) {
+	workers := runtime.NumCPU()
+	var progress func(Progress)
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case WithWorkers:
+			if o > 0 {
+				workers = int(o)
+			}
+		case WithProgress:
+			progress = o
+		}
+	}
+
+	tag := nostr.Tag{"nonce", "", strconv.Itoa(targetDifficulty)}
+	originalTags := event.Tags
+	originalCreatedAt := event.CreatedAt
+	event.Tags = append(event.Tags[:len(event.Tags):len(event.Tags)], tag)
+	event.CreatedAt = nostr.Now()
+
+	prefix, suffix := splitAtNonce(event, tag[2])
+	hasher := sha256.New()
+	hasher.Write(prefix)
+	midstate, _ := hasher.(encoding.BinaryMarshaler).MarshalBinary()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		nextNonce atomic.Uint64
+		hashes    atomic.Uint64
+		best      atomic.Int64
+		found     = make(chan uint64, 1)
+		wg        sync.WaitGroup
+	)
+
+	start := time.Now()
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+
+			h := sha256.New()
+			unmarshaler := h.(encoding.BinaryUnmarshaler)
+			buf := make([]byte, 0, 20)
+			sum := make([]byte, 0, sha256.Size)
+
+			for ctx.Err() == nil {
+				first := nextNonce.Add(nonceBatchSize) - nonceBatchSize + 1 // nonces start at 1
+				localBest := 0
+				for nonce := first; nonce < first+nonceBatchSize; nonce++ {
+					unmarshaler.UnmarshalBinary(midstate)
+					h.Write(strconv.AppendUint(buf[:0], nonce, 10))
+					h.Write(suffix)
+					sum = h.Sum(sum[:0])
+
+					difficulty := leadingZeroBits(sum)
+					if difficulty >= targetDifficulty {
+						select {
+						case found <- nonce:
+						default:
+						}
+						cancel()
+						return
+					}
+					if difficulty > localBest {
+						localBest = difficulty
+					}
+				}
+
+				hashes.Add(nonceBatchSize)
+				for {
+					current := best.Load()
+					if int64(localBest) <= current || best.CompareAndSwap(current, int64(localBest)) {
+						break
+					}
+				}
+			}
+		}()
+	}
+
+	progressDone := make(chan struct{})
+	if progress == nil {
+		close(progressDone)
+	} else {
+		go func() {
+			defer close(progressDone)
+			ticker := time.NewTicker(time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					elapsed := time.Since(start)
+					n := hashes.Load()
+					progress(Progress{
+						Hashes:         n,
+						Elapsed:        elapsed,
+						Hashrate:       float64(n) / elapsed.Seconds(),
+						BestDifficulty: int(best.Load()),
+					})
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	cancel()
+	<-progressDone // so we never report progress after returning
+
+	select {
+	case nonce := <-found:
+		tag[1] = strconv.FormatUint(nonce, 10)
+		return event, nil
+	default:
+		event.Tags = originalTags
+		event.CreatedAt = originalCreatedAt
+		return nil, ctx.Err()
+	}
+}
+
+// splitAtNonce serializes the event, which must have an empty "nonce" tag as its last tag, and
+// returns what comes before and after where the nonce value goes.
+func splitAtNonce(event *nostr.Event, commitment string) (prefix []byte, suffix []byte) {
+	full := event.Serialize()
+
+	// without the content the serialization ends in `","<commitment>"]],""]`
+	noContent := *event
+	noContent.Content = ""
+	prefixLen := len(noContent.Serialize()) - len(commitment) - 10
+
+	return full[:prefixLen], full[prefixLen:]
+}
+
+func leadingZeroBits(hash []byte) int {
+	zeros := 0
+	for _, b := range hash {
+		if b != 0 {
+			return zeros + bits.LeadingZeros8(b)
+		}
+		zeros += 8
+	}
+	return zeros
+}
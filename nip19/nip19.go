@@ -1,21 +1,33 @@
 package nip19
 
 import (
-	"bytes"
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
 
 	"github.com/btcsuite/btcd/btcutil/bech32"
 	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/internal/tlv"
+	"github.com/nbd-wtf/go-nostr/nip49"
 )
 
+// Decode decodes any NIP-19 code. The value will be a hex string for npub, nsec and note, a
+// nostr.ProfilePointer, nostr.EventPointer or nostr.EntityPointer for nprofile, nevent and naddr,
+// the relay URL string for nrelay and a nip49.EncryptedKey for ncryptsec.
 func Decode(bech32string string) (prefix string, value any, err error) {
 	prefix, bits5, err := bech32.DecodeNoLimit(bech32string)
 	if err != nil {
 		return "", nil, err
 	}
 
+	if prefix == "ncryptsec" {
+		encrypted, err := nip49.Parse(bech32string)
+		if err != nil {
+			return prefix, nil, err
+		}
+		return prefix, encrypted, nil
+	}
+
 	data, err := bech32.ConvertBits(bits5, 5, 8, false)
 	if err != nil {
 		return prefix, nil, fmt.Errorf("failed translating data into 8 bits: %s", err.Error())
@@ -84,11 +96,34 @@ func Decode(bech32string string) (prefix string, value any, err error) {
 				}
 				result.Author = hex.EncodeToString(v)
 			case TLVKind:
+				if len(v) != 4 {
+					return prefix, nil, fmt.Errorf("kind is not 4 bytes (%d)", len(v))
+				}
 				result.Kind = int(binary.BigEndian.Uint32(v))
 			default:
 				// ignore
 			}
 
+			curr = curr + 2 + len(v)
+		}
+	case "nrelay":
+		var url string
+		curr := 0
+		for {
+			t, v := readTLVEntry(data[curr:])
+			if v == nil {
+				// end here
+				if url == "" {
+					return prefix, nil, fmt.Errorf("no relay found for nrelay")
+				}
+
+				return prefix, url, nil
+			}
+
+			if t == TLVDefault {
+				url = string(v)
+			}
+
 			curr = curr + 2 + len(v)
 		}
 	case "naddr":
@@ -116,6 +151,9 @@ func Decode(bech32string string) (prefix string, value any, err error) {
 				}
 				result.PublicKey = hex.EncodeToString(v)
 			case TLVKind:
+				if len(v) != 4 {
+					return prefix, nil, fmt.Errorf("kind is not 4 bytes (%d)", len(v))
+				}
 				result.Kind = int(binary.BigEndian.Uint32(v))
 			default:
 				// ignore
@@ -128,6 +166,25 @@ func Decode(bech32string string) (prefix string, value any, err error) {
 	return prefix, data, fmt.Errorf("unknown tag %s", prefix)
 }
 
+// DecodeToPointer decodes an npub, nprofile, note, nevent or naddr into the matching pointer.
+func DecodeToPointer(code string) (nostr.Pointer, error) {
+	prefix, value, err := Decode(code)
+	if err != nil {
+		return nil, err
+	}
+
+	switch prefix {
+	case "npub":
+		return nostr.ProfilePointer{PublicKey: value.(string)}, nil
+	case "note":
+		return nostr.EventPointer{ID: value.(string)}, nil
+	case "nprofile", "nevent", "naddr":
+		return value.(nostr.Pointer), nil
+	}
+
+	return nil, fmt.Errorf("%s is not a pointer", prefix)
+}
+
 func EncodePrivateKey(privateKeyHex string) (string, error) {
 	b, err := hex.DecodeString(privateKeyHex)
 	if err != nil {
@@ -171,72 +228,75 @@ func EncodeNote(eventIDHex string) (string, error) {
 }
 
 func EncodeProfile(publicKeyHex string, relays []string) (string, error) {
-	buf := &bytes.Buffer{}
 	pubkey, err := hex.DecodeString(publicKeyHex)
 	if err != nil {
 		return "", fmt.Errorf("invalid pubkey '%s': %w", publicKeyHex, err)
 	}
-	writeTLVEntry(buf, TLVDefault, pubkey)
 
+	enc := &tlv.Encoder{}
+	enc.Write(TLVDefault, pubkey)
 	for _, url := range relays {
-		writeTLVEntry(buf, TLVRelay, []byte(url))
+		enc.Write(TLVRelay, []byte(url))
 	}
+	return enc.Bech32("nprofile")
+}
 
-	bits5, err := bech32.ConvertBits(buf.Bytes(), 8, 5, true)
-	if err != nil {
-		return "", fmt.Errorf("failed to convert bits: %w", err)
-	}
+func EncodeEvent(eventIDHex string, relays []string, author string) (string, error) {
+	return encodeEvent(eventIDHex, relays, author, 0)
+}
 
-	return bech32.Encode("nprofile", bits5)
+// EncodePointer encodes a pointer as an nprofile, nevent or naddr. Unlike EncodeEvent, the
+// nevent will include the kind if the EventPointer has it.
+func EncodePointer(pointer nostr.Pointer) (string, error) {
+	switch p := pointer.(type) {
+	case nostr.ProfilePointer:
+		return EncodeProfile(p.PublicKey, p.Relays)
+	case nostr.EventPointer:
+		return encodeEvent(p.ID, p.Relays, p.Author, p.Kind)
+	case nostr.EntityPointer:
+		return EncodeEntity(p.PublicKey, p.Kind, p.Identifier, p.Relays)
+	}
+	return "", fmt.Errorf("unknown pointer type %T", pointer)
 }
 
-func EncodeEvent(eventIDHex string, relays []string, author string) (string, error) {
-	buf := &bytes.Buffer{}
+func encodeEvent(eventIDHex string, relays []string, author string, kind int) (string, error) {
 	id, err := hex.DecodeString(eventIDHex)
 	if err != nil || len(id) != 32 {
 		return "", fmt.Errorf("invalid id '%s': %w", eventIDHex, err)
 	}
-	writeTLVEntry(buf, TLVDefault, id)
 
+	enc := &tlv.Encoder{}
+	enc.Write(TLVDefault, id)
 	for _, url := range relays {
-		writeTLVEntry(buf, TLVRelay, []byte(url))
+		enc.Write(TLVRelay, []byte(url))
 	}
-
 	if pubkey, _ := hex.DecodeString(author); len(pubkey) == 32 {
-		writeTLVEntry(buf, TLVAuthor, pubkey)
+		enc.Write(TLVAuthor, pubkey)
 	}
-
-	bits5, err := bech32.ConvertBits(buf.Bytes(), 8, 5, true)
-	if err != nil {
-		return "", fmt.Errorf("failed to convert bits: %w", err)
+	if kind != 0 {
+		enc.Write(TLVKind, binary.BigEndian.AppendUint32(nil, uint32(kind)))
 	}
-
-	return bech32.Encode("nevent", bits5)
+	return enc.Bech32("nevent")
 }
 
 func EncodeEntity(publicKey string, kind int, identifier string, relays []string) (string, error) {
-	buf := &bytes.Buffer{}
-
-	writeTLVEntry(buf, TLVDefault, []byte(identifier))
-
-	for _, url := range relays {
-		writeTLVEntry(buf, TLVRelay, []byte(url))
-	}
-
 	pubkey, err := hex.DecodeString(publicKey)
 	if err != nil {
 		return "", fmt.Errorf("invalid pubkey '%s': %w", pubkey, err)
 	}
-	writeTLVEntry(buf, TLVAuthor, pubkey)
-
-	kindBytes := make([]byte, 4)
-	binary.BigEndian.PutUint32(kindBytes, uint32(kind))
-	writeTLVEntry(buf, TLVKind, kindBytes)
 
-	bits5, err := bech32.ConvertBits(buf.Bytes(), 8, 5, true)
-	if err != nil {
-		return "", fmt.Errorf("failed to convert bits: %w", err)
+	enc := &tlv.Encoder{}
+	enc.Write(TLVDefault, []byte(identifier))
+	for _, url := range relays {
+		enc.Write(TLVRelay, []byte(url))
 	}
+	enc.Write(TLVAuthor, pubkey)
+	enc.Write(TLVKind, binary.BigEndian.AppendUint32(nil, uint32(kind)))
+	return enc.Bech32("naddr")
+}
 
-	return bech32.Encode("naddr", bits5)
+func EncodeRelay(url string) (string, error) {
+	enc := &tlv.Encoder{}
+	enc.Write(TLVDefault, []byte(url))
+	return enc.Bech32("nrelay")
 }
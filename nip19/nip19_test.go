@@ -1,9 +1,12 @@
 package nip19
 
 import (
+	"encoding/hex"
+	"strings"
 	"testing"
 
 	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip49"
 )
 
 func TestEncodeNpub(t *testing.T) {
@@ -206,3 +209,114 @@ func TestEncodeDecodeNEventTestEncodeDecodeNEvent(t *testing.T) {
 		t.Error("wrong relay")
 	}
 }
+
+func TestEncodeDecodeNEventWithKind(t *testing.T) {
+	original := nostr.EventPointer{
+		ID:     "45326f5d6962ab1e3cd424e758c3002b8665f7b0d8dcee9fe9e288d7751ac194",
+		Relays: []string{"wss://banana.com"},
+		Author: "7fa56f5d6962ab1e3cd424e758c3002b8665f7b0d8dcee9fe9e288d7751abb88",
+		Kind:   30023,
+	}
+	nevent, err := EncodePointer(original)
+	if err != nil {
+		t.Fatalf("shouldn't error: %s", err)
+	}
+
+	pointer, err := DecodeToPointer(nevent)
+	if err != nil {
+		t.Fatalf("shouldn't error: %s", err)
+	}
+	ep, ok := pointer.(nostr.EventPointer)
+	if !ok {
+		t.Fatalf("'%s' should be an nevent, not %v", nevent, pointer)
+	}
+	if ep.Kind != 30023 || ep.ID != original.ID || ep.Author != original.Author {
+		t.Errorf("wrong pointer: %v", ep)
+	}
+
+	// without a kind the result is the same as before
+	withoutKind, _ := EncodeEvent(original.ID, original.Relays, original.Author)
+	original.Kind = 0
+	if nevent, _ := EncodePointer(original); nevent != withoutKind {
+		t.Errorf("%s != %s", nevent, withoutKind)
+	}
+}
+
+func TestEncodeDecodeNRelay(t *testing.T) {
+	nrelay, err := EncodeRelay("wss://relay.nostr.example")
+	if err != nil {
+		t.Fatalf("shouldn't error: %s", err)
+	}
+	prefix, url, err := Decode(nrelay)
+	if err != nil || prefix != "nrelay" || url != "wss://relay.nostr.example" {
+		t.Errorf("failed to decode nrelay: %s %v %s", prefix, url, err)
+	}
+
+	// from NIP-19
+	_, url, err = Decode("nrelay1qqt8wumn8ghj7un9d3shjtnwdaehgu3wvfskueq4r295t")
+	if err != nil || url != "wss://relay.nostr.band" {
+		t.Errorf("failed to decode nrelay: %v %s", url, err)
+	}
+	if _, err := DecodeToPointer(nrelay); err == nil {
+		t.Error("nrelay is not a pointer")
+	}
+}
+
+func TestDecodeNcryptsec(t *testing.T) {
+	code := "ncryptsec1qgg9947rlpvqu76pj5ecreduf9jxhselq2nae2kghhvd5g7dgjtcxfqtd67p9m0w57lspw8gsq6yphnm8623nsl8xn9j4jdzz84zm3frztj3z7s35vpzmqf6ksu8r89qk5z2zxfmu5gv8th8wclt0h4p"
+	prefix, value, err := Decode(code)
+	if err != nil || prefix != "ncryptsec" {
+		t.Fatalf("failed to decode ncryptsec: %s %s", prefix, err)
+	}
+	encrypted, ok := value.(nip49.EncryptedKey)
+	if !ok {
+		t.Fatalf("should be a nip49.EncryptedKey, not %T", value)
+	}
+	if encrypted.LogN != 16 {
+		t.Errorf("wrong log_n: %d", encrypted.LogN)
+	}
+	sk, err := encrypted.Decrypt("nostr")
+	if err != nil || hex.EncodeToString(sk) != "3501454135014541350145413501453fefb02227e449e57cf4d3a3ce05378683" {
+		t.Errorf("failed to decrypt: %x %s", sk, err)
+	}
+}
+
+func TestPointerAsNIP19(t *testing.T) {
+	pubkey := "7fa56f5d6962ab1e3cd424e758c3002b8665f7b0d8dcee9fe9e288d7751abb88"
+	for _, pointer := range []nostr.Pointer{
+		nostr.ProfilePointer{PublicKey: pubkey, Relays: []string{"wss://banana.com"}},
+		nostr.EventPointer{ID: "45326f5d6962ab1e3cd424e758c3002b8665f7b0d8dcee9fe9e288d7751ac194", Author: pubkey, Kind: 1},
+		nostr.EntityPointer{PublicKey: pubkey, Kind: 30023, Identifier: "banana", Relays: []string{"wss://banana.com"}},
+	} {
+		code, err := EncodePointer(pointer)
+		if err != nil {
+			t.Fatalf("shouldn't error: %s", err)
+		}
+		if pointer.AsNIP19() != code {
+			t.Errorf("%v encoded as %s, expected %s", pointer, pointer.AsNIP19(), code)
+		}
+		if pointer.AsURI() != "nostr:"+code {
+			t.Errorf("wrong uri %s", pointer.AsURI())
+		}
+		decoded, err := DecodeToPointer(code)
+		if err != nil || decoded.AsTagReference() != pointer.AsTagReference() {
+			t.Errorf("failed to decode %s: %v %s", code, decoded, err)
+		}
+	}
+
+	if (nostr.ProfilePointer{PublicKey: "invalid"}).AsNIP19() != "" {
+		t.Error("invalid pubkeys can't be encoded")
+	}
+
+	// TLV values can't have more than 255 bytes
+	long := nostr.EntityPointer{PublicKey: pubkey, Kind: 30023, Identifier: strings.Repeat("a", 256)}
+	if _, err := EncodePointer(long); err == nil {
+		t.Error("a 256 bytes identifier shouldn't be encoded")
+	}
+	if long.AsNIP19() != "" {
+		t.Error("a 256 bytes identifier shouldn't be encoded")
+	}
+	if _, err := EncodeProfile(pubkey, []string{"wss://" + strings.Repeat("a", 250) + ".com"}); err == nil {
+		t.Error("a relay URL with more than 255 bytes shouldn't be encoded")
+	}
+}
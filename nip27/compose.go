@@ -0,0 +1,78 @@
+package nip27
+
+import (
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip10"
+)
+
+// Compose prepares content written by a user to be published: every entity mentioned in it,
+// either as a nostr: URI, as a bare NIP-19 code or as an @npub handle, is turned into a nostr: URI,
+// and the tags for them are appended to tags (unless they're there already):
+//
+//   - "p" for profiles;
+//   - "q" for events, plus "p" for their author when known;
+//   - "a" for addressable events, plus "p" for their author.
+//
+// Relay hints are taken from the entities.
+func Compose(content string, tags nostr.Tags) (string, nostr.Tags) {
+	segments := Parse(content, tags)
+
+	result := strings.Builder{}
+	result.Grow(len(content) + 16)
+
+	for i, segment := range segments {
+		if segment.Type != SegmentEntity {
+			text := segment.Text
+			if i+1 < len(segments) && isBareEntity(segments[i+1]) {
+				// @npub1... handles become nostr:npub1..., but "@nostr:npub1..." is left alone
+				text = strings.TrimSuffix(text, "@")
+			}
+			result.WriteString(text)
+			continue
+		}
+
+		result.WriteString("nostr:")
+		result.WriteString(segment.Value)
+
+		switch pointer := segment.Pointer.(type) {
+		case nostr.ProfilePointer:
+			tags = tags.AppendUnique(pointer.AsTag())
+		case nostr.EventPointer:
+			tags = tags.AppendUnique(withRelayHint(nostr.Tag{"q", pointer.ID}, pointer.Relays))
+			if pointer.Author != "" {
+				tags = tags.AppendUnique(nostr.Tag{"p", pointer.Author})
+			}
+		case nostr.EntityPointer:
+			tags = tags.AppendUnique(pointer.AsTag())
+			tags = tags.AppendUnique(nostr.Tag{"p", pointer.PublicKey})
+		}
+	}
+
+	return result.String(), tags
+}
+
+// Reply creates an unsigned kind 1 reply to parent, with the NIP-10 "e" and "p" tags and the
+// content composed as in Compose. relay is a hint of where the parent can be found.
+func Reply(parent *nostr.Event, relay string, content string) nostr.Event {
+	content, tags := Compose(content, nip10.ReplyTags(parent, relay))
+	return nostr.Event{
+		Kind:      nostr.KindTextNote,
+		CreatedAt: nostr.Now(),
+		Content:   content,
+		Tags:      tags,
+	}
+}
+
+// isBareEntity tells if segment is an entity written as a NIP-19 code, without "nostr:".
+func isBareEntity(segment Segment) bool {
+	return segment.Type == SegmentEntity && !strings.EqualFold(segment.Text[:min(len(segment.Text), 6)], "nostr:")
+}
+
+func withRelayHint(tag nostr.Tag, relays []string) nostr.Tag {
+	if len(relays) > 0 {
+		return append(tag, relays[0])
+	}
+	return tag
+}
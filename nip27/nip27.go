@@ -0,0 +1,224 @@
+// Package nip27 finds references to other entities (and other things worth rendering differently,
+// like URLs, hashtags and invoices) inside event content and builds content and tags that mention them.
+// See https://github.com/nostr-protocol/nips/blob/master/27.md and https://github.com/nostr-protocol/nips/blob/master/21.md.
+package nip27
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+type SegmentType int
+
+const (
+	SegmentText         SegmentType = iota
+	SegmentURL                      // Value is the URL
+	SegmentHashtag                  // Value is the hashtag without the "#"
+	SegmentEntity                   // Value is the bech32 entity, without "nostr:", and Pointer is set
+	SegmentTagReference             // legacy #[n], Value is n and Tag is the tag, if it exists
+	SegmentEmoji                    // NIP-30 :shortcode:, Value is the shortcode and Tag is the "emoji" tag
+	SegmentInvoice                  // Value is the lightning invoice without "lightning:"
+)
+
+func (t SegmentType) String() string {
+	switch t {
+	case SegmentText:
+		return "text"
+	case SegmentURL:
+		return "url"
+	case SegmentHashtag:
+		return "hashtag"
+	case SegmentEntity:
+		return "entity"
+	case SegmentTagReference:
+		return "tag-reference"
+	case SegmentEmoji:
+		return "emoji"
+	case SegmentInvoice:
+		return "invoice"
+	}
+	return "unknown"
+}
+
+// Segment is a piece of content. Joining the Text of all the segments returned by Parse gives
+// back the original content.
+type Segment struct {
+	Type SegmentType
+	Text string // exactly as it appears in the content
+
+	Value string
+
+	// Pointer is a nostr.ProfilePointer (for npub and nprofile), a nostr.EventPointer (for note
+	// and nevent) or a nostr.EntityPointer (for naddr).
+	Pointer nostr.Pointer
+
+	Tag *nostr.Tag
+}
+
+var contentRegex = regexp.MustCompile(
+	`(?i:nostr:(?:npub|nprofile|note|nevent|naddr)1[02-9ac-hj-np-z]+)` + // NIP-21 URI
+		`|https?://[^\s<>"]+` + // URL
+		`|(?i:(?:lightning:)?ln(?:bc|tb|tbs|bcrt)[0-9]*[munp]?1[02-9ac-hj-np-z]+)` + // invoice
+		`|(?:npub|nprofile|note|nevent|naddr)1[02-9ac-hj-np-z]+` + // bare entity
+		`|#\[\d+\]` + // legacy tag reference
+		`|#[\p{L}\p{N}_]+` + // hashtag
+		`|:[a-zA-Z0-9_]+:`, // emoji shortcode
+)
+
+// Parse splits content in segments. tags are the tags of the event the content belongs to, they
+// are used to resolve legacy #[n] references and custom emojis (which are only recognized when
+// there is a matching "emoji" tag), and can be nil.
+//
+// Anything that looks like an entity or an invoice but can't be decoded is kept as text, and so
+// are nsec entities.
+func Parse(content string, tags nostr.Tags) []Segment {
+	segments := make([]Segment, 0, 1)
+	addText := func(text string) {
+		if text == "" {
+			return
+		}
+		if last := len(segments) - 1; last >= 0 && segments[last].Type == SegmentText {
+			segments[last].Text += text
+			return
+		}
+		segments = append(segments, Segment{Type: SegmentText, Text: text})
+	}
+
+	prev := 0 // where the text we haven't added yet starts
+	pos := 0  // where we'll search next
+	for pos < len(content) {
+		loc := contentRegex.FindStringIndex(content[pos:])
+		if loc == nil {
+			break
+		}
+		start, end := pos+loc[0], pos+loc[1]
+
+		segment, size, ok := parseMatch(content[:start], content[start:end], tags)
+		if !ok {
+			// something else may start right after this
+			_, width := utf8.DecodeRuneInString(content[start:])
+			pos = start + width
+			continue
+		}
+
+		addText(content[prev:start])
+		segment.Text = content[start : start+size]
+		segments = append(segments, segment)
+		prev = start + size
+		pos = prev
+	}
+	addText(content[prev:])
+
+	return segments
+}
+
+func parseMatch(before string, match string, tags nostr.Tags) (segment Segment, size int, ok bool) {
+	lower := strings.ToLower(match)
+	switch {
+	case strings.HasPrefix(lower, "nostr:"):
+		code := lower[6:]
+		pointer, ok := decodeEntity(code)
+		if !ok {
+			return segment, 0, false
+		}
+		return Segment{Type: SegmentEntity, Value: code, Pointer: pointer}, len(match), true
+
+	case strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://"):
+		url := trimURL(match)
+		if len(url) <= len("https://") {
+			return segment, 0, false
+		}
+		return Segment{Type: SegmentURL, Value: url}, len(url), true
+
+	case strings.HasPrefix(lower, "lightning:") || strings.HasPrefix(lower, "ln"):
+		if !atWordStart(before) {
+			return segment, 0, false
+		}
+		invoice := strings.TrimPrefix(lower, "lightning:")
+		if strings.HasPrefix(invoice, "lnbc") || strings.HasPrefix(invoice, "lntb") {
+			return Segment{Type: SegmentInvoice, Value: invoice}, len(match), true
+		}
+		return segment, 0, false
+
+	case strings.HasPrefix(match, "#["):
+		index, err := strconv.Atoi(match[2 : len(match)-1])
+		if err != nil {
+			return segment, 0, false
+		}
+		segment = Segment{Type: SegmentTagReference, Value: strconv.Itoa(index)}
+		if index < len(tags) {
+			segment.Tag = &tags[index]
+		}
+		return segment, len(match), true
+
+	case strings.HasPrefix(match, "#"):
+		if !atWordStart(before) {
+			return segment, 0, false
+		}
+		return Segment{Type: SegmentHashtag, Value: match[1:]}, len(match), true
+
+	case strings.HasPrefix(match, ":"):
+		shortcode := match[1 : len(match)-1]
+		for i, tag := range tags {
+			if len(tag) >= 3 && tag[0] == "emoji" && tag[1] == shortcode {
+				return Segment{Type: SegmentEmoji, Value: shortcode, Tag: &tags[i]}, len(match), true
+			}
+		}
+		return segment, 0, false
+
+	default:
+		// bare entity, it must not be glued to a previous word
+		if !atWordStart(before) {
+			return segment, 0, false
+		}
+		pointer, ok := decodeEntity(match)
+		if !ok {
+			return segment, 0, false
+		}
+		return Segment{Type: SegmentEntity, Value: match, Pointer: pointer}, len(match), true
+	}
+}
+
+// decodeEntity decodes a NIP-19 code into one of the pointer types.
+func decodeEntity(code string) (nostr.Pointer, bool) {
+	pointer, err := nip19.DecodeToPointer(code)
+	return pointer, err == nil
+}
+
+// trimURL removes trailing punctuation that is most likely not part of the URL.
+func trimURL(url string) string {
+	for len(url) > 0 {
+		last := url[len(url)-1]
+		switch last {
+		case '.', ',', ';', ':', '!', '?', '\'', '"', '*':
+			url = url[:len(url)-1]
+			continue
+		case ')':
+			if strings.Count(url, "(") < strings.Count(url, ")") {
+				url = url[:len(url)-1]
+				continue
+			}
+		case ']':
+			if strings.Count(url, "[") < strings.Count(url, "]") {
+				url = url[:len(url)-1]
+				continue
+			}
+		}
+		break
+	}
+	return url
+}
+
+func atWordStart(before string) bool {
+	if before == "" {
+		return true
+	}
+	r, _ := utf8.DecodeLastRuneInString(before)
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '/'
+}
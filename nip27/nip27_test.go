@@ -0,0 +1,124 @@
+package nip27
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testPubkey  = "3bf0c63fcb93463407af97a5e5ee64fa883d107ef9e558472c4eb9aaaefa459d"
+	testEventID = "d09b4c5da59be3cd2768aa53fa78b77bf4859084c94f3bf965d7e0ef6f82f556"
+	testInvoice = "lnbc2500u1pvjluezpp5qqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqypqdq5xysxxatsyp3k7enxv4jsxqzpuaztrnwngzn3kdzw5hydlzf03qdgm2hdq27cqv3agm2awhz5se903vruatfhq77w3ls4evs3ch9zw97j25emudupq63nyw24cg27h2rspfj9srp"
+)
+
+func TestParse(t *testing.T) {
+	npub, _ := nip19.EncodePublicKey(testPubkey)
+	nevent, _ := nip19.EncodeEvent(testEventID, []string{"wss://relay.example.com"}, testPubkey)
+	naddr, _ := nip19.EncodeEntity(testPubkey, 30023, "article", nil)
+	nsec, _ := nip19.EncodePrivateKey(testEventID)
+
+	tags := nostr.Tags{
+		{"p", testPubkey},
+		{"emoji", "soapbox", "https://example.com/soapbox.png"},
+	}
+	content := "gm nostr:" + npub + "! see https://example.com/a_(b).html, #Nostr and #[0] :soapbox: at 10:30: " +
+		"pay lightning:" + testInvoice + "\n" + nevent + " (" + naddr + ") a#b " + nsec
+
+	segments := Parse(content, tags)
+
+	var joined strings.Builder
+	for _, segment := range segments {
+		joined.WriteString(segment.Text)
+	}
+	require.Equal(t, content, joined.String())
+
+	types := make([]SegmentType, 0, len(segments))
+	for _, segment := range segments {
+		if segment.Type != SegmentText {
+			types = append(types, segment.Type)
+		}
+	}
+	require.Equal(t, []SegmentType{
+		SegmentEntity, SegmentURL, SegmentHashtag, SegmentTagReference, SegmentEmoji,
+		SegmentInvoice, SegmentEntity, SegmentEntity,
+	}, types)
+
+	require.Equal(t, "gm ", segments[0].Text)
+	require.Equal(t, nostr.ProfilePointer{PublicKey: testPubkey}, segments[1].Pointer)
+	require.Equal(t, "nostr:"+npub, segments[1].Text)
+	require.Equal(t, "https://example.com/a_(b).html", segments[3].Value)
+	require.Equal(t, "Nostr", segments[5].Value)
+	require.Equal(t, &tags[0], segments[7].Tag)
+	require.Equal(t, "soapbox", segments[9].Value)
+	require.Equal(t, "https://example.com/soapbox.png", (*segments[9].Tag)[2])
+	require.Equal(t, " at 10:30: pay ", segments[10].Text)
+	require.Equal(t, testInvoice, segments[11].Value)
+	require.Equal(t, nostr.EventPointer{
+		ID:     testEventID,
+		Relays: []string{"wss://relay.example.com"},
+		Author: testPubkey,
+	}, segments[13].Pointer)
+	require.Equal(t, nostr.EntityPointer{PublicKey: testPubkey, Kind: 30023, Identifier: "article"}, segments[15].Pointer)
+	require.Equal(t, ") a#b "+nsec, segments[16].Text)
+}
+
+func TestParseInvalidEntity(t *testing.T) {
+	npub, _ := nip19.EncodePublicKey(testPubkey)
+	broken := npub[:len(npub)-1] + "q"
+
+	segments := Parse("hello nostr:"+broken+" there", nil)
+	require.Len(t, segments, 1)
+	require.Equal(t, SegmentText, segments[0].Type)
+
+	// without a matching emoji tag shortcodes are just text
+	segments = Parse(":soapbox:", nil)
+	require.Len(t, segments, 1)
+	require.Equal(t, SegmentText, segments[0].Type)
+}
+
+func TestCompose(t *testing.T) {
+	npub, _ := nip19.EncodePublicKey(testPubkey)
+	nprofile, _ := nip19.EncodeProfile(testPubkey, []string{"wss://relay.example.com"})
+	nevent, _ := nip19.EncodeEvent(testEventID, []string{"wss://relay.example.com"}, testPubkey)
+	naddr, _ := nip19.EncodeEntity(testPubkey, 30023, "article", nil)
+
+	content, tags := Compose("hey @"+npub+" and nostr:"+nprofile+", look: "+nevent+" "+naddr+" (email me@example.com)", nil)
+	require.Equal(t, "hey nostr:"+npub+" and nostr:"+nprofile+", look: nostr:"+nevent+" nostr:"+naddr+" (email me@example.com)", content)
+	require.Equal(t, nostr.Tags{
+		{"p", testPubkey},
+		{"q", testEventID, "wss://relay.example.com"},
+		{"a", "30023:" + testPubkey + ":article"},
+	}, tags)
+
+	// an @ before an explicit nostr: URI isn't part of a handle
+	content, _ = Compose("cc @nostr:"+npub+" and @"+npub, nil)
+	require.Equal(t, "cc @nostr:"+npub+" and nostr:"+npub, content)
+}
+
+func TestReply(t *testing.T) {
+	other := "e8ed3798c6ffebffa08501ac39e271662bfd160f688f94c45d692d8767dd345a"
+
+	root := &nostr.Event{ID: testEventID, PubKey: testPubkey, Kind: nostr.KindTextNote}
+	reply := Reply(root, "wss://relay.example.com", "yes")
+	require.Equal(t, nostr.Tags{
+		{"e", testEventID, "wss://relay.example.com", "root", testPubkey},
+		{"p", testPubkey},
+	}, reply.Tags)
+
+	// now reply to the reply, mentioning someone else
+	reply.ID = "aa5b4a3bd1ac7d0d7a8a39e7e4cdb8ec4b51d0e2b9ba0d8fef5ac1bd17bd9c10"
+	reply.PubKey = other
+	npub, _ := nip19.EncodePublicKey(testPubkey)
+	second := Reply(&reply, "", "no, @"+npub)
+	require.Equal(t, "no, nostr:"+npub, second.Content)
+	require.Equal(t, nostr.Tags{
+		{"e", testEventID, "wss://relay.example.com", "root", testPubkey},
+		{"e", reply.ID, "", "reply", other},
+		{"p", other},
+		{"p", testPubkey},
+	}, second.Tags)
+}
@@ -1169,3 +1169,20 @@ func TestMessageKeyGeneration033(t *testing.T) {
 		"47b89da97f68d389867b5d8a2d7ba55715a30e3d88a3cc11f3646bc2af5580ef",
 	)
 }
+
+func TestEncryptWithRandomSalt(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(sk)
+	conversationKey, err := GenerateConversationKey(pk, sk)
+	assert.NoError(t, err)
+
+	ciphertext1, err := Encrypt("hello", conversationKey)
+	assert.NoError(t, err)
+	ciphertext2, err := Encrypt("hello", conversationKey)
+	assert.NoError(t, err)
+	assert.NotEqual(t, ciphertext1, ciphertext2, "salt should be random")
+
+	plaintext, err := Decrypt(ciphertext1, conversationKey)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", plaintext)
+}
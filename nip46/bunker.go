@@ -0,0 +1,253 @@
+package nip46
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/puzpuzpuz/xsync/v3"
+)
+
+const handledRequestsDropTick = 5 * time.Minute
+
+// SessionManager is implemented by signers that keep their sessions in a SessionStore, like
+// StaticKeySigner and DynamicSigner. A Bunker uses it to remember which connect secrets were
+// already used.
+type SessionManager interface {
+	GetSessionStore() SessionStore
+}
+
+// RequestPreviewer is implemented by signers that can read a request without acting on it and
+// answer it with an error instead, like StaticKeySigner and DynamicSigner. A Bunker needs it to
+// check requests before they are handed to the signer.
+type RequestPreviewer interface {
+	PreviewRequest(event *nostr.Event) (Request, error)
+	RefuseRequest(event *nostr.Event, req Request, reason error) (eventResponse nostr.Event, err error)
+}
+
+var (
+	_ SessionManager   = (*StaticKeySigner)(nil)
+	_ SessionManager   = (*DynamicSigner)(nil)
+	_ RequestPreviewer = (*StaticKeySigner)(nil)
+	_ RequestPreviewer = (*DynamicSigner)(nil)
+)
+
+// Bunker listens for NIP-46 requests on a set of relays, hands them to a Signer and publishes
+// the responses back to the same relays, reconnecting to relays when they go away.
+type Bunker struct {
+	Signer Signer
+	Relays []string
+	Pool   *nostr.SimplePool
+
+	// PublicKeys are the keys this bunker answers for, requests are filtered by their "p" tag.
+	// If empty every kind 24133 event seen on the relays is given to the signer, which is what a
+	// DynamicSigner serving many keys usually wants.
+	PublicKeys []string
+
+	// OnRequest is called after a request is handled and its response was published, useful for logging.
+	OnRequest func(from string, req Request, resp Response)
+
+	// OnError is called when a request can't be handled or a response can't be published.
+	OnError func(err error)
+
+	// ApproveRequest, if set, is called for each request before the signer gets it. Rejected
+	// requests are answered with an error and the signer never sees them. It requires a signer
+	// that implements RequestPreviewer.
+	ApproveRequest func(from string, req Request) bool
+
+	usedSecrets *xsync.MapOf[string, string] // connect secret -> client pubkey that used it
+	handled     *xsync.MapOf[string, nostr.Timestamp]
+}
+
+// Run subscribes to the relays and handles requests until ctx is canceled.
+func (b *Bunker) Run(ctx context.Context) error {
+	if b.Signer == nil {
+		return fmt.Errorf("bunker must have a signer")
+	}
+	if len(b.Relays) == 0 {
+		return fmt.Errorf("bunker must have at least one relay")
+	}
+	if _, ok := b.Signer.(RequestPreviewer); !ok && b.ApproveRequest != nil {
+		return fmt.Errorf("bunker signer must implement RequestPreviewer for ApproveRequest to work")
+	}
+	if b.Pool == nil {
+		b.Pool = nostr.NewSimplePool(ctx)
+	}
+
+	b.usedSecrets = xsync.NewMapOf[string, string]()
+	b.handled = xsync.NewMapOf[string, nostr.Timestamp]()
+
+	// secrets used in previous runs are still spent
+	if sm, ok := b.Signer.(SessionManager); ok {
+		store := sm.GetSessionStore()
+		if flusher, ok := store.(interface{ Flush() error }); ok {
+			// activity that was kept in memory is written when we stop
+			defer flusher.Flush()
+		}
+
+		sessions, err := store.ListSessions()
+		if err != nil {
+			return fmt.Errorf("failed to load sessions: %w", err)
+		}
+		for _, session := range sessions {
+			if session.ConnectSecret != "" {
+				b.usedSecrets.Store(session.ConnectSecret, session.ClientPubKey)
+			}
+		}
+	}
+
+	now := nostr.Now()
+	filter := nostr.Filter{
+		Kinds:     []int{nostr.KindNostrConnect},
+		Since:     &now,
+		LimitZero: true,
+	}
+	if len(b.PublicKeys) > 0 {
+		filter.Tags = nostr.TagMap{"p": b.PublicKeys}
+	}
+
+	ticker := time.NewTicker(handledRequestsDropTick)
+	defer ticker.Stop()
+
+	// SubMany normalizes the URLs in place, so give it its own slice
+	events := b.Pool.SubMany(ctx, slices.Clone(b.Relays), nostr.Filters{filter})
+	for {
+		select {
+		case ie, more := <-events:
+			if !more {
+				return ctx.Err()
+			}
+			if _, seen := b.handled.LoadOrStore(ie.ID, ie.CreatedAt); seen {
+				continue
+			}
+			b.handleRequest(ctx, ie.Event)
+		case <-ticker.C:
+			old := nostr.Timestamp(time.Now().Add(-handledRequestsDropTick).Unix())
+			b.handled.Range(func(id string, value nostr.Timestamp) bool {
+				if value < old {
+					b.handled.Delete(id)
+				}
+				return true
+			})
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (b *Bunker) handleRequest(ctx context.Context, event *nostr.Event) {
+	// look at the request before the signer does anything with it, when possible
+	if previewer, ok := b.Signer.(RequestPreviewer); ok {
+		req, err := previewer.PreviewRequest(event)
+		if err != nil {
+			b.reportError(fmt.Errorf("failed to read request %s from %s: %w", event.ID, event.PubKey, err))
+			return
+		}
+
+		if secret := connectSecret(req); secret != "" {
+			if user, used := b.usedSecrets.Load(secret); used && user != event.PubKey {
+				b.reportError(fmt.Errorf("client %s tried to reuse a connect secret", event.PubKey))
+				b.refuse(ctx, previewer, event, req, fmt.Errorf("connect secret already used"))
+				return
+			}
+		}
+
+		if b.ApproveRequest != nil && !b.ApproveRequest(event.PubKey, req) {
+			b.refuse(ctx, previewer, event, req, fmt.Errorf("request rejected"))
+			return
+		}
+	}
+
+	req, resp, eventResponse, err := b.Signer.HandleRequest(event)
+	if err != nil {
+		b.reportError(fmt.Errorf("failed to handle request %s from %s: %w", event.ID, event.PubKey, err))
+		return
+	}
+
+	if secret := connectSecret(req); secret != "" && resp.Error == "" {
+		// a connect secret can only be used by one client, signers that can't be previewed
+		// have already made a session for the second one by now, so it is dropped
+		if user, loaded := b.usedSecrets.LoadOrStore(secret, event.PubKey); loaded && user != event.PubKey {
+			b.dropSession(event.PubKey)
+			b.reportError(fmt.Errorf("client %s tried to reuse a connect secret", event.PubKey))
+			return
+		}
+	}
+
+	if err := b.publish(ctx, eventResponse); err != nil {
+		b.reportError(fmt.Errorf("failed to publish response to %s: %w", event.PubKey, err))
+		return
+	}
+
+	if b.OnRequest != nil {
+		b.OnRequest(event.PubKey, req, resp)
+	}
+}
+
+// refuse answers a request with an error without handing it to the signer.
+func (b *Bunker) refuse(ctx context.Context, previewer RequestPreviewer, event *nostr.Event, req Request, reason error) {
+	eventResponse, err := previewer.RefuseRequest(event, req, reason)
+	if err != nil {
+		b.reportError(fmt.Errorf("failed to refuse request %s from %s: %w", event.ID, event.PubKey, err))
+		return
+	}
+	if err := b.publish(ctx, eventResponse); err != nil {
+		b.reportError(fmt.Errorf("failed to publish refusal to %s: %w", event.PubKey, err))
+	}
+}
+
+// connectSecret is the secret given in a "connect" request, if any.
+func connectSecret(req Request) string {
+	if req.Method == "connect" && len(req.Params) >= 2 {
+		return req.Params[1]
+	}
+	return ""
+}
+
+// publish sends the response to all relays, it only fails if no relay accepted it.
+func (b *Bunker) publish(ctx context.Context, event nostr.Event) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	errs := make([]error, len(b.Relays))
+	wg := sync.WaitGroup{}
+	wg.Add(len(b.Relays))
+	for i, url := range b.Relays {
+		go func(i int, url string) {
+			defer wg.Done()
+
+			relay, err := b.Pool.EnsureRelay(url)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			errs[i] = relay.Publish(ctx, event)
+		}(i, url)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err == nil {
+			return nil
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (b *Bunker) dropSession(clientPubkey string) {
+	if sm, ok := b.Signer.(SessionManager); ok {
+		if err := sm.GetSessionStore().DeleteSession(clientPubkey); err != nil {
+			b.reportError(fmt.Errorf("failed to delete session for %s: %w", clientPubkey, err))
+		}
+	}
+}
+
+func (b *Bunker) reportError(err error) {
+	if b.OnError != nil {
+		b.OnError(err)
+	}
+}
@@ -0,0 +1,193 @@
+package nip46
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/internal/testrelay"
+	"github.com/nbd-wtf/go-nostr/nip04"
+)
+
+func TestBunkerRun(t *testing.T) {
+	relay := testrelay.New()
+	defer relay.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	bunkerSecretKey := nostr.GeneratePrivateKey()
+	bunkerPublicKey, _ := nostr.GetPublicKey(bunkerSecretKey)
+	signer := NewStaticKeySigner(bunkerSecretKey)
+
+	var mu sync.Mutex
+	var methods []string
+	bunker := &Bunker{
+		Signer:     &signer,
+		Relays:     []string{relay.URL},
+		Pool:       nostr.NewSimplePool(ctx),
+		PublicKeys: []string{bunkerPublicKey},
+		OnRequest: func(from string, req Request, resp Response) {
+			mu.Lock()
+			methods = append(methods, req.Method)
+			mu.Unlock()
+		},
+		OnError: func(err error) { t.Errorf("bunker error: %s", err) },
+	}
+	go bunker.Run(ctx)
+	time.Sleep(100 * time.Millisecond) // give it time to subscribe
+
+	client := NewBunker(ctx, nostr.GeneratePrivateKey(), bunkerPublicKey, []string{relay.URL}, nil, nil)
+	time.Sleep(100 * time.Millisecond)
+
+	if _, err := client.RPC(ctx, "connect", []string{bunkerPublicKey, "xyz"}); err != nil {
+		t.Fatalf("connect failed: %s", err)
+	}
+	pubkey, err := client.GetPublicKey(ctx)
+	if err != nil || pubkey != bunkerPublicKey {
+		t.Fatalf("got wrong public key %s: %v", pubkey, err)
+	}
+
+	// OnRequest is called after the response is published, so it may not have happened yet
+	waitUntil(func() bool { mu.Lock(); defer mu.Unlock(); return len(methods) >= 2 })
+	mu.Lock()
+	defer mu.Unlock()
+	if len(methods) != 2 || methods[0] != "connect" || methods[1] != "get_public_key" {
+		t.Fatalf("unexpected requests handled: %v", methods)
+	}
+}
+
+func TestBunkerConnectSecretIsUsedOnce(t *testing.T) {
+	relay := testrelay.New()
+	defer relay.Close()
+
+	bunkerSecretKey := nostr.GeneratePrivateKey()
+	bunkerPublicKey, _ := nostr.GetPublicKey(bunkerSecretKey)
+	signer := NewStaticKeySigner(bunkerSecretKey)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var errs []error
+	bunker := &Bunker{
+		Signer:  &signer,
+		Relays:  []string{relay.URL},
+		Pool:    nostr.NewSimplePool(ctx),
+		OnError: func(err error) { errs = append(errs, err) },
+	}
+	stopped, stop := context.WithCancel(ctx)
+	stop()
+	bunker.Run(stopped) // this just initializes everything
+
+	first := nostr.GeneratePrivateKey()
+	firstPublicKey, _ := nostr.GetPublicKey(first)
+	bunker.handleRequest(ctx, makeTestRequest(t, first, bunkerPublicKey, "connect", bunkerPublicKey, "xyz"))
+	if len(errs) != 0 {
+		t.Fatalf("first connect shouldn't have failed: %v", errs)
+	}
+	if user, _ := bunker.usedSecrets.Load("xyz"); user != firstPublicKey {
+		t.Fatalf("secret should have been marked as used")
+	}
+
+	second := nostr.GeneratePrivateKey()
+	secondPublicKey, _ := nostr.GetPublicKey(second)
+	bunker.handleRequest(ctx, makeTestRequest(t, second, bunkerPublicKey, "connect", bunkerPublicKey, "xyz"))
+	if len(errs) != 1 {
+		t.Fatalf("second connect should have been rejected: %v", errs)
+	}
+	if _, ok := signer.GetSession(secondPublicKey); ok {
+		t.Fatalf("the signer shouldn't have seen the second connect")
+	}
+}
+
+func TestBunkerApproveRequest(t *testing.T) {
+	relay := testrelay.New()
+	defer relay.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	bunkerSecretKey := nostr.GeneratePrivateKey()
+	bunkerPublicKey, _ := nostr.GetPublicKey(bunkerSecretKey)
+	signer := NewStaticKeySigner(bunkerSecretKey)
+
+	var mu sync.Mutex
+	var handled []string
+	bunker := &Bunker{
+		Signer:     &signer,
+		Relays:     []string{relay.URL},
+		Pool:       nostr.NewSimplePool(ctx),
+		PublicKeys: []string{bunkerPublicKey},
+		OnRequest: func(from string, req Request, resp Response) {
+			mu.Lock()
+			handled = append(handled, req.Method)
+			mu.Unlock()
+		},
+		OnError: func(err error) { t.Errorf("bunker error: %s", err) },
+		ApproveRequest: func(from string, req Request) bool {
+			return req.Method != "sign_event"
+		},
+	}
+	go bunker.Run(ctx)
+	time.Sleep(100 * time.Millisecond)
+
+	clientSecretKey := nostr.GeneratePrivateKey()
+	clientPublicKey, _ := nostr.GetPublicKey(clientSecretKey)
+	client := NewBunker(ctx, clientSecretKey, bunkerPublicKey, []string{relay.URL}, nil, nil)
+	time.Sleep(100 * time.Millisecond)
+
+	if _, err := client.RPC(ctx, "connect", []string{bunkerPublicKey, "xyz"}); err != nil {
+		t.Fatalf("connect failed: %s", err)
+	}
+	session, _ := signer.GetSession(clientPublicKey)
+	session.LastActivity = 1 // so we can tell if the signer touches it
+	signer.Sessions.SetSession(clientPublicKey, session)
+
+	evt := &nostr.Event{Kind: nostr.KindTextNote, CreatedAt: nostr.Now(), Content: "hello"}
+	if err := client.SignEvent(ctx, evt); err == nil || evt.Sig != "" {
+		t.Fatalf("signing should have been refused: %v", err)
+	}
+
+	// the client is still connected and the signer didn't touch its session
+	if after, ok := signer.GetSession(clientPublicKey); !ok || after.LastActivity != 1 || after.ConnectSecret != "xyz" {
+		t.Fatalf("session should have been kept as it was: %v", after)
+	}
+	if pubkey, err := client.GetPublicKey(ctx); err != nil || pubkey != bunkerPublicKey {
+		t.Fatalf("client should still be able to make requests: %s %v", pubkey, err)
+	}
+
+	waitUntil(func() bool { mu.Lock(); defer mu.Unlock(); return len(handled) >= 2 })
+	mu.Lock()
+	defer mu.Unlock()
+	if len(handled) != 2 || handled[0] != "connect" || handled[1] != "get_public_key" {
+		t.Fatalf("unexpected requests handled: %v", handled)
+	}
+}
+
+// waitUntil checks cond for up to a second.
+func waitUntil(cond func() bool) {
+	for i := 0; i < 100 && !cond(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func makeTestRequest(t *testing.T, clientSecretKey string, target string, method string, params ...string) *nostr.Event {
+	t.Helper()
+
+	shared, _ := nip04.ComputeSharedSecret(target, clientSecretKey)
+	jreq, _ := json.Marshal(Request{ID: "1", Method: method, Params: params})
+	content, _ := nip04.Encrypt(string(jreq), shared)
+	evt := &nostr.Event{
+		Kind:      nostr.KindNostrConnect,
+		CreatedAt: nostr.Now(),
+		Content:   content,
+		Tags:      nostr.Tags{{"p", target}},
+	}
+	if err := evt.Sign(clientSecretKey); err != nil {
+		t.Fatalf("failed to sign: %s", err)
+	}
+	return evt
+}
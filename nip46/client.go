@@ -4,8 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"math/rand"
 	"net/url"
+	"slices"
 	"strconv"
 	"sync/atomic"
 
@@ -26,11 +28,27 @@ type BunkerClient struct {
 	expectingAuth   *xsync.MapOf[string, struct{}]
 	idPrefix        string
 	onAuth          func(string)
+	logger          *slog.Logger
 
 	// memoized
 	getPublicKeyResponse string
 }
 
+// BunkerOption can be given to NewBunker and ConnectBunker.
+type BunkerOption interface {
+	IsBunkerOption()
+}
+
+// WithLogger makes the client write its logs to the given logger instead of nostr.DefaultLogger.
+// When no pool is given to the client the one it creates gets the same logger.
+type WithLogger struct {
+	Logger *slog.Logger
+}
+
+func (_ WithLogger) IsBunkerOption() {}
+
+var _ BunkerOption = WithLogger{}
+
 // ConnectBunker establishes an RPC connection to a NIP-46 signer using the relays and secret provided in the bunkerURL.
 // pool can be passed to reuse an existing pool, otherwise a new pool will be created.
 func ConnectBunker(
@@ -39,6 +57,7 @@ func ConnectBunker(
 	bunkerURLOrNIP05 string,
 	pool *nostr.SimplePool,
 	onAuth func(string),
+	opts ...BunkerOption,
 ) (*BunkerClient, error) {
 	parsed, err := url.Parse(bunkerURLOrNIP05)
 	if err != nil {
@@ -75,6 +94,7 @@ func ConnectBunker(
 		relays,
 		pool,
 		onAuth,
+		opts...,
 	)
 
 	_, err = bunker.RPC(ctx, "connect", []string{targetPublicKey, secret})
@@ -88,9 +108,20 @@ func NewBunker(
 	relays []string,
 	pool *nostr.SimplePool,
 	onAuth func(string),
+	opts ...BunkerOption,
 ) *BunkerClient {
+	logger := nostr.DefaultLogger
+	for _, opt := range opts {
+		switch o := opt.(type) {
+		case WithLogger:
+			if o.Logger != nil {
+				logger = o.Logger
+			}
+		}
+	}
+
 	if pool == nil {
-		pool = nostr.NewSimplePool(ctx)
+		pool = nostr.NewSimplePool(ctx, nostr.WithLogger{Logger: logger})
 	}
 
 	clientPublicKey, _ := nostr.GetPublicKey(clientSecretKey)
@@ -106,11 +137,12 @@ func NewBunker(
 		expectingAuth:   xsync.NewMapOf[string, struct{}](),
 		onAuth:          onAuth,
 		idPrefix:        "gn-" + strconv.Itoa(rand.Intn(65536)),
+		logger:          logger.With("bunker", targetPublicKey),
 	}
 
 	go func() {
 		now := nostr.Now()
-		events := pool.SubMany(ctx, relays, nostr.Filters{
+		events := pool.SubMany(ctx, slices.Clone(relays), nostr.Filters{
 			{
 				Tags:      nostr.TagMap{"p": []string{clientPublicKey}},
 				Kinds:     []int{nostr.KindNostrConnect},
@@ -126,11 +158,13 @@ func NewBunker(
 			var resp Response
 			plain, err := nip04.Decrypt(ie.Content, sharedSecret)
 			if err != nil {
+				bunker.logger.Debug("failed to decrypt response", "event", ie.ID, "relay", ie.Relay.URL, "err", err)
 				continue
 			}
 
 			err = json.Unmarshal([]byte(plain), &resp)
 			if err != nil {
+				bunker.logger.Debug("failed to decode response", "event", ie.ID, "relay", ie.Relay.URL, "err", err)
 				continue
 			}
 
@@ -145,6 +179,8 @@ func NewBunker(
 
 			if dispatcher, ok := bunker.listeners.Load(resp.ID); ok {
 				dispatcher <- resp
+			} else {
+				bunker.logger.Debug("got a response nobody is waiting for", "id", resp.ID, "event", ie.ID)
 			}
 		}
 	}()
@@ -209,10 +245,14 @@ func (bunker *BunkerClient) RPC(ctx context.Context, method string, params []str
 
 	for _, r := range bunker.relays {
 		relay, err := bunker.pool.EnsureRelay(r)
-		if err == nil {
-			hasWorked = true
+		if err != nil {
+			bunker.logger.Debug("failed to connect", "relay", r, "err", err)
+			continue
+		}
+		hasWorked = true
+		if err := relay.Publish(ctx, evt); err != nil {
+			bunker.logger.Debug("failed to publish request", "relay", r, "method", method, "event", evt.ID, "err", err)
 		}
-		relay.Publish(ctx, evt)
 	}
 
 	if !hasWorked {
@@ -3,7 +3,6 @@ package nip46
 import (
 	"encoding/json"
 	"fmt"
-	"slices"
 	"strings"
 	"sync"
 
@@ -16,8 +15,9 @@ import (
 var _ Signer = (*DynamicSigner)(nil)
 
 type DynamicSigner struct {
-	sessionKeys []string
-	sessions    []Session
+	// Sessions defaults to an in-memory store, replace it with a persistent one
+	// (like FileSessionStore) to keep clients authorized across restarts.
+	Sessions SessionStore
 
 	sync.Mutex
 
@@ -36,6 +36,7 @@ func NewDynamicSigner(
 	authorizeEncryption func(from string, secret string) bool,
 ) DynamicSigner {
 	return DynamicSigner{
+		Sessions:            NewMemorySessionStore(),
 		getPrivateKey:       getPrivateKey,
 		authorizeSigning:    authorizeSigning,
 		onEventSigned:       onEventSigned,
@@ -45,29 +46,68 @@ func NewDynamicSigner(
 }
 
 func (p *DynamicSigner) GetSession(clientPubkey string) (Session, bool) {
-	idx, exists := slices.BinarySearch(p.sessionKeys, clientPubkey)
-	if exists {
-		return p.sessions[idx], true
-	}
-	return Session{}, false
+	return p.Sessions.GetSession(clientPubkey)
 }
 
-func (p *DynamicSigner) setSession(clientPubkey string, session Session) {
+func (p *DynamicSigner) GetSessionStore() SessionStore { return p.Sessions }
+
+func (p *DynamicSigner) getOrCreateSession(clientPubkey string, privateKey string) (Session, error) {
 	p.Lock()
 	defer p.Unlock()
 
-	idx, exists := slices.BinarySearch(p.sessionKeys, clientPubkey)
-	if exists {
-		return
+	if session, exists := p.Sessions.GetSession(clientPubkey); exists {
+		return session, nil
+	}
+
+	shared, err := nip04.ComputeSharedSecret(clientPubkey, privateKey)
+	if err != nil {
+		return Session{}, fmt.Errorf("failed to compute shared secret: %w", err)
 	}
 
-	// add to pool
-	p.sessionKeys = append(p.sessionKeys, "") // bogus append just to increase the capacity
-	p.sessions = append(p.sessions, Session{})
-	copy(p.sessionKeys[idx+1:], p.sessionKeys[idx:])
-	copy(p.sessions[idx+1:], p.sessions[idx:])
-	p.sessionKeys[idx] = clientPubkey
-	p.sessions[idx] = session
+	session := Session{
+		ClientPubKey: clientPubkey,
+		SharedKey:    shared,
+	}
+
+	if err := p.Sessions.SetSession(clientPubkey, session); err != nil {
+		return Session{}, fmt.Errorf("failed to save session: %w", err)
+	}
+
+	return session, nil
+}
+
+// targetKey gets the private key of the user the request is addressed to.
+func (p *DynamicSigner) targetKey(event *nostr.Event) (pubkey string, privateKey string, err error) {
+	targetUser := event.Tags.GetFirst([]string{"p", ""})
+	if targetUser == nil || !nostr.IsValid32ByteHex((*targetUser)[1]) {
+		return "", "", fmt.Errorf("invalid \"p\" tag")
+	}
+
+	pubkey = (*targetUser)[1]
+	privateKey, err = p.getPrivateKey(pubkey)
+	if err != nil {
+		return pubkey, "", fmt.Errorf("no private key for %s: %w", pubkey, err)
+	}
+	return pubkey, privateKey, nil
+}
+
+// PreviewRequest decrypts a request without handling it or saving anything.
+func (p *DynamicSigner) PreviewRequest(event *nostr.Event) (Request, error) {
+	_, privateKey, err := p.targetKey(event)
+	if err != nil {
+		return Request{}, err
+	}
+	_, req, err := previewRequest(p.Sessions, event, privateKey)
+	return req, err
+}
+
+// RefuseRequest makes a response to the request with the given error, without handling it.
+func (p *DynamicSigner) RefuseRequest(event *nostr.Event, req Request, reason error) (nostr.Event, error) {
+	_, privateKey, err := p.targetKey(event)
+	if err != nil {
+		return nostr.Event{}, err
+	}
+	return refuseRequest(p.Sessions, event, privateKey, req, reason)
 }
 
 func (p *DynamicSigner) HandleRequest(event *nostr.Event) (
@@ -81,38 +121,22 @@ func (p *DynamicSigner) HandleRequest(event *nostr.Event) (
 			fmt.Errorf("event kind is %d, but we expected %d", event.Kind, nostr.KindNostrConnect)
 	}
 
-	targetUser := event.Tags.GetFirst([]string{"p", ""})
-	if targetUser == nil || !nostr.IsValid32ByteHex((*targetUser)[1]) {
-		return req, resp, eventResponse, fmt.Errorf("invalid \"p\" tag")
+	targetPubkey, privateKey, err := p.targetKey(event)
+	if err != nil {
+		return req, resp, eventResponse, err
 	}
 
-	targetPubkey := (*targetUser)[1]
-
-	privateKey, err := p.getPrivateKey(targetPubkey)
+	session, err := p.getOrCreateSession(event.PubKey, privateKey)
 	if err != nil {
-		return req, resp, eventResponse, fmt.Errorf("no private key for %s: %w", targetPubkey, err)
+		return req, resp, eventResponse, err
 	}
 
-	var session Session
-	idx, exists := slices.BinarySearch(p.sessionKeys, event.PubKey)
-	if exists {
-		session = p.sessions[idx]
-	} else {
-		session = Session{}
-
-		session.SharedKey, err = nip04.ComputeSharedSecret(event.PubKey, privateKey)
-		if err != nil {
-			return req, resp, eventResponse, fmt.Errorf("failed to compute shared secret: %w", err)
-		}
-		p.setSession(event.PubKey, session)
-
-		req, err = session.ParseRequest(event)
-		if err != nil {
-			return req, resp, eventResponse, fmt.Errorf("error parsing request: %w", err)
-		}
+	req, err = session.ParseRequest(event)
+	if err != nil {
+		return req, resp, eventResponse, fmt.Errorf("error parsing request: %w", err)
 	}
 
-	var secret string
+	secret := session.ConnectSecret
 	var result string
 	var resultErr error
 
@@ -222,6 +246,15 @@ func (p *DynamicSigner) HandleRequest(event *nostr.Event) (
 			fmt.Errorf("unknown method '%s'", req.Method)
 	}
 
+	if resultErr == nil && req.Method == "connect" {
+		session.ConnectSecret = secret
+		session.RequestedPermissions = parsePermissions(req.Params)
+	}
+	session.LastActivity = nostr.Now()
+	if err := p.Sessions.SetSession(event.PubKey, session); err != nil {
+		return req, resp, eventResponse, fmt.Errorf("failed to save session: %w", err)
+	}
+
 	resp, eventResponse, err = session.MakeResponse(req.ID, event.PubKey, result, resultErr)
 	if err != nil {
 		return req, resp, eventResponse, err
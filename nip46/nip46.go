@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"regexp"
+	"slices"
+	"strings"
 
 	"github.com/nbd-wtf/go-nostr"
 	"github.com/nbd-wtf/go-nostr/nip04"
@@ -29,7 +31,19 @@ type Signer interface {
 }
 
 type Session struct {
-	SharedKey []byte
+	ClientPubKey  string          `json:"client_pubkey"`
+	SharedKey     []byte          `json:"shared_key"`
+	ConnectSecret string          `json:"connect_secret,omitempty"` // the secret the client used on "connect"
+	LastActivity  nostr.Timestamp `json:"last_activity"`
+
+	// RequestedPermissions are the ones the client asked for on "connect", e.g. "sign_event:1".
+	// Signers don't enforce them, use HasRequested in an authorization callback to do that.
+	RequestedPermissions []string `json:"requested_permissions,omitempty"`
+}
+
+// HasRequested checks if perm was one of the permissions the client asked for on "connect".
+func (s Session) HasRequested(perm string) bool {
+	return slices.Contains(s.RequestedPermissions, perm)
 }
 
 type RelayReadWrite struct {
@@ -80,6 +94,47 @@ func (s Session) MakeResponse(
 	return resp, evt, nil
 }
 
+// previewRequest decrypts a request with the session the client already has, or with a new one
+// that isn't saved, so nothing changes for a request that is going to be refused.
+func previewRequest(sessions SessionStore, event *nostr.Event, privateKey string) (Session, Request, error) {
+	session, exists := sessions.GetSession(event.PubKey)
+	if !exists {
+		shared, err := nip04.ComputeSharedSecret(event.PubKey, privateKey)
+		if err != nil {
+			return session, Request{}, fmt.Errorf("failed to compute shared secret: %w", err)
+		}
+		session = Session{ClientPubKey: event.PubKey, SharedKey: shared}
+	}
+
+	req, err := session.ParseRequest(event)
+	if err != nil {
+		return session, req, fmt.Errorf("error parsing request: %w", err)
+	}
+	return session, req, nil
+}
+
+// refuseRequest makes a signed response with the given error.
+func refuseRequest(sessions SessionStore, event *nostr.Event, privateKey string, req Request, reason error) (nostr.Event, error) {
+	session, _, err := previewRequest(sessions, event, privateKey)
+	if err != nil {
+		return nostr.Event{}, err
+	}
+	_, eventResponse, err := session.MakeResponse(req.ID, event.PubKey, "", reason)
+	if err != nil {
+		return eventResponse, err
+	}
+	return eventResponse, eventResponse.Sign(privateKey)
+}
+
+// parsePermissions reads the optional comma-separated list of permissions a client
+// may request as the third parameter of "connect".
+func parsePermissions(params []string) []string {
+	if len(params) < 3 || params[2] == "" {
+		return nil
+	}
+	return strings.Split(params[2], ",")
+}
+
 func IsValidBunkerURL(input string) bool {
 	return BUNKER_REGEX.MatchString(input)
 }
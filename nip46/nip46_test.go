@@ -1,6 +1,14 @@
 package nip46
 
-import "testing"
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip04"
+)
 
 func TestValidBunkerURL(t *testing.T) {
 	if !IsValidBunkerURL("bunker://3bf0c63fcb93463407af97a5e5ee64fa883d107ef9e558472c4eb9aaaefa459d?relay=wss%3A%2F%2Frelay.damus.io&relay=wss%3A%2F%2Frelay.snort.social&relay=wss%3A%2F%2Frelay.nsecbunker.com") {
@@ -19,3 +27,87 @@ func TestValidBunkerURL(t *testing.T) {
 		t.Fatalf("should be invalid")
 	}
 }
+
+func TestFileSessionStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+
+	bunkerSecretKey := nostr.GeneratePrivateKey()
+	bunkerPublicKey, _ := nostr.GetPublicKey(bunkerSecretKey)
+	clientSecretKey := nostr.GeneratePrivateKey()
+	clientPublicKey, _ := nostr.GetPublicKey(clientSecretKey)
+
+	store, err := NewFileSessionStore(path)
+	if err != nil {
+		t.Fatalf("failed to create store: %s", err)
+	}
+	signer := NewStaticKeySigner(bunkerSecretKey)
+	signer.Sessions = store
+
+	// a client connects with a secret and some permissions
+	shared, _ := nip04.ComputeSharedSecret(bunkerPublicKey, clientSecretKey)
+	jreq, _ := json.Marshal(Request{
+		ID:     "1",
+		Method: "connect",
+		Params: []string{bunkerPublicKey, "s3cr3t", "sign_event:1,nip44_encrypt"},
+	})
+	content, _ := nip04.Encrypt(string(jreq), shared)
+	reqEvent := nostr.Event{
+		Kind:      nostr.KindNostrConnect,
+		CreatedAt: nostr.Now(),
+		Content:   content,
+		Tags:      nostr.Tags{{"p", bunkerPublicKey}},
+	}
+	reqEvent.Sign(clientSecretKey)
+
+	if _, resp, _, err := signer.HandleRequest(&reqEvent); err != nil || resp.Result != "ack" {
+		t.Fatalf("connect failed: %v %v", resp, err)
+	}
+
+	// now pretend we have restarted
+	store, err = NewFileSessionStore(path)
+	if err != nil {
+		t.Fatalf("failed to reload store: %s", err)
+	}
+	session, ok := store.GetSession(clientPublicKey)
+	if !ok {
+		t.Fatalf("session wasn't persisted")
+	}
+	if session.ConnectSecret != "s3cr3t" {
+		t.Errorf("wrong connect secret: %s", session.ConnectSecret)
+	}
+	if !session.HasRequested("sign_event:1") || !session.HasRequested("nip44_encrypt") {
+		t.Errorf("wrong permissions: %v", session.RequestedPermissions)
+	}
+	if !bytes.Equal(session.SharedKey, shared) {
+		t.Errorf("wrong shared key")
+	}
+	if session.LastActivity == 0 {
+		t.Errorf("last activity wasn't recorded")
+	}
+
+	// activity alone isn't written right away after another write, only on Flush
+	if err := store.SetSession(clientPublicKey, session); err != nil {
+		t.Fatalf("failed to save: %s", err)
+	}
+	session.LastActivity += 10
+	if err := store.SetSession(clientPublicKey, session); err != nil {
+		t.Fatalf("failed to save activity: %s", err)
+	}
+	if reloaded, _ := NewFileSessionStore(path); reloaded.sessions[0].LastActivity == session.LastActivity {
+		t.Errorf("activity shouldn't have been written yet")
+	}
+	if err := store.Flush(); err != nil {
+		t.Fatalf("failed to flush: %s", err)
+	}
+	if reloaded, _ := NewFileSessionStore(path); reloaded.sessions[0].LastActivity != session.LastActivity {
+		t.Errorf("activity wasn't flushed")
+	}
+
+	if err := store.DeleteSession(clientPublicKey); err != nil {
+		t.Fatalf("failed to delete: %s", err)
+	}
+	store, _ = NewFileSessionStore(path)
+	if _, ok := store.GetSession(clientPublicKey); ok {
+		t.Errorf("session should have been deleted")
+	}
+}
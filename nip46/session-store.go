@@ -0,0 +1,224 @@
+package nip46
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// SessionStore is where signers keep the sessions they have established with clients.
+// The default is an in-memory store, use a FileSessionStore (or implement your own) to
+// keep sessions across restarts.
+type SessionStore interface {
+	GetSession(clientPubkey string) (Session, bool)
+	SetSession(clientPubkey string, session Session) error
+	DeleteSession(clientPubkey string) error
+	ListSessions() ([]Session, error)
+}
+
+var (
+	_ SessionStore = (*MemorySessionStore)(nil)
+	_ SessionStore = (*FileSessionStore)(nil)
+)
+
+// MemorySessionStore keeps sessions in a sorted slice, they are lost when the process exits.
+type MemorySessionStore struct {
+	sync.RWMutex
+
+	sessionKeys []string
+	sessions    []Session
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{}
+}
+
+func (m *MemorySessionStore) GetSession(clientPubkey string) (Session, bool) {
+	m.RLock()
+	defer m.RUnlock()
+
+	idx, exists := slices.BinarySearch(m.sessionKeys, clientPubkey)
+	if exists {
+		return m.sessions[idx], true
+	}
+	return Session{}, false
+}
+
+func (m *MemorySessionStore) SetSession(clientPubkey string, session Session) error {
+	m.Lock()
+	defer m.Unlock()
+
+	session.ClientPubKey = clientPubkey
+
+	idx, exists := slices.BinarySearch(m.sessionKeys, clientPubkey)
+	if exists {
+		m.sessions[idx] = session
+		return nil
+	}
+
+	// add to pool
+	m.sessionKeys = append(m.sessionKeys, "") // bogus append just to increase the capacity
+	m.sessions = append(m.sessions, Session{})
+	copy(m.sessionKeys[idx+1:], m.sessionKeys[idx:])
+	copy(m.sessions[idx+1:], m.sessions[idx:])
+	m.sessionKeys[idx] = clientPubkey
+	m.sessions[idx] = session
+
+	return nil
+}
+
+func (m *MemorySessionStore) DeleteSession(clientPubkey string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	idx, exists := slices.BinarySearch(m.sessionKeys, clientPubkey)
+	if !exists {
+		return nil
+	}
+
+	m.sessionKeys = slices.Delete(m.sessionKeys, idx, idx+1)
+	m.sessions = slices.Delete(m.sessions, idx, idx+1)
+	return nil
+}
+
+func (m *MemorySessionStore) ListSessions() ([]Session, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	return slices.Clone(m.sessions), nil
+}
+
+// FileSessionStore is a MemorySessionStore that is loaded from a JSON file when created and
+// rewritten to that same file every time a session changes.
+//
+// Changes to LastActivity alone, which happen on every request, are only written if the file
+// wasn't written in the last ActivitySaveInterval, call Flush before exiting to keep them all.
+type FileSessionStore struct {
+	MemorySessionStore
+
+	// ActivitySaveInterval defaults to one minute.
+	ActivitySaveInterval time.Duration
+
+	path     string
+	writing  sync.Mutex
+	lastSave time.Time
+	pending  bool
+}
+
+// NewFileSessionStore loads the sessions stored at path, if the file doesn't exist it will
+// be created when the first session is saved.
+func NewFileSessionStore(path string) (*FileSessionStore, error) {
+	store := &FileSessionStore{path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read sessions file: %w", err)
+	}
+
+	var sessions []Session
+	if err := json.Unmarshal(data, &sessions); err != nil {
+		return nil, fmt.Errorf("failed to decode sessions file '%s': %w", path, err)
+	}
+	for _, session := range sessions {
+		store.MemorySessionStore.SetSession(session.ClientPubKey, session)
+	}
+
+	return store, nil
+}
+
+func (f *FileSessionStore) SetSession(clientPubkey string, session Session) error {
+	previous, exists := f.MemorySessionStore.GetSession(clientPubkey)
+	f.MemorySessionStore.SetSession(clientPubkey, session)
+
+	session.ClientPubKey = clientPubkey
+	if exists && sameExceptActivity(previous, session) {
+		interval := f.ActivitySaveInterval
+		if interval == 0 {
+			interval = time.Minute
+		}
+
+		f.writing.Lock()
+		recent := time.Since(f.lastSave) < interval
+		if recent {
+			f.pending = true
+		}
+		f.writing.Unlock()
+
+		if recent {
+			return nil
+		}
+	}
+
+	return f.save()
+}
+
+// Flush writes the LastActivity changes that were kept only in memory, if any.
+func (f *FileSessionStore) Flush() error {
+	f.writing.Lock()
+	pending := f.pending
+	f.writing.Unlock()
+
+	if !pending {
+		return nil
+	}
+	return f.save()
+}
+
+func (f *FileSessionStore) DeleteSession(clientPubkey string) error {
+	f.MemorySessionStore.DeleteSession(clientPubkey)
+	return f.save()
+}
+
+// save writes all sessions to a temporary file and then moves it over the previous one
+// so we never end up with a half-written file.
+func (f *FileSessionStore) save() error {
+	f.writing.Lock()
+	defer f.writing.Unlock()
+
+	sessions, _ := f.MemorySessionStore.ListSessions()
+	data, err := json.Marshal(sessions)
+	if err != nil {
+		return fmt.Errorf("failed to encode sessions: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary sessions file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set sessions file permissions: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write sessions file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write sessions file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return fmt.Errorf("failed to replace sessions file: %w", err)
+	}
+
+	f.lastSave = time.Now()
+	f.pending = false
+	return nil
+}
+
+func sameExceptActivity(a, b Session) bool {
+	return a.ClientPubKey == b.ClientPubKey &&
+		bytes.Equal(a.SharedKey, b.SharedKey) &&
+		a.ConnectSecret == b.ConnectSecret &&
+		slices.Equal(a.RequestedPermissions, b.RequestedPermissions)
+}
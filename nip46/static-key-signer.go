@@ -3,7 +3,6 @@ package nip46
 import (
 	"encoding/json"
 	"fmt"
-	"slices"
 	"strings"
 	"sync"
 
@@ -18,8 +17,9 @@ var _ Signer = (*StaticKeySigner)(nil)
 type StaticKeySigner struct {
 	secretKey string
 
-	sessionKeys []string
-	sessions    []Session
+	// Sessions defaults to an in-memory store, replace it with a persistent one
+	// (like FileSessionStore) to keep clients authorized across restarts.
+	Sessions SessionStore
 
 	sync.Mutex
 
@@ -30,25 +30,23 @@ type StaticKeySigner struct {
 func NewStaticKeySigner(secretKey string) StaticKeySigner {
 	return StaticKeySigner{
 		secretKey:         secretKey,
+		Sessions:          NewMemorySessionStore(),
 		RelaysToAdvertise: make(map[string]RelayReadWrite),
 	}
 }
 
 func (p *StaticKeySigner) GetSession(clientPubkey string) (Session, bool) {
-	idx, exists := slices.BinarySearch(p.sessionKeys, clientPubkey)
-	if exists {
-		return p.sessions[idx], true
-	}
-	return Session{}, false
+	return p.Sessions.GetSession(clientPubkey)
 }
 
+func (p *StaticKeySigner) GetSessionStore() SessionStore { return p.Sessions }
+
 func (p *StaticKeySigner) getOrCreateSession(clientPubkey string) (Session, error) {
 	p.Lock()
 	defer p.Unlock()
 
-	idx, exists := slices.BinarySearch(p.sessionKeys, clientPubkey)
-	if exists {
-		return p.sessions[idx], nil
+	if session, exists := p.Sessions.GetSession(clientPubkey); exists {
+		return session, nil
 	}
 
 	shared, err := nip04.ComputeSharedSecret(clientPubkey, p.secretKey)
@@ -57,20 +55,28 @@ func (p *StaticKeySigner) getOrCreateSession(clientPubkey string) (Session, erro
 	}
 
 	session := Session{
-		SharedKey: shared,
+		ClientPubKey: clientPubkey,
+		SharedKey:    shared,
 	}
 
-	// add to pool
-	p.sessionKeys = append(p.sessionKeys, "") // bogus append just to increase the capacity
-	p.sessions = append(p.sessions, Session{})
-	copy(p.sessionKeys[idx+1:], p.sessionKeys[idx:])
-	copy(p.sessions[idx+1:], p.sessions[idx:])
-	p.sessionKeys[idx] = clientPubkey
-	p.sessions[idx] = session
+	if err := p.Sessions.SetSession(clientPubkey, session); err != nil {
+		return Session{}, fmt.Errorf("failed to save session: %w", err)
+	}
 
 	return session, nil
 }
 
+// PreviewRequest decrypts a request without handling it or saving anything.
+func (p *StaticKeySigner) PreviewRequest(event *nostr.Event) (Request, error) {
+	_, req, err := previewRequest(p.Sessions, event, p.secretKey)
+	return req, err
+}
+
+// RefuseRequest makes a response to the request with the given error, without handling it.
+func (p *StaticKeySigner) RefuseRequest(event *nostr.Event, req Request, reason error) (nostr.Event, error) {
+	return refuseRequest(p.Sessions, event, p.secretKey, req, reason)
+}
+
 func (p *StaticKeySigner) HandleRequest(event *nostr.Event) (
 	req Request,
 	resp Response,
@@ -92,7 +98,7 @@ func (p *StaticKeySigner) HandleRequest(event *nostr.Event) (
 		return req, resp, eventResponse, fmt.Errorf("error parsing request: %w", err)
 	}
 
-	var secret string
+	secret := session.ConnectSecret
 	var harmless bool
 	var result string
 	var resultErr error
@@ -206,6 +212,15 @@ func (p *StaticKeySigner) HandleRequest(event *nostr.Event) (
 		}
 	}
 
+	if resultErr == nil && req.Method == "connect" {
+		session.ConnectSecret = secret
+		session.RequestedPermissions = parsePermissions(req.Params)
+	}
+	session.LastActivity = nostr.Now()
+	if err := p.Sessions.SetSession(event.PubKey, session); err != nil {
+		return req, resp, eventResponse, fmt.Errorf("failed to save session: %w", err)
+	}
+
 	resp, eventResponse, err = session.MakeResponse(req.ID, event.PubKey, result, resultErr)
 	if err != nil {
 		return req, resp, eventResponse, err
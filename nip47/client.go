@@ -0,0 +1,197 @@
+package nip47
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip04"
+	"github.com/puzpuzpuz/xsync/v3"
+)
+
+type Client struct {
+	pool            *nostr.SimplePool
+	relays          []string
+	walletPubKey    string
+	clientSecretKey string
+	sharedSecret    []byte
+	listeners       *xsync.MapOf[string, chan Response]
+}
+
+// NewClient starts listening for responses from the wallet service specified in the
+// nostr+walletconnect:// uri. pool can be passed to reuse an existing pool, otherwise a new
+// pool will be created.
+func NewClient(ctx context.Context, uri string, pool *nostr.SimplePool) (*Client, error) {
+	conn, err := ParseConnectionURI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if pool == nil {
+		pool = nostr.NewSimplePool(ctx)
+	}
+
+	clientPublicKey, err := nostr.GetPublicKey(conn.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret: %w", err)
+	}
+	sharedSecret, err := nip04.ComputeSharedSecret(conn.WalletPubKey, conn.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute shared secret: %w", err)
+	}
+
+	client := &Client{
+		pool:            pool,
+		relays:          conn.Relays,
+		walletPubKey:    conn.WalletPubKey,
+		clientSecretKey: conn.Secret,
+		sharedSecret:    sharedSecret,
+		listeners:       xsync.NewMapOf[string, chan Response](),
+	}
+
+	go func() {
+		now := nostr.Now()
+		events := pool.SubMany(ctx, slices.Clone(conn.Relays), nostr.Filters{
+			{
+				Tags:      nostr.TagMap{"p": []string{clientPublicKey}},
+				Kinds:     []int{nostr.KindNWCWalletResponse},
+				Authors:   []string{conn.WalletPubKey},
+				Since:     &now,
+				LimitZero: true,
+			},
+		})
+		for ie := range events {
+			requestID := ie.Tags.GetFirst([]string{"e", ""})
+			if requestID == nil {
+				continue
+			}
+			dispatcher, ok := client.listeners.Load((*requestID)[1])
+			if !ok {
+				continue
+			}
+
+			plain, err := nip04.Decrypt(ie.Content, sharedSecret)
+			if err != nil {
+				continue
+			}
+			var resp Response
+			if err := json.Unmarshal([]byte(plain), &resp); err != nil {
+				continue
+			}
+
+			select {
+			case dispatcher <- resp:
+			default:
+			}
+		}
+	}()
+
+	return client, nil
+}
+
+func (c *Client) PayInvoice(ctx context.Context, invoice string, amountMsat int64) (PayInvoiceResult, error) {
+	var res PayInvoiceResult
+	err := c.RPC(ctx, MethodPayInvoice, PayInvoiceParams{Invoice: invoice, Amount: amountMsat}, &res)
+	return res, err
+}
+
+func (c *Client) MakeInvoice(ctx context.Context, params MakeInvoiceParams) (Transaction, error) {
+	var res Transaction
+	err := c.RPC(ctx, MethodMakeInvoice, params, &res)
+	return res, err
+}
+
+// GetBalance returns the wallet balance in millisatoshis.
+func (c *Client) GetBalance(ctx context.Context) (int64, error) {
+	var res GetBalanceResult
+	err := c.RPC(ctx, MethodGetBalance, struct{}{}, &res)
+	return res.Balance, err
+}
+
+func (c *Client) LookupInvoice(ctx context.Context, params LookupInvoiceParams) (Transaction, error) {
+	var res Transaction
+	err := c.RPC(ctx, MethodLookupInvoice, params, &res)
+	return res, err
+}
+
+func (c *Client) ListTransactions(ctx context.Context, params ListTransactionsParams) ([]Transaction, error) {
+	var res listTransactionsResult
+	err := c.RPC(ctx, MethodListTransactions, params, &res)
+	return res.Transactions, err
+}
+
+func (c *Client) GetInfo(ctx context.Context) (GetInfoResult, error) {
+	var res GetInfoResult
+	err := c.RPC(ctx, MethodGetInfo, struct{}{}, &res)
+	return res, err
+}
+
+// RPC sends a request to the wallet service and waits for its response, decoding the result
+// into result. If ctx has no deadline it will give up after one minute.
+// Errors returned by the wallet service are of type *Error.
+func (c *Client) RPC(ctx context.Context, method string, params any, result any) error {
+	if _, ok := ctx.Deadline(); !ok {
+		// if no timeout is set, force it to 60 seconds
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, 60*time.Second, fmt.Errorf("given up waiting for a response"))
+		defer cancel()
+	}
+
+	jparams, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed to encode params: %w", err)
+	}
+	req, _ := json.Marshal(Request{Method: method, Params: jparams})
+
+	content, err := nip04.Encrypt(string(req), c.sharedSecret)
+	if err != nil {
+		return fmt.Errorf("error encrypting request: %w", err)
+	}
+
+	evt := nostr.Event{
+		Content:   content,
+		CreatedAt: nostr.Now(),
+		Kind:      nostr.KindNWCWalletRequest,
+		Tags:      nostr.Tags{{"p", c.walletPubKey}},
+	}
+	if err := evt.Sign(c.clientSecretKey); err != nil {
+		return fmt.Errorf("failed to sign request event: %w", err)
+	}
+
+	respWaiter := make(chan Response, 1)
+	c.listeners.Store(evt.ID, respWaiter)
+	defer c.listeners.Delete(evt.ID)
+
+	hasWorked := false
+	for _, url := range c.relays {
+		relay, err := c.pool.EnsureRelay(url)
+		if err != nil {
+			continue
+		}
+		if err := relay.Publish(ctx, evt); err == nil {
+			hasWorked = true
+		}
+	}
+	if !hasWorked {
+		return fmt.Errorf("couldn't publish request to any relay")
+	}
+
+	select {
+	case resp := <-respWaiter:
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if resp.ResultType != method {
+			return fmt.Errorf("got a response for '%s', expected '%s'", resp.ResultType, method)
+		}
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			return fmt.Errorf("failed to decode result: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
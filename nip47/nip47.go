@@ -0,0 +1,173 @@
+// Package nip47 implements NIP-47 Nostr Wallet Connect.
+// See https://github.com/nostr-protocol/nips/blob/master/47.md for details.
+package nip47
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const (
+	MethodPayInvoice       = "pay_invoice"
+	MethodMakeInvoice      = "make_invoice"
+	MethodGetBalance       = "get_balance"
+	MethodLookupInvoice    = "lookup_invoice"
+	MethodListTransactions = "list_transactions"
+	MethodGetInfo          = "get_info"
+)
+
+const (
+	ErrCodeRateLimited         = "RATE_LIMITED"
+	ErrCodeNotImplemented      = "NOT_IMPLEMENTED"
+	ErrCodeInsufficientBalance = "INSUFFICIENT_BALANCE"
+	ErrCodeQuotaExceeded       = "QUOTA_EXCEEDED"
+	ErrCodeRestricted          = "RESTRICTED"
+	ErrCodeUnauthorized        = "UNAUTHORIZED"
+	ErrCodeInternal            = "INTERNAL"
+	ErrCodePaymentFailed       = "PAYMENT_FAILED"
+	ErrCodeNotFound            = "NOT_FOUND"
+	ErrCodeOther               = "OTHER"
+)
+
+// Error is the error object returned by wallet services, it can be returned from a
+// WalletService method to control which code is sent to the client.
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string { return e.Code + ": " + e.Message }
+
+type Request struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type Response struct {
+	ResultType string          `json:"result_type"`
+	Error      *Error          `json:"error,omitempty"`
+	Result     json.RawMessage `json:"result,omitempty"`
+}
+
+type PayInvoiceParams struct {
+	Invoice string `json:"invoice"`
+	Amount  int64  `json:"amount,omitempty"` // in millisatoshis, for invoices without an amount
+}
+
+type PayInvoiceResult struct {
+	Preimage string `json:"preimage"`
+	FeesPaid int64  `json:"fees_paid,omitempty"`
+}
+
+type MakeInvoiceParams struct {
+	Amount          int64  `json:"amount"` // in millisatoshis
+	Description     string `json:"description,omitempty"`
+	DescriptionHash string `json:"description_hash,omitempty"`
+	Expiry          int64  `json:"expiry,omitempty"` // in seconds
+}
+
+type LookupInvoiceParams struct {
+	PaymentHash string `json:"payment_hash,omitempty"`
+	Invoice     string `json:"invoice,omitempty"`
+}
+
+type ListTransactionsParams struct {
+	From   nostr.Timestamp `json:"from,omitempty"`
+	Until  nostr.Timestamp `json:"until,omitempty"`
+	Limit  int             `json:"limit,omitempty"`
+	Offset int             `json:"offset,omitempty"`
+	Unpaid bool            `json:"unpaid,omitempty"`
+	Type   string          `json:"type,omitempty"` // "incoming" or "outgoing", empty for both
+}
+
+type GetBalanceResult struct {
+	Balance int64 `json:"balance"` // in millisatoshis
+}
+
+type GetInfoResult struct {
+	Alias       string   `json:"alias,omitempty"`
+	Color       string   `json:"color,omitempty"`
+	Pubkey      string   `json:"pubkey,omitempty"`
+	Network     string   `json:"network,omitempty"`
+	BlockHeight int      `json:"block_height,omitempty"`
+	BlockHash   string   `json:"block_hash,omitempty"`
+	Methods     []string `json:"methods"`
+}
+
+type Transaction struct {
+	Type            string          `json:"type"` // "incoming" or "outgoing"
+	Invoice         string          `json:"invoice,omitempty"`
+	Description     string          `json:"description,omitempty"`
+	DescriptionHash string          `json:"description_hash,omitempty"`
+	Preimage        string          `json:"preimage,omitempty"`
+	PaymentHash     string          `json:"payment_hash"`
+	Amount          int64           `json:"amount"` // in millisatoshis
+	FeesPaid        int64           `json:"fees_paid"`
+	CreatedAt       nostr.Timestamp `json:"created_at"`
+	ExpiresAt       nostr.Timestamp `json:"expires_at,omitempty"`
+	SettledAt       nostr.Timestamp `json:"settled_at,omitempty"`
+	Metadata        map[string]any  `json:"metadata,omitempty"`
+}
+
+type listTransactionsResult struct {
+	Transactions []Transaction `json:"transactions"`
+}
+
+// ConnectionURI is what a wallet service gives to a client so it can connect, encoded as
+// nostr+walletconnect://<wallet pubkey>?relay=<relay>&secret=<client secret key>.
+type ConnectionURI struct {
+	WalletPubKey string
+	Relays       []string
+	Secret       string
+	LUD16        string
+}
+
+func ParseConnectionURI(uri string) (ConnectionURI, error) {
+	var c ConnectionURI
+
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return c, fmt.Errorf("invalid url: %w", err)
+	}
+	if parsed.Scheme != "nostr+walletconnect" && parsed.Scheme != "nostrwalletconnect" {
+		return c, fmt.Errorf("wrong scheme '%s', must be nostr+walletconnect://", parsed.Scheme)
+	}
+
+	// some wallets write nostr+walletconnect:<pubkey> without the slashes
+	c.WalletPubKey = parsed.Host
+	if c.WalletPubKey == "" {
+		c.WalletPubKey = strings.TrimPrefix(parsed.Opaque, "//")
+	}
+	if !nostr.IsValidPublicKey(c.WalletPubKey) {
+		return c, fmt.Errorf("'%s' is not a valid public key hex", c.WalletPubKey)
+	}
+
+	qs := parsed.Query()
+	c.Relays = qs["relay"]
+	if len(c.Relays) == 0 {
+		return c, fmt.Errorf("no relays in connection uri")
+	}
+	c.Secret = qs.Get("secret")
+	if !nostr.IsValid32ByteHex(c.Secret) {
+		return c, fmt.Errorf("invalid secret in connection uri")
+	}
+	c.LUD16 = qs.Get("lud16")
+
+	return c, nil
+}
+
+func (c ConnectionURI) String() string {
+	qs := url.Values{}
+	for _, relay := range c.Relays {
+		qs.Add("relay", relay)
+	}
+	qs.Set("secret", c.Secret)
+	if c.LUD16 != "" {
+		qs.Set("lud16", c.LUD16)
+	}
+	return "nostr+walletconnect://" + c.WalletPubKey + "?" + qs.Encode()
+}
@@ -0,0 +1,167 @@
+package nip47
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/internal/testrelay"
+	"github.com/nbd-wtf/go-nostr/nip04"
+)
+
+func TestConnectionURI(t *testing.T) {
+	uri := "nostr+walletconnect://b889ff5b1513b641e2a139f661a661364979c5beee91842f8f0ef42ab558e9d4?relay=wss%3A%2F%2Frelay.damus.io&secret=71a8c14c1407c113601079c4302dab36460f0ccd0ad506f1f2dc73b5100e4f3c"
+	c, err := ParseConnectionURI(uri)
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+	if c.WalletPubKey != "b889ff5b1513b641e2a139f661a661364979c5beee91842f8f0ef42ab558e9d4" {
+		t.Errorf("wrong wallet pubkey: %s", c.WalletPubKey)
+	}
+	if len(c.Relays) != 1 || c.Relays[0] != "wss://relay.damus.io" {
+		t.Errorf("wrong relays: %v", c.Relays)
+	}
+	if c.Secret != "71a8c14c1407c113601079c4302dab36460f0ccd0ad506f1f2dc73b5100e4f3c" {
+		t.Errorf("wrong secret: %s", c.Secret)
+	}
+
+	again, err := ParseConnectionURI(c.String())
+	if err != nil || again.WalletPubKey != c.WalletPubKey || again.Secret != c.Secret || again.Relays[0] != c.Relays[0] {
+		t.Errorf("roundtrip failed: %v %v", again, err)
+	}
+
+	if _, err := ParseConnectionURI("bunker://b889ff5b1513b641e2a139f661a661364979c5beee91842f8f0ef42ab558e9d4?relay=wss://x.com"); err == nil {
+		t.Errorf("should have failed with the wrong scheme")
+	}
+}
+
+type testWallet struct {
+	balance int64
+	txs     []Transaction
+}
+
+func (w *testWallet) PayInvoice(ctx context.Context, client string, params PayInvoiceParams) (PayInvoiceResult, error) {
+	if params.Amount > w.balance {
+		return PayInvoiceResult{}, &Error{ErrCodeInsufficientBalance, "not enough"}
+	}
+	w.balance -= params.Amount
+	return PayInvoiceResult{Preimage: "0123456789abcdef"}, nil
+}
+
+func (w *testWallet) MakeInvoice(ctx context.Context, client string, params MakeInvoiceParams) (Transaction, error) {
+	tx := Transaction{Type: "incoming", Invoice: "lnbc1...", PaymentHash: "ff", Amount: params.Amount, Description: params.Description}
+	w.txs = append(w.txs, tx)
+	return tx, nil
+}
+
+func (w *testWallet) GetBalance(ctx context.Context, client string) (int64, error) {
+	return w.balance, nil
+}
+
+func (w *testWallet) LookupInvoice(ctx context.Context, client string, params LookupInvoiceParams) (Transaction, error) {
+	for _, tx := range w.txs {
+		if tx.PaymentHash == params.PaymentHash {
+			return tx, nil
+		}
+	}
+	return Transaction{}, &Error{ErrCodeNotFound, "no such invoice"}
+}
+
+func (w *testWallet) ListTransactions(ctx context.Context, client string, params ListTransactionsParams) ([]Transaction, error) {
+	return w.txs, nil
+}
+
+func TestClientAndService(t *testing.T) {
+	relay := testrelay.New()
+	defer relay.Close()
+	relayURL := nostr.NormalizeURL(relay.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	walletSecretKey := nostr.GeneratePrivateKey()
+	walletPublicKey, _ := nostr.GetPublicKey(walletSecretKey)
+	service := NewService(walletSecretKey, &testWallet{balance: 50_000})
+
+	// run the service
+	pool := nostr.NewSimplePool(ctx)
+	go func() {
+		for ie := range pool.SubMany(ctx, []string{relayURL}, nostr.Filters{{Kinds: []int{nostr.KindNWCWalletRequest}}}) {
+			_, _, response, err := service.HandleRequest(ctx, ie.Event)
+			if err != nil {
+				t.Errorf("failed to handle request: %s", err)
+				continue
+			}
+			ie.Relay.Publish(ctx, response)
+		}
+	}()
+
+	uri := ConnectionURI{
+		WalletPubKey: walletPublicKey,
+		Relays:       []string{relayURL},
+		Secret:       nostr.GeneratePrivateKey(),
+	}
+	client, err := NewClient(ctx, uri.String(), nil)
+	if err != nil {
+		t.Fatalf("failed to create client: %s", err)
+	}
+	time.Sleep(100 * time.Millisecond) // give everybody time to subscribe
+
+	if balance, err := client.GetBalance(ctx); err != nil || balance != 50_000 {
+		t.Fatalf("wrong balance %d: %v", balance, err)
+	}
+	if res, err := client.PayInvoice(ctx, "lnbc...", 20_000); err != nil || res.Preimage != "0123456789abcdef" {
+		t.Fatalf("failed to pay: %v %v", res, err)
+	}
+	var nwcErr *Error
+	if _, err := client.PayInvoice(ctx, "lnbc...", 40_000); !errors.As(err, &nwcErr) || nwcErr.Code != ErrCodeInsufficientBalance {
+		t.Fatalf("expected an insufficient balance error, got %v", err)
+	}
+	if tx, err := client.MakeInvoice(ctx, MakeInvoiceParams{Amount: 1000, Description: "hello"}); err != nil || tx.Amount != 1000 {
+		t.Fatalf("failed to make invoice: %v %v", tx, err)
+	}
+	if tx, err := client.LookupInvoice(ctx, LookupInvoiceParams{PaymentHash: "ff"}); err != nil || tx.Description != "hello" {
+		t.Fatalf("failed to lookup invoice: %v %v", tx, err)
+	}
+	if txs, err := client.ListTransactions(ctx, ListTransactionsParams{}); err != nil || len(txs) != 1 {
+		t.Fatalf("failed to list transactions: %v %v", txs, err)
+	}
+
+	service.AuthorizeClient = func(string) bool { return false }
+	if _, err := client.GetBalance(ctx); !errors.As(err, &nwcErr) || nwcErr.Code != ErrCodeUnauthorized {
+		t.Fatalf("expected an unauthorized error, got %v", err)
+	}
+}
+
+func TestServiceRequestForOtherWallet(t *testing.T) {
+	walletSecretKey := nostr.GeneratePrivateKey()
+	walletPublicKey, _ := nostr.GetPublicKey(walletSecretKey)
+	service := NewService(walletSecretKey, &testWallet{balance: 50_000})
+
+	clientSecretKey := nostr.GeneratePrivateKey()
+	shared, _ := nip04.ComputeSharedSecret(walletPublicKey, clientSecretKey)
+	content, _ := nip04.Encrypt(`{"method":"pay_invoice","params":{"invoice":"lnbc...","amount":20000}}`, shared)
+
+	otherPublicKey, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	for _, target := range []string{otherPublicKey, walletPublicKey} {
+		evt := nostr.Event{
+			Kind:      nostr.KindNWCWalletRequest,
+			CreatedAt: nostr.Now(),
+			Content:   content,
+			Tags:      nostr.Tags{{"p", target}},
+		}
+		evt.Sign(clientSecretKey)
+
+		_, _, _, err := service.HandleRequest(context.Background(), &evt)
+		if target == otherPublicKey && err == nil {
+			t.Errorf("request for another wallet should have been refused")
+		} else if target == walletPublicKey && err != nil {
+			t.Errorf("request for this wallet failed: %s", err)
+		}
+	}
+	if balance := service.wallet.(*testWallet).balance; balance != 30_000 {
+		t.Errorf("wallet should have paid once, balance is %d", balance)
+	}
+}
@@ -0,0 +1,180 @@
+package nip47
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip04"
+)
+
+// WalletService is what a wallet backend must implement to be exposed over NWC by a Service.
+// client is the public key of the client that made the request. Methods may return an *Error
+// to choose the error code sent back, other errors are sent as INTERNAL.
+type WalletService interface {
+	PayInvoice(ctx context.Context, client string, params PayInvoiceParams) (PayInvoiceResult, error)
+	MakeInvoice(ctx context.Context, client string, params MakeInvoiceParams) (Transaction, error)
+	GetBalance(ctx context.Context, client string) (int64, error)
+	LookupInvoice(ctx context.Context, client string, params LookupInvoiceParams) (Transaction, error)
+	ListTransactions(ctx context.Context, client string, params ListTransactionsParams) ([]Transaction, error)
+}
+
+type Service struct {
+	secretKey string
+	publicKey string
+	wallet    WalletService
+
+	// Methods are advertised in the info event and answered, requests for any other method
+	// get a NOT_IMPLEMENTED error. Defaults to all methods.
+	Methods []string
+
+	// AuthorizeClient, if set, is called for every request, returning false will
+	// make the request fail with an UNAUTHORIZED error.
+	AuthorizeClient func(clientPubkey string) bool
+}
+
+func NewService(secretKey string, wallet WalletService) *Service {
+	publicKey, _ := nostr.GetPublicKey(secretKey)
+	return &Service{
+		secretKey: secretKey,
+		publicKey: publicKey,
+		wallet:    wallet,
+		Methods: []string{
+			MethodPayInvoice,
+			MethodMakeInvoice,
+			MethodGetBalance,
+			MethodLookupInvoice,
+			MethodListTransactions,
+			MethodGetInfo,
+		},
+	}
+}
+
+// InfoEvent returns the signed kind 13194 event that must be published so clients
+// know which methods this service supports.
+func (s *Service) InfoEvent() (nostr.Event, error) {
+	evt := nostr.Event{
+		CreatedAt: nostr.Now(),
+		Kind:      nostr.KindNWCWalletInfo,
+		Tags:      nostr.Tags{},
+		Content:   strings.Join(s.Methods, " "),
+	}
+	err := evt.Sign(s.secretKey)
+	return evt, err
+}
+
+// HandleRequest reads a kind 23194 request, calls the wallet and returns a signed response
+// event that must be published to the relays the client is listening on. Requests that don't
+// tag this wallet's public key are refused without calling the wallet.
+func (s *Service) HandleRequest(ctx context.Context, event *nostr.Event) (
+	req Request,
+	resp Response,
+	eventResponse nostr.Event,
+	err error,
+) {
+	if event.Kind != nostr.KindNWCWalletRequest {
+		return req, resp, eventResponse,
+			fmt.Errorf("event kind is %d, but we expected %d", event.Kind, nostr.KindNWCWalletRequest)
+	}
+	if event.Tags.GetFirst([]string{"p", s.publicKey}) == nil {
+		return req, resp, eventResponse, fmt.Errorf("request is not addressed to wallet %s", s.publicKey)
+	}
+
+	sharedSecret, err := nip04.ComputeSharedSecret(event.PubKey, s.secretKey)
+	if err != nil {
+		return req, resp, eventResponse, fmt.Errorf("failed to compute shared secret: %w", err)
+	}
+
+	plain, err := nip04.Decrypt(event.Content, sharedSecret)
+	if err != nil {
+		return req, resp, eventResponse, fmt.Errorf("failed to decrypt event from %s: %w", event.PubKey, err)
+	}
+	if err := json.Unmarshal([]byte(plain), &req); err != nil {
+		return req, resp, eventResponse, fmt.Errorf("error parsing request: %w", err)
+	}
+
+	var result any
+	var resultErr error
+
+	switch {
+	case s.AuthorizeClient != nil && !s.AuthorizeClient(event.PubKey):
+		resultErr = &Error{ErrCodeUnauthorized, "this client is not authorized"}
+	case !slices.Contains(s.Methods, req.Method):
+		resultErr = &Error{ErrCodeNotImplemented, "method '" + req.Method + "' is not supported"}
+	default:
+		result, resultErr = s.call(ctx, event.PubKey, req)
+	}
+
+	resp.ResultType = req.Method
+	if resultErr != nil {
+		var nwcErr *Error
+		if !errors.As(resultErr, &nwcErr) {
+			nwcErr = &Error{ErrCodeInternal, resultErr.Error()}
+		}
+		resp.Error = nwcErr
+	} else {
+		resp.Result, _ = json.Marshal(result)
+	}
+
+	jresp, _ := json.Marshal(resp)
+	ciphertext, err := nip04.Encrypt(string(jresp), sharedSecret)
+	if err != nil {
+		return req, resp, eventResponse, fmt.Errorf("failed to encrypt result: %w", err)
+	}
+
+	eventResponse = nostr.Event{
+		Content:   ciphertext,
+		CreatedAt: nostr.Now(),
+		Kind:      nostr.KindNWCWalletResponse,
+		Tags:      nostr.Tags{{"p", event.PubKey}, {"e", event.ID}},
+	}
+	err = eventResponse.Sign(s.secretKey)
+
+	return req, resp, eventResponse, err
+}
+
+func (s *Service) call(ctx context.Context, client string, req Request) (any, error) {
+	params := req.Params
+	if len(params) == 0 {
+		params = json.RawMessage("{}")
+	}
+
+	switch req.Method {
+	case MethodPayInvoice:
+		var p PayInvoiceParams
+		if err := json.Unmarshal(params, &p); err != nil || p.Invoice == "" {
+			return nil, &Error{ErrCodeOther, "invalid params"}
+		}
+		return s.wallet.PayInvoice(ctx, client, p)
+	case MethodMakeInvoice:
+		var p MakeInvoiceParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &Error{ErrCodeOther, "invalid params"}
+		}
+		return s.wallet.MakeInvoice(ctx, client, p)
+	case MethodGetBalance:
+		balance, err := s.wallet.GetBalance(ctx, client)
+		return GetBalanceResult{Balance: balance}, err
+	case MethodLookupInvoice:
+		var p LookupInvoiceParams
+		if err := json.Unmarshal(params, &p); err != nil || (p.PaymentHash == "" && p.Invoice == "") {
+			return nil, &Error{ErrCodeOther, "invalid params"}
+		}
+		return s.wallet.LookupInvoice(ctx, client, p)
+	case MethodListTransactions:
+		var p ListTransactionsParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &Error{ErrCodeOther, "invalid params"}
+		}
+		txs, err := s.wallet.ListTransactions(ctx, client, p)
+		return listTransactionsResult{Transactions: txs}, err
+	case MethodGetInfo:
+		return GetInfoResult{Methods: s.Methods}, nil
+	default:
+		return nil, &Error{ErrCodeNotImplemented, "method '" + req.Method + "' is not supported"}
+	}
+}
@@ -72,33 +72,58 @@ func Decrypt(bech32string string, password string) (secretKey string, err error)
 }
 
 func DecryptToBytes(bech32string string, password string) (secretKey []byte, err error) {
-	prefix, bits5, err := bech32.DecodeNoLimit(bech32string)
+	encrypted, err := Parse(bech32string)
 	if err != nil {
 		return nil, err
 	}
+	return encrypted.Decrypt(password)
+}
+
+// EncryptedKey is a decoded ncryptsec, that can still only be decrypted with the password.
+type EncryptedKey struct {
+	LogN            uint8
+	Salt            []byte
+	Nonce           []byte
+	KeySecurityByte KeySecurityByte
+	Ciphertext      []byte
+}
+
+// Parse decodes an ncryptsec code without decrypting it.
+func Parse(bech32string string) (EncryptedKey, error) {
+	prefix, bits5, err := bech32.DecodeNoLimit(bech32string)
+	if err != nil {
+		return EncryptedKey{}, err
+	}
 	if prefix != "ncryptsec" {
-		return nil, fmt.Errorf("expected prefix ncryptsec1")
+		return EncryptedKey{}, fmt.Errorf("expected prefix ncryptsec1")
 	}
 
 	data, err := bech32.ConvertBits(bits5, 5, 8, false)
 	if err != nil {
-		return nil, fmt.Errorf("failed translating data into 8 bits: %s", err.Error())
+		return EncryptedKey{}, fmt.Errorf("failed translating data into 8 bits: %s", err.Error())
+	}
+	if len(data) < 2+16+24+1+16 {
+		return EncryptedKey{}, fmt.Errorf("ncryptsec is too short (%d bytes)", len(data))
 	}
 
 	version := data[0]
 	if version != 0x02 {
-		return nil, fmt.Errorf("expected version 0x02, got %v", version)
+		return EncryptedKey{}, fmt.Errorf("expected version 0x02, got %v", version)
 	}
 
-	logn := data[1]
-	n := int(math.Pow(2, float64(int(logn))))
-	salt := data[2 : 2+16]
-	nonce := data[2+16 : 2+16+24]
-	ad := data[2+16+24 : 2+16+24+1]
-	// keySecurityByte := ad[0]
-	encryptedKey := data[2+16+24+1:]
+	return EncryptedKey{
+		LogN:            data[1],
+		Salt:            data[2 : 2+16],
+		Nonce:           data[2+16 : 2+16+24],
+		KeySecurityByte: KeySecurityByte(data[2+16+24]),
+		Ciphertext:      data[2+16+24+1:],
+	}, nil
+}
 
-	key, err := getKey(password, salt, n)
+// Decrypt returns the secret key, if the password is right.
+func (ek EncryptedKey) Decrypt(password string) (secretKey []byte, err error) {
+	n := int(math.Pow(2, float64(int(ek.LogN))))
+	key, err := getKey(password, ek.Salt, n)
 	if err != nil {
 		return nil, err
 	}
@@ -108,7 +133,7 @@ func DecryptToBytes(bech32string string, password string) (secretKey []byte, err
 		return nil, fmt.Errorf("failed to start xchacha20poly1305: %w", err)
 	}
 
-	return c2p1.Open(nil, nonce, encryptedKey, ad)
+	return c2p1.Open(nil, ek.Nonce, ek.Ciphertext, []byte{byte(ek.KeySecurityByte)})
 }
 
 func getKey(password string, salt []byte, n int) ([]byte, error) {
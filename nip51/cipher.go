@@ -0,0 +1,48 @@
+package nip51
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip04"
+	"github.com/nbd-wtf/go-nostr/nip44"
+)
+
+var _ Cipher = (*KeyCipher)(nil)
+
+// KeyCipher encrypts private items to self using a secret key. It encrypts with NIP-44,
+// but also decrypts lists that were encrypted with the legacy NIP-04 scheme.
+type KeyCipher struct {
+	nip04Key []byte
+	nip44Key []byte
+}
+
+func NewKeyCipher(secretKey string) (*KeyCipher, error) {
+	pubkey, err := nostr.GetPublicKey(secretKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret key: %w", err)
+	}
+
+	nip04Key, err := nip04.ComputeSharedSecret(pubkey, secretKey)
+	if err != nil {
+		return nil, err
+	}
+	nip44Key, err := nip44.GenerateConversationKey(pubkey, secretKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KeyCipher{nip04Key: nip04Key, nip44Key: nip44Key}, nil
+}
+
+func (k *KeyCipher) Encrypt(plaintext string) (string, error) {
+	return nip44.Encrypt(plaintext, k.nip44Key)
+}
+
+func (k *KeyCipher) Decrypt(ciphertext string) (string, error) {
+	if strings.Contains(ciphertext, "?iv=") {
+		return nip04.Decrypt(ciphertext, k.nip04Key)
+	}
+	return nip44.Decrypt(ciphertext, k.nip44Key)
+}
@@ -0,0 +1,196 @@
+// Package nip51 implements NIP-51 lists.
+// See https://github.com/nostr-protocol/nips/blob/master/51.md for details.
+package nip51
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// ItemTags are the tag names that are considered list items for each standard list kind.
+// Other tags (like "d", "title" or "image") are metadata and are kept untouched.
+var ItemTags = map[int][]string{
+	nostr.KindMuteList:                 {"p", "t", "word", "e"},
+	nostr.KindPinList:                  {"e"},
+	nostr.KindRelayListMetadata:        {"r"},
+	nostr.KindBookmarkList:             {"e", "a", "t", "r"},
+	nostr.KindCommunityList:            {"a"},
+	nostr.KindPublicChatList:           {"e"},
+	nostr.KindBlockedRelayList:         {"relay"},
+	nostr.KindSearchRelayList:          {"relay"},
+	nostr.KindSimpleGroupList:          {"group", "r"},
+	nostr.KindInterestList:             {"t", "a"},
+	nostr.KindEmojiList:                {"emoji", "a"},
+	nostr.KindCategorizedPeopleList:    {"p"},
+	nostr.KindCategorizedBookmarksList: {"e", "a", "t", "r"},
+	nostr.KindRelaySets:                {"relay"},
+	nostr.KindBookmarkSets:             {"e", "a", "t", "r"},
+	nostr.KindCurationSets:             {"a", "e"},
+	nostr.KindInterestSets:             {"t"},
+	nostr.KindEmojiSets:                {"emoji"},
+}
+
+// metadataTags are never items, used for kinds that are not in ItemTags.
+var metadataTags = []string{"d", "title", "description", "image", "alt", "client"}
+
+// Cipher encrypts and decrypts the private items of a list, which are encrypted by the list
+// author to themselves. It is usually backed by a secret key (see KeyCipher) or a remote signer.
+type Cipher interface {
+	Encrypt(plaintext string) (string, error)
+	Decrypt(ciphertext string) (string, error)
+}
+
+// List is a parsed NIP-51 list. Public holds all the event tags as they were, including
+// metadata tags, while Private holds the items that were encrypted in the content.
+type List struct {
+	Kind    int
+	Public  nostr.Tags
+	Private nostr.Tags
+
+	content        string // the original encrypted content
+	undecrypted    bool   // there was content but no cipher to read it
+	privateChanged bool
+}
+
+// ParseList reads a list event. cipher can be nil, in which case the private items
+// won't be read, but they will be preserved if the list is modified and turned into
+// an event again, as long as no private items are added or removed.
+func ParseList(event *nostr.Event, cipher Cipher) (*List, error) {
+	list := &List{
+		Kind:    event.Kind,
+		Public:  slices.Clone(event.Tags),
+		content: event.Content,
+	}
+	list.undecrypted = cipher == nil && event.Content != ""
+
+	if cipher != nil && event.Content != "" {
+		plain, err := cipher.Decrypt(event.Content)
+		if err != nil {
+			return list, fmt.Errorf("failed to decrypt private items: %w", err)
+		}
+		if err := json.Unmarshal([]byte(plain), &list.Private); err != nil {
+			return list, fmt.Errorf("failed to decode private items: %w", err)
+		}
+	}
+
+	return list, nil
+}
+
+// Identifier is the "d" tag of sets, empty for standard lists.
+func (l List) Identifier() string { return l.Public.GetD() }
+
+func (l List) Title() string       { return l.metadata("title") }
+func (l List) Description() string { return l.metadata("description") }
+func (l List) Image() string       { return l.metadata("image") }
+
+func (l List) metadata(name string) string {
+	if tag := l.Public.GetFirst([]string{name, ""}); tag != nil {
+		return (*tag)[1]
+	}
+	return ""
+}
+
+// IsItem tells if a tag is a list item for this list kind (as opposed to a metadata tag).
+func (l List) IsItem(tag nostr.Tag) bool {
+	if len(tag) < 2 {
+		return false
+	}
+	if names, ok := ItemTags[l.Kind]; ok {
+		return slices.Contains(names, tag[0])
+	}
+	return !slices.Contains(metadataTags, tag[0])
+}
+
+// Items returns all the public and private items, public ones first.
+func (l List) Items() nostr.Tags {
+	items := make(nostr.Tags, 0, len(l.Public)+len(l.Private))
+	for _, tag := range l.Public {
+		if l.IsItem(tag) {
+			items = append(items, tag)
+		}
+	}
+	for _, tag := range l.Private {
+		if l.IsItem(tag) {
+			items = append(items, tag)
+		}
+	}
+	return items
+}
+
+// Contains checks if there is a public or private item with the given name and value,
+// e.g. Contains("p", pubkey) on a mute list.
+func (l List) Contains(name string, value string) bool {
+	return l.Public.GetFirst([]string{name, value}) != nil || l.Private.GetFirst([]string{name, value}) != nil
+}
+
+// Add adds an item to the public or private part of the list, does nothing if there
+// is already an item with the same name and value.
+func (l *List) Add(item nostr.Tag, private bool) {
+	if private {
+		n := len(l.Private)
+		l.Private = l.Private.AppendUnique(item)
+		if len(l.Private) != n {
+			l.privateChanged = true
+		}
+	} else {
+		l.Public = l.Public.AppendUnique(item)
+	}
+}
+
+// Remove removes all public and private items with the given name and value.
+func (l *List) Remove(name string, value string) {
+	l.Public = removeExact(l.Public, name, value)
+
+	n := len(l.Private)
+	l.Private = removeExact(l.Private, name, value)
+	if len(l.Private) != n {
+		l.privateChanged = true
+	}
+}
+
+// ToEvent returns a new unsigned event with the current state of the list.
+// cipher is only needed if there are private items. Lists that were parsed without a cipher
+// keep their private items as they were, and fail if they were changed, even if one is given here.
+func (l *List) ToEvent(cipher Cipher) (nostr.Event, error) {
+	evt := nostr.Event{
+		CreatedAt: nostr.Now(),
+		Kind:      l.Kind,
+		Tags:      slices.Clone(l.Public),
+		Content:   l.content,
+	}
+
+	switch {
+	case l.undecrypted && l.privateChanged:
+		return evt, fmt.Errorf("private items were changed but they were never decrypted")
+	case l.undecrypted:
+		// keep the content as it was, we don't know what is in it
+	case len(l.Private) == 0 && (l.privateChanged || cipher != nil):
+		// all private items were removed (or there were none)
+		evt.Content = ""
+	case cipher != nil:
+		jprivate, _ := json.Marshal(l.Private)
+		ciphertext, err := cipher.Encrypt(string(jprivate))
+		if err != nil {
+			return evt, fmt.Errorf("failed to encrypt private items: %w", err)
+		}
+		evt.Content = ciphertext
+	case l.privateChanged:
+		return evt, fmt.Errorf("private items were changed, a cipher is needed")
+	}
+
+	return evt, nil
+}
+
+func removeExact(tags nostr.Tags, name string, value string) nostr.Tags {
+	filtered := make(nostr.Tags, 0, len(tags))
+	for _, tag := range tags {
+		if len(tag) >= 2 && tag[0] == name && tag[1] == value {
+			continue
+		}
+		filtered = append(filtered, tag)
+	}
+	return filtered
+}
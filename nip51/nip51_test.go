@@ -0,0 +1,114 @@
+package nip51
+
+import (
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip04"
+)
+
+func TestMuteList(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	cipher, err := NewKeyCipher(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privateContent, _ := cipher.Encrypt(`[["p","07caba282f76441955b695551c3c5c742e5b9202a3784780f8086fdcdc1da3a9"],["word","nsfw"]]`)
+	evt := nostr.Event{
+		Kind: nostr.KindMuteList,
+		Tags: nostr.Tags{
+			{"p", "3bf0c63fcb93463407af97a5e5ee64fa883d107ef9e558472c4eb9aaaefa459d"},
+			{"t", "politics"},
+			{"client", "some-client"},
+		},
+		Content: privateContent,
+	}
+	evt.Sign(sk)
+
+	list, err := ParseList(&evt, cipher)
+	if err != nil {
+		t.Fatalf("failed to parse: %s", err)
+	}
+	if items := list.Items(); len(items) != 4 {
+		t.Fatalf("expected 4 items, got %v", items)
+	}
+	if !list.Contains("word", "nsfw") || !list.Contains("t", "politics") {
+		t.Fatalf("should contain both public and private items")
+	}
+
+	list.Add(nostr.Tag{"p", "3bf0c63fcb93463407af97a5e5ee64fa883d107ef9e558472c4eb9aaaefa459d"}, false) // duplicate
+	list.Add(nostr.Tag{"e", "3fc3645b439ce8e7f2553a69e5267081d96dcd340693afabe04be7b0ccd178df"}, true)
+	list.Remove("word", "nsfw")
+
+	updated, err := list.ToEvent(cipher)
+	if err != nil {
+		t.Fatalf("failed to make event: %s", err)
+	}
+	if updated.Tags.GetFirst([]string{"client", "some-client"}) == nil {
+		t.Fatalf("unknown tags should have been preserved")
+	}
+	if len(updated.Tags) != 3 {
+		t.Fatalf("public tags shouldn't have changed: %v", updated.Tags)
+	}
+
+	updated.Sign(sk)
+	again, err := ParseList(&updated, cipher)
+	if err != nil {
+		t.Fatalf("failed to parse again: %s", err)
+	}
+	if len(again.Private) != 2 || again.Contains("word", "nsfw") ||
+		!again.Contains("e", "3fc3645b439ce8e7f2553a69e5267081d96dcd340693afabe04be7b0ccd178df") {
+		t.Fatalf("wrong private items: %v", again.Private)
+	}
+
+	// without a cipher we can still change public items and keep the private ones
+	blind, _ := ParseList(&updated, nil)
+	blind.Add(nostr.Tag{"t", "sports"}, false)
+	blindEvt, err := blind.ToEvent(nil)
+	if err != nil || blindEvt.Content != updated.Content {
+		t.Fatalf("private content should be kept as it was: %v", err)
+	}
+	// a cipher given only now must not erase the private items that were never read
+	blindEvt, err = blind.ToEvent(cipher)
+	if err != nil || blindEvt.Content != updated.Content {
+		t.Fatalf("private content should be kept as it was with a late cipher: %v", err)
+	}
+	blind.Add(nostr.Tag{"t", "news"}, true)
+	if _, err := blind.ToEvent(nil); err == nil {
+		t.Fatalf("changing private items without a cipher should fail")
+	}
+	if _, err := blind.ToEvent(cipher); err == nil {
+		t.Fatalf("changing private items that were never decrypted should fail")
+	}
+}
+
+func TestLegacyEncryptionAndSets(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(sk)
+	cipher, _ := NewKeyCipher(sk)
+
+	key, _ := nip04.ComputeSharedSecret(pk, sk)
+	content, _ := nip04.Encrypt(`[["relay","wss://secret.relay.com"]]`, key)
+	evt := nostr.Event{
+		Kind: nostr.KindRelaySets,
+		Tags: nostr.Tags{
+			{"d", "my-relays"},
+			{"title", "My Relays"},
+			{"relay", "wss://nos.lol"},
+		},
+		Content: content,
+	}
+
+	list, err := ParseList(&evt, cipher)
+	if err != nil {
+		t.Fatalf("failed to parse nip04 list: %s", err)
+	}
+	if list.Identifier() != "my-relays" || list.Title() != "My Relays" || list.Image() != "" {
+		t.Fatalf("wrong metadata")
+	}
+	items := list.Items()
+	if len(items) != 2 || items[0][1] != "wss://nos.lol" || items[1][1] != "wss://secret.relay.com" {
+		t.Fatalf("wrong items: %v", items)
+	}
+}
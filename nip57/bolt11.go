@@ -0,0 +1,136 @@
+package nip57
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil/bech32"
+)
+
+// Bolt11 contains the parts of a BOLT-11 Lightning invoice that are relevant for zaps.
+// The invoice signature is not verified.
+type Bolt11 struct {
+	Network         string // "bc", "tb", "bcrt" etc.
+	AmountMsat      int64  // 0 when the invoice doesn't specify an amount
+	Timestamp       int64
+	PaymentHash     string
+	DescriptionHash string
+	Description     string
+}
+
+// DecodeBolt11Amount returns the amount in millisatoshis encoded in the prefix of a BOLT-11 invoice.
+func DecodeBolt11Amount(invoice string) (int64, error) {
+	invoice = strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(invoice, "lightning:"), "LIGHTNING:"))
+	sep := strings.LastIndexByte(invoice, '1')
+	if sep == -1 || !strings.HasPrefix(invoice, "ln") {
+		return 0, fmt.Errorf("invalid invoice")
+	}
+	_, amount, err := parseBolt11Prefix(invoice[0:sep])
+	return amount, err
+}
+
+// DecodeBolt11 decodes a BOLT-11 invoice, it only reads the amount, timestamp and
+// payment and description fields, the signature is ignored.
+func DecodeBolt11(invoice string) (Bolt11, error) {
+	var b Bolt11
+
+	invoice = strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(invoice, "lightning:"), "LIGHTNING:"))
+	hrp, data, err := bech32.DecodeNoLimit(invoice)
+	if err != nil {
+		return b, fmt.Errorf("invalid invoice: %w", err)
+	}
+
+	b.Network, b.AmountMsat, err = parseBolt11Prefix(hrp)
+	if err != nil {
+		return b, err
+	}
+
+	// 7 words of timestamp at the start and 104 words of signature at the end
+	if len(data) < 7+104 {
+		return b, fmt.Errorf("invoice is too short")
+	}
+	for _, w := range data[0:7] {
+		b.Timestamp = b.Timestamp<<5 | int64(w)
+	}
+
+	fields := data[7 : len(data)-104]
+	for len(fields) >= 3 {
+		typ := fields[0]
+		length := int(fields[1])<<5 | int(fields[2])
+		if len(fields) < 3+length {
+			return b, fmt.Errorf("invalid tagged field length")
+		}
+		value := fields[3 : 3+length]
+		fields = fields[3+length:]
+
+		switch typ {
+		case 1: // p
+			if v, err := bech32.ConvertBits(value, 5, 8, false); err == nil && len(v) == 32 {
+				b.PaymentHash = hex.EncodeToString(v)
+			}
+		case 23: // h
+			if v, err := bech32.ConvertBits(value, 5, 8, false); err == nil && len(v) == 32 {
+				b.DescriptionHash = hex.EncodeToString(v)
+			}
+		case 13: // d
+			if v, err := bech32.ConvertBits(value, 5, 8, false); err == nil {
+				b.Description = string(v)
+			}
+		}
+	}
+
+	return b, nil
+}
+
+// parseBolt11Prefix reads "ln" + network + optional amount and multiplier.
+func parseBolt11Prefix(hrp string) (network string, amountMsat int64, err error) {
+	if !strings.HasPrefix(hrp, "ln") {
+		return "", 0, fmt.Errorf("invalid invoice prefix '%s'", hrp)
+	}
+	hrp = hrp[2:]
+
+	amountStart := strings.IndexAny(hrp, "0123456789")
+	if amountStart == -1 {
+		return hrp, 0, nil
+	}
+	network = hrp[0:amountStart]
+	amount := hrp[amountStart:]
+
+	var multiplier byte
+	if last := amount[len(amount)-1]; last < '0' || last > '9' {
+		multiplier = last
+		amount = amount[0 : len(amount)-1]
+	}
+
+	n, err := strconv.ParseInt(amount, 10, 64)
+	if err != nil {
+		return network, 0, fmt.Errorf("invalid invoice amount '%s': %w", amount, err)
+	}
+
+	var msats int64
+	switch multiplier {
+	case 0:
+		msats = 100_000_000_000
+	case 'm':
+		msats = 100_000_000
+	case 'u':
+		msats = 100_000
+	case 'n':
+		msats = 100
+	case 'p':
+		if n%10 != 0 {
+			return network, 0, fmt.Errorf("invalid sub-millisatoshi invoice amount")
+		}
+		return network, n / 10, nil
+	default:
+		return network, 0, fmt.Errorf("invalid invoice multiplier '%c'", multiplier)
+	}
+
+	if n > math.MaxInt64/msats {
+		return network, 0, fmt.Errorf("invoice amount '%s' is too big", hrp[amountStart:])
+	}
+	return network, n * msats, nil
+}
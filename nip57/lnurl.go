@@ -0,0 +1,189 @@
+package nip57
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// PayParams is the response of a LNURL-pay endpoint, as in LUD-06, with the
+// NIP-57 additions.
+type PayParams struct {
+	Callback       string `json:"callback"`
+	MinSendable    int64  `json:"minSendable"`
+	MaxSendable    int64  `json:"maxSendable"`
+	Metadata       string `json:"metadata"`
+	Tag            string `json:"tag"`
+	CommentAllowed int    `json:"commentAllowed,omitempty"`
+	AllowsNostr    bool   `json:"allowsNostr"`
+	NostrPubkey    string `json:"nostrPubkey"`
+
+	// LNURL is the bech32-encoded URL these params were fetched from.
+	LNURL string `json:"-"`
+}
+
+type lnurlError struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+// EncodeLNURL encodes an URL as a bech32 "lnurl1..." string.
+func EncodeLNURL(u string) (string, error) {
+	bits5, err := bech32.ConvertBits([]byte(u), 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	return bech32.Encode("lnurl", bits5)
+}
+
+// DecodeLNURL decodes a bech32 "lnurl1..." string into the URL it represents.
+func DecodeLNURL(lnurl string) (string, error) {
+	prefix, bits5, err := bech32.DecodeNoLimit(strings.ToLower(lnurl))
+	if err != nil {
+		return "", err
+	}
+	if prefix != "lnurl" {
+		return "", fmt.Errorf("expected prefix lnurl1, got %s", prefix)
+	}
+	data, err := bech32.ConvertBits(bits5, 5, 8, false)
+	if err != nil {
+		return "", fmt.Errorf("failed translating data into 8 bits: %w", err)
+	}
+	return string(data), nil
+}
+
+// LNURLFromAddress takes a lightning address (LUD-16), a bech32 "lnurl1..." or a plain
+// URL and returns the URL of the LNURL-pay endpoint it refers to.
+func LNURLFromAddress(address string) (string, error) {
+	address = strings.TrimPrefix(strings.TrimSpace(address), "lightning:")
+
+	if strings.HasPrefix(strings.ToLower(address), "lnurl1") {
+		return DecodeLNURL(address)
+	}
+
+	if strings.HasPrefix(address, "https://") || strings.HasPrefix(address, "http://") {
+		return address, nil
+	}
+
+	name, domain, found := strings.Cut(address, "@")
+	if !found || name == "" || domain == "" {
+		return "", fmt.Errorf("'%s' is not a lightning address or lnurl", address)
+	}
+	return "https://" + domain + "/.well-known/lnurlp/" + name, nil
+}
+
+// FetchPayParams fetches the LNURL-pay parameters for a lightning address, lnurl or URL.
+// Use the returned NostrPubkey to validate zap receipts.
+func FetchPayParams(ctx context.Context, address string) (*PayParams, error) {
+	u, err := LNURLFromAddress(address)
+	if err != nil {
+		return nil, err
+	}
+
+	var params PayParams
+	if err := getJSON(ctx, u, &params); err != nil {
+		return nil, err
+	}
+
+	if params.Tag != "payRequest" {
+		return nil, fmt.Errorf("not a lnurl-pay endpoint (tag is '%s')", params.Tag)
+	}
+	if params.Callback == "" {
+		return nil, fmt.Errorf("lnurl-pay endpoint has no callback")
+	}
+
+	params.LNURL, _ = EncodeLNURL(u)
+	return &params, nil
+}
+
+// FetchInvoice calls the LNURL-pay callback asking for an invoice of amountMsat. If zapRequest is
+// given (it must be signed) it is sent along so the provider will publish a zap receipt once paid.
+func (params PayParams) FetchInvoice(ctx context.Context, amountMsat int64, zapRequest *nostr.Event) (string, error) {
+	if amountMsat < params.MinSendable || (params.MaxSendable > 0 && amountMsat > params.MaxSendable) {
+		return "", fmt.Errorf("amount %d is out of the allowed range (%d-%d)",
+			amountMsat, params.MinSendable, params.MaxSendable)
+	}
+
+	callback, err := url.Parse(params.Callback)
+	if err != nil {
+		return "", fmt.Errorf("invalid callback '%s': %w", params.Callback, err)
+	}
+
+	qs := callback.Query()
+	qs.Set("amount", strconv.FormatInt(amountMsat, 10))
+	if zapRequest != nil {
+		if !params.AllowsNostr {
+			return "", fmt.Errorf("lnurl provider doesn't support zaps")
+		}
+		qs.Set("nostr", zapRequest.String())
+		if params.LNURL != "" {
+			qs.Set("lnurl", params.LNURL)
+		}
+	}
+	callback.RawQuery = qs.Encode()
+
+	var res struct {
+		PR string `json:"pr"`
+	}
+	if err := getJSON(ctx, callback.String(), &res); err != nil {
+		return "", err
+	}
+	if res.PR == "" {
+		return "", fmt.Errorf("lnurl callback returned no invoice")
+	}
+
+	// check the invoice is really for the amount we asked
+	if invoiceAmount, err := DecodeBolt11Amount(res.PR); err != nil {
+		return "", fmt.Errorf("lnurl callback returned an invalid invoice: %w", err)
+	} else if invoiceAmount != amountMsat {
+		return "", fmt.Errorf("lnurl callback returned an invoice for %d, but we asked for %d", invoiceAmount, amountMsat)
+	}
+
+	return res.PR, nil
+}
+
+func getJSON(ctx context.Context, u string, result any) error {
+	if _, ok := ctx.Deadline(); !ok {
+		// if no timeout is set, force it to 7 seconds
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, 7*time.Second)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create a request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("invalid json: %w", err)
+	}
+
+	var lerr lnurlError
+	if json.Unmarshal(body, &lerr) == nil && strings.ToUpper(lerr.Status) == "ERROR" {
+		return fmt.Errorf("lnurl error: %s", lerr.Reason)
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("request failed with status %d", resp.StatusCode)
+	}
+
+	if err := json.Unmarshal(body, result); err != nil {
+		return fmt.Errorf("invalid json: %w", err)
+	}
+	return nil
+}
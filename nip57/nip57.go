@@ -0,0 +1,200 @@
+// Package nip57 implements NIP-57 Lightning zaps.
+// See https://github.com/nostr-protocol/nips/blob/master/57.md for details.
+package nip57
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+
+	"github.com/mailru/easyjson"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// ZapRequestParams are the things needed to build a zap request.
+// Either EventID or Address (a "<kind>:<pubkey>:<d>" string) can be set to zap a specific event,
+// otherwise the zap is for the Recipient profile.
+type ZapRequestParams struct {
+	Recipient  string
+	EventID    string
+	Address    string
+	AmountMsat int64
+	Relays     []string
+	LNURL      string
+	Comment    string
+}
+
+// CreateZapRequest builds an unsigned kind 9734 zap request.
+func CreateZapRequest(params ZapRequestParams) nostr.Event {
+	relays := nostr.Tag{"relays"}
+	relays = append(relays, params.Relays...)
+
+	tags := nostr.Tags{relays}
+	if params.AmountMsat > 0 {
+		tags = append(tags, nostr.Tag{"amount", strconv.FormatInt(params.AmountMsat, 10)})
+	}
+	if params.LNURL != "" {
+		tags = append(tags, nostr.Tag{"lnurl", params.LNURL})
+	}
+	tags = append(tags, nostr.Tag{"p", params.Recipient})
+	if params.EventID != "" {
+		tags = append(tags, nostr.Tag{"e", params.EventID})
+	}
+	if params.Address != "" {
+		tags = append(tags, nostr.Tag{"a", params.Address})
+	}
+
+	return nostr.Event{
+		CreatedAt: nostr.Now(),
+		Kind:      nostr.KindZapRequest,
+		Tags:      tags,
+		Content:   params.Comment,
+	}
+}
+
+// ValidateZapRequest checks a zap request as a LNURL server must do before issuing an invoice.
+// amountMsat is the amount that was requested in the callback, it is checked against the
+// "amount" tag if there is one.
+func ValidateZapRequest(zapRequest *nostr.Event, amountMsat int64) error {
+	if zapRequest.Kind != nostr.KindZapRequest {
+		return fmt.Errorf("zap request has kind %d, expected %d", zapRequest.Kind, nostr.KindZapRequest)
+	}
+	if ok, _ := zapRequest.CheckSignature(); !ok {
+		return fmt.Errorf("zap request has an invalid signature")
+	}
+
+	if ps := zapRequest.Tags.GetAll([]string{"p", ""}); len(ps) != 1 {
+		return fmt.Errorf("zap request must have exactly one \"p\" tag, has %d", len(ps))
+	} else if !nostr.IsValid32ByteHex(ps[0][1]) {
+		return fmt.Errorf("zap request \"p\" tag is invalid")
+	}
+	if es := zapRequest.Tags.GetAll([]string{"e", ""}); len(es) > 1 {
+		return fmt.Errorf("zap request must have at most one \"e\" tag, has %d", len(es))
+	}
+	if zapRequest.Tags.GetFirst([]string{"relays"}) == nil {
+		return fmt.Errorf("zap request has no \"relays\" tag")
+	}
+
+	if tag := zapRequest.Tags.GetFirst([]string{"amount", ""}); tag != nil {
+		requested, err := strconv.ParseInt((*tag)[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("zap request has an invalid amount '%s'", (*tag)[1])
+		}
+		if requested != amountMsat {
+			return fmt.Errorf("zap request amount %d doesn't match %d", requested, amountMsat)
+		}
+	}
+
+	return nil
+}
+
+// Zap is a validated zap receipt with the information from the zap request it embeds.
+type Zap struct {
+	Receipt *nostr.Event
+	Request *nostr.Event
+
+	AmountMsat int64
+	Sender     string // the pubkey that signed the zap request, may be an anonymous key
+	Recipient  string
+	EventID    string
+	Address    string
+	Comment    string
+}
+
+// ValidateZapReceipt checks a kind 9735 zap receipt: it must have been signed by the nostrPubkey
+// advertised by the recipient's LNURL provider (see [FetchPayParams]), embed a valid zap request in
+// its "description" and carry an invoice committing to that description (with its hash) and to the
+// requested amount.
+func ValidateZapReceipt(receipt *nostr.Event, nostrPubkey string) (*Zap, error) {
+	if receipt.Kind != nostr.KindZap {
+		return nil, fmt.Errorf("zap receipt has kind %d, expected %d", receipt.Kind, nostr.KindZap)
+	}
+	if receipt.PubKey != nostrPubkey {
+		return nil, fmt.Errorf("zap receipt was signed by %s, not by the lnurl provider %s", receipt.PubKey, nostrPubkey)
+	}
+	if ok, _ := receipt.CheckSignature(); !ok {
+		return nil, fmt.Errorf("zap receipt has an invalid signature")
+	}
+
+	descriptionTag := receipt.Tags.GetFirst([]string{"description", ""})
+	if descriptionTag == nil {
+		return nil, fmt.Errorf("zap receipt has no \"description\" tag")
+	}
+	description := (*descriptionTag)[1]
+
+	bolt11Tag := receipt.Tags.GetFirst([]string{"bolt11", ""})
+	if bolt11Tag == nil {
+		return nil, fmt.Errorf("zap receipt has no \"bolt11\" tag")
+	}
+	invoice, err := DecodeBolt11((*bolt11Tag)[1])
+	if err != nil {
+		return nil, fmt.Errorf("zap receipt has an invalid invoice: %w", err)
+	}
+	if invoice.DescriptionHash == "" {
+		return nil, fmt.Errorf("invoice has no description hash")
+	}
+	if hash := sha256.Sum256([]byte(description)); invoice.DescriptionHash != hex.EncodeToString(hash[:]) {
+		return nil, fmt.Errorf("invoice description hash doesn't match the zap request")
+	}
+
+	request := &nostr.Event{}
+	if err := easyjson.Unmarshal([]byte(description), request); err != nil {
+		return nil, fmt.Errorf("zap receipt description is not a zap request: %w", err)
+	}
+	if err := ValidateZapRequest(request, invoice.AmountMsat); err != nil {
+		return nil, err
+	}
+
+	zap := &Zap{
+		Receipt:    receipt,
+		Request:    request,
+		AmountMsat: invoice.AmountMsat,
+		Sender:     request.PubKey,
+		Recipient:  request.Tags.GetFirst([]string{"p", ""}).Value(),
+		Comment:    request.Content,
+	}
+	if tag := request.Tags.GetFirst([]string{"e", ""}); tag != nil {
+		zap.EventID = (*tag)[1]
+	}
+	if tag := request.Tags.GetFirst([]string{"a", ""}); tag != nil {
+		zap.Address = (*tag)[1]
+	}
+
+	// the receipt must point to the same things as the request
+	if receipt.Tags.GetFirst([]string{"p", zap.Recipient}) == nil {
+		return nil, fmt.Errorf("zap receipt \"p\" tag doesn't match the zap request")
+	}
+	if zap.EventID != "" && receipt.Tags.GetFirst([]string{"e", zap.EventID}) == nil {
+		return nil, fmt.Errorf("zap receipt \"e\" tag doesn't match the zap request")
+	}
+	if zap.Address != "" && receipt.Tags.GetFirst([]string{"a", zap.Address}) == nil {
+		return nil, fmt.Errorf("zap receipt \"a\" tag doesn't match the zap request")
+	}
+
+	return zap, nil
+}
+
+// TotalsByEvent sums the zapped amounts (in millisatoshis) for each zapped event. Zaps are
+// keyed by their event id, or by their address when they target an addressable event.
+// Zaps to profiles are keyed by the recipient public key. The same receipt is only counted once.
+func TotalsByEvent(zaps []*Zap) map[string]int64 {
+	totals := make(map[string]int64, len(zaps))
+	seen := make(map[string]struct{}, len(zaps))
+	for _, zap := range zaps {
+		if _, ok := seen[zap.Receipt.ID]; ok {
+			continue
+		}
+		seen[zap.Receipt.ID] = struct{}{}
+
+		switch {
+		case zap.EventID != "":
+			totals[zap.EventID] += zap.AmountMsat
+		case zap.Address != "":
+			totals[zap.Address] += zap.AmountMsat
+		default:
+			totals[zap.Recipient] += zap.AmountMsat
+		}
+	}
+	return totals
+}
@@ -0,0 +1,246 @@
+package nip57
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"github.com/mailru/easyjson"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestDecodeBolt11(t *testing.T) {
+	// from the BOLT-11 examples
+	invoice := "lnbc20m1pvjluezpp5qqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqypqhp58yjmdan79s6qqdhdzgynm4zwqd5d7xmw5fk98klysy043l2ahrqscc6gd6ql3jrc5yzme8v4ntcewwz5cnw92tz0pc8qcuufvq7khhr8wpald05e92xw006sq94mg8v2ndf4sefvf9sygkshp5zfem29trqq2yxxz7"
+	b, err := DecodeBolt11(invoice)
+	if err != nil {
+		t.Fatalf("failed to decode: %s", err)
+	}
+	if b.AmountMsat != 2_000_000_000 {
+		t.Errorf("wrong amount: %d", b.AmountMsat)
+	}
+	if b.Network != "bc" || b.Timestamp != 1496314658 {
+		t.Errorf("wrong network or timestamp: %s %d", b.Network, b.Timestamp)
+	}
+	if b.PaymentHash != "0001020304050607080900010203040506070809000102030405060708090102" {
+		t.Errorf("wrong payment hash: %s", b.PaymentHash)
+	}
+	if b.DescriptionHash != "3925b6f67e2c340036ed12093dd44e0368df1b6ea26c53dbe4811f58fd5db8c1" {
+		t.Errorf("wrong description hash: %s", b.DescriptionHash)
+	}
+
+	for invoice, expected := range map[string]int64{
+		"lnbc2500u1pvjluezpp5qqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqypqdq5xysxxatsyp3k7enxv4jsxqzpuaztrnwngzn3kdzw5hydlzf03qdgm2hdq27cqv3agm2awhz5se903vruatfhq77w3ls4evs3ch9zw97j25emudupq63nyw24cg27h2rspfj9srp":                                  250_000_000,
+		"lnbc1pvjluezpp5qqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqypqdpl2pkx2ctnv5sxxmmwwd5kgetjypeh2ursdae8g6twvus8g6rfwvs8qun0dfjkxaq8rkx3yf5tcsyz3d73gafnh3cax9rn449d9p5uxz9ezhhypd0elx87sjle52x86fux2ypatgddc6k63n7erqz25le42c4u4ecky03ylcqca784w": 0,
+		"lnbc10n1xxx":  1_000,
+		"lnbc2500p1xx": 250,
+	} {
+		amount, err := DecodeBolt11Amount(invoice)
+		if err != nil {
+			t.Errorf("failed to decode amount of %s: %s", invoice, err)
+		}
+		if amount != expected {
+			t.Errorf("expected %d, got %d", expected, amount)
+		}
+	}
+
+	if _, err := DecodeBolt11Amount("lnbc2501p1xx"); err == nil {
+		t.Errorf("sub-millisatoshi amounts should fail")
+	}
+	if _, err := DecodeBolt11Amount("lnbc1000000000001xx"); err == nil {
+		t.Errorf("amounts that overflow int64 millisatoshis should fail")
+	}
+}
+
+func TestLNURL(t *testing.T) {
+	lnurl, err := EncodeLNURL("https://service.com/api?q=3fc3645b439ce8e7f2553a69e5267081d96dcd340693afabe04be7b0ccd178df")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := DecodeLNURL(lnurl)
+	if err != nil || u != "https://service.com/api?q=3fc3645b439ce8e7f2553a69e5267081d96dcd340693afabe04be7b0ccd178df" {
+		t.Fatalf("roundtrip failed: %s %v", u, err)
+	}
+
+	u, err = LNURLFromAddress("fiatjaf@zbd.gg")
+	if err != nil || u != "https://zbd.gg/.well-known/lnurlp/fiatjaf" {
+		t.Fatalf("wrong url from lightning address: %s %v", u, err)
+	}
+}
+
+func TestZapFlow(t *testing.T) {
+	senderSecretKey := nostr.GeneratePrivateKey()
+	recipientSecretKey := nostr.GeneratePrivateKey()
+	recipient, _ := nostr.GetPublicKey(recipientSecretKey)
+	providerSecretKey := nostr.GeneratePrivateKey()
+	provider, _ := nostr.GetPublicKey(providerSecretKey)
+	eventID := "3fc3645b439ce8e7f2553a69e5267081d96dcd340693afabe04be7b0ccd178df"
+
+	// fake lnurl provider that issues invoices and immediately emits receipts
+	var receipts []*nostr.Event
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	mux.HandleFunc("/.well-known/lnurlp/bob", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(PayParams{
+			Callback:    server.URL + "/callback",
+			MinSendable: 1000,
+			MaxSendable: 100_000_000,
+			Tag:         "payRequest",
+			AllowsNostr: true,
+			NostrPubkey: provider,
+		})
+	})
+	mux.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
+		description := r.URL.Query().Get("nostr")
+		zapRequest := &nostr.Event{}
+		if err := easyjson.Unmarshal([]byte(description), zapRequest); err != nil {
+			json.NewEncoder(w).Encode(lnurlError{"ERROR", "invalid zap request"})
+			return
+		}
+		amount, _ := strconv.ParseInt(r.URL.Query().Get("amount"), 10, 64)
+		if err := ValidateZapRequest(zapRequest, amount); err != nil {
+			json.NewEncoder(w).Encode(lnurlError{"ERROR", err.Error()})
+			return
+		}
+
+		invoice := makeTestInvoice(t, "lnbc210n", description)
+		receipt := &nostr.Event{
+			Kind:      nostr.KindZap,
+			CreatedAt: nostr.Now(),
+			Tags: nostr.Tags{
+				{"p", recipient},
+				{"e", eventID},
+				{"bolt11", invoice},
+				{"description", description},
+			},
+		}
+		receipt.Sign(providerSecretKey)
+		receipts = append(receipts, receipt)
+
+		json.NewEncoder(w).Encode(map[string]any{"pr": invoice, "routes": []string{}})
+	})
+
+	ctx := context.Background()
+	params, err := FetchPayParams(ctx, server.URL+"/.well-known/lnurlp/bob")
+	if err != nil {
+		t.Fatalf("failed to fetch pay params: %s", err)
+	}
+	if params.NostrPubkey != provider || !params.AllowsNostr {
+		t.Fatalf("wrong pay params: %v", params)
+	}
+
+	zapRequest := CreateZapRequest(ZapRequestParams{
+		Recipient:  recipient,
+		EventID:    eventID,
+		AmountMsat: 21000,
+		Relays:     []string{"wss://relay.example.com"},
+		LNURL:      params.LNURL,
+		Comment:    "great post",
+	})
+	zapRequest.Sign(senderSecretKey)
+
+	if _, err := params.FetchInvoice(ctx, 21000, &zapRequest); err != nil {
+		t.Fatalf("failed to get invoice: %s", err)
+	}
+	if _, err := params.FetchInvoice(ctx, 22000, &zapRequest); err == nil {
+		t.Fatalf("should have failed with a mismatched amount")
+	}
+
+	if len(receipts) != 1 {
+		t.Fatalf("expected one receipt, got %d", len(receipts))
+	}
+	zap, err := ValidateZapReceipt(receipts[0], params.NostrPubkey)
+	if err != nil {
+		t.Fatalf("receipt should be valid: %s", err)
+	}
+	if zap.AmountMsat != 21000 || zap.EventID != eventID || zap.Recipient != recipient || zap.Comment != "great post" {
+		t.Fatalf("wrong zap: %v", zap)
+	}
+
+	if _, err := ValidateZapReceipt(receipts[0], recipient); err == nil {
+		t.Fatalf("receipt from the wrong provider should be invalid")
+	}
+
+	totals := TotalsByEvent([]*Zap{zap, zap})
+	if totals[eventID] != 21000 {
+		t.Fatalf("wrong total: %d", totals[eventID])
+	}
+}
+
+func TestZapReceiptChecks(t *testing.T) {
+	providerSecretKey := nostr.GeneratePrivateKey()
+	provider, _ := nostr.GetPublicKey(providerSecretKey)
+	recipient := "3bf0c63fcb93463407af97a5e5ee64fa883d107ef9e558472c4eb9aaaefa459d"
+	address := "30023:" + recipient + ":article"
+
+	zapRequest := CreateZapRequest(ZapRequestParams{
+		Recipient:  recipient,
+		Address:    address,
+		AmountMsat: 21000,
+		Relays:     []string{"wss://relay.example.com"},
+	})
+	zapRequest.Sign(nostr.GeneratePrivateKey())
+	description := zapRequest.String()
+
+	// an invoice without a description hash doesn't commit to anything
+	noHash, _ := bech32.Encode("lnbc210n", make([]byte, 7+104))
+
+	for _, tc := range []struct {
+		name    string
+		invoice string
+		a       string
+		valid   bool
+	}{
+		{"good", makeTestInvoice(t, "lnbc210n", description), address, true},
+		{"no description hash", noHash, address, false},
+		{"other description", makeTestInvoice(t, "lnbc210n", "{}"), address, false},
+		{"other address", makeTestInvoice(t, "lnbc210n", description), "30023:" + recipient + ":other", false},
+	} {
+		receipt := &nostr.Event{
+			Kind:      nostr.KindZap,
+			CreatedAt: nostr.Now(),
+			Tags: nostr.Tags{
+				{"p", recipient},
+				{"a", tc.a},
+				{"bolt11", tc.invoice},
+				{"description", description},
+			},
+		}
+		receipt.Sign(providerSecretKey)
+
+		zap, err := ValidateZapReceipt(receipt, provider)
+		if tc.valid && (err != nil || zap.Address != address) {
+			t.Errorf("%s: receipt should be valid: %v", tc.name, err)
+		} else if !tc.valid && err == nil {
+			t.Errorf("%s: receipt should be invalid", tc.name)
+		}
+	}
+}
+
+// makeTestInvoice makes an invoice with a description hash and a bogus signature.
+func makeTestInvoice(t *testing.T, hrp string, description string) string {
+	t.Helper()
+
+	data := make([]byte, 7) // timestamp zero
+	hash := sha256.Sum256([]byte(description))
+	hash5, _ := bech32.ConvertBits(hash[:], 8, 5, true)
+	data = append(data, 23, byte(len(hash5)>>5), byte(len(hash5)&31))
+	data = append(data, hash5...)
+	data = append(data, make([]byte, 104)...)
+
+	invoice, err := bech32.Encode(hrp, data)
+	if err != nil {
+		t.Fatalf("failed to encode invoice: %s", err)
+	}
+	if b, _ := DecodeBolt11(invoice); b.DescriptionHash != hex.EncodeToString(hash[:]) {
+		t.Fatalf("test invoice is broken")
+	}
+	return invoice
+}
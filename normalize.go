@@ -6,7 +6,7 @@ import (
 )
 
 // NormalizeURL normalizes the url and replaces http://, https:// schemes with ws://, wss://
-// and normalizes the path.
+// and normalizes the path. URLs without a scheme get wss://, except for .onion hosts, which get ws://.
 func NormalizeURL(u string) string {
 	if u == "" {
 		return ""
@@ -15,14 +15,21 @@ func NormalizeURL(u string) string {
 	u = strings.TrimSpace(u)
 	u = strings.ToLower(u)
 
+	addedScheme := false
 	if !strings.HasPrefix(u, "http") && !strings.HasPrefix(u, "ws") {
 		u = "wss://" + u
+		addedScheme = true
 	}
 	p, err := url.Parse(u)
 	if err != nil {
 		return ""
 	}
 
+	// onion services are encrypted already and don't usually have certificates
+	if addedScheme && strings.HasSuffix(p.Hostname(), ".onion") {
+		p.Scheme = "ws"
+	}
+
 	if p.Scheme == "http" {
 		p.Scheme = "ws"
 	} else if p.Scheme == "https" {
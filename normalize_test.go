@@ -1,6 +1,9 @@
 package nostr
 
-import "fmt"
+import (
+	"fmt"
+	"testing"
+)
 
 func ExampleNormalizeURL() {
 	fmt.Println(NormalizeURL(""))
@@ -15,6 +18,8 @@ func ExampleNormalizeURL() {
 	fmt.Println(NormalizeURL("x.com/"))
 	fmt.Println(NormalizeURL("x.com////"))
 	fmt.Println(NormalizeURL("x.com/?x=23"))
+	fmt.Println(NormalizeURL("2gzyxa5ihm7nsggfxnu52rck2vv4rvmdlkiu3zzui5du4xyclen53wid.onion"))
+	fmt.Println(NormalizeURL("wss://2gzyxa5ihm7nsggfxnu52rck2vv4rvmdlkiu3zzui5du4xyclen53wid.onion/"))
 
 	// Output:
 	//
@@ -29,4 +34,24 @@ func ExampleNormalizeURL() {
 	// wss://x.com
 	// wss://x.com
 	// wss://x.com?x=23
+	// ws://2gzyxa5ihm7nsggfxnu52rck2vv4rvmdlkiu3zzui5du4xyclen53wid.onion
+	// wss://2gzyxa5ihm7nsggfxnu52rck2vv4rvmdlkiu3zzui5du4xyclen53wid.onion
+}
+
+func TestIsValidRelayURL(t *testing.T) {
+	for url, valid := range map[string]bool{
+		"wss://x.com":   true,
+		"ws://x.com/y":  true,
+		"https://x.com": false,
+		"wss://x":       false,
+		"ws://2gzyxa5ihm7nsggfxnu52rck2vv4rvmdlkiu3zzui5du4xyclen53wid.onion":       true,
+		"ws://relay.2gzyxa5ihm7nsggfxnu52rck2vv4rvmdlkiu3zzui5du4xyclen53wid.onion": true,
+		"ws://2GZYXA5IHM7NSGGFXNU52RCK2VV4RVMDLKIU3ZZUI5DU4XYCLEN53WID.onion:8080":  true,
+		"ws://x.onion": false,
+		"ws://2gzyxa5ihm7nsggfxnu52rck2vv4rvmdlkiu3zzui5du4xyclen53wi1.onion": false,
+	} {
+		if IsValidRelayURL(url) != valid {
+			t.Errorf("IsValidRelayURL(%q) should be %v", url, valid)
+		}
+	}
 }
@@ -0,0 +1,70 @@
+package nson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Subprotocol identifies Codec in the websocket handshake.
+const Subprotocol = "nostr.nson"
+
+// Codec sends and reads envelopes as normal JSON except for the events in EVENT envelopes, which
+// are encoded with Marshal and decoded with DecodeBytes, so events that don't fit in NSON still
+// work. Give it to nostr.WithCodecs and it will only be used with relays that agree to it in the
+// handshake, the others get plain JSON.
+type Codec struct{}
+
+func (_ Codec) Subprotocol() string { return Subprotocol }
+func (_ Codec) Binary() bool        { return false }
+
+func (_ Codec) AppendEnvelope(dst []byte, env nostr.Envelope) ([]byte, error) {
+	v, ok := env.(*nostr.EventEnvelope)
+	if !ok {
+		b, err := env.MarshalJSON()
+		if err != nil {
+			return dst, err
+		}
+		return append(dst, b...), nil
+	}
+
+	dst = append(dst, `["EVENT",`...)
+	if v.SubscriptionID != nil {
+		id, _ := json.Marshal(*v.SubscriptionID)
+		dst = append(dst, id...)
+		dst = append(dst, ',')
+	}
+	evt, err := Marshal(&v.Event)
+	if err != nil {
+		return dst, err
+	}
+	dst = append(dst, evt...)
+	return append(dst, ']'), nil
+}
+
+func (_ Codec) DecodeEnvelope(data []byte) (nostr.Envelope, error) {
+	if label, subID, rest, ok := nostr.PeekEnvelope(data); ok && label == "EVENT" {
+		end := bytes.LastIndexByte(rest, ']')
+		if end == -1 {
+			return nil, fmt.Errorf("invalid envelope")
+		}
+		env := &nostr.EventEnvelope{}
+		if subID != "" {
+			env.SubscriptionID = &subID
+		}
+		if err := DecodeBytes(rest[:end], &env.Event); err != nil {
+			return nil, fmt.Errorf("failed to decode event: %w", err)
+		}
+		return env, nil
+	}
+
+	env := nostr.ParseMessage(data)
+	if env == nil {
+		return nil, fmt.Errorf("invalid envelope")
+	}
+	return env, nil
+}
+
+var _ nostr.Codec = Codec{}
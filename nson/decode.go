@@ -0,0 +1,73 @@
+package nson
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"github.com/mailru/easyjson"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// IsNSON tells if data looks like an NSON event, without checking all of it.
+func IsNSON(data string) bool {
+	return len(data) > NSON_VALUES_START &&
+		data[0:ID_START] == `{"id":"` &&
+		data[NSON_MARKER_START:NSON_MARKER_END] == `,"nson":`
+}
+
+// Decode decodes an event that may or may not be in NSON: if it isn't, or if it looks like NSON
+// but fails to decode as such, it is decoded as normal JSON. Like Unmarshal, the event will keep
+// references to data.
+func Decode(data string, evt *nostr.Event) error {
+	if IsNSON(data) {
+		if err := Unmarshal(data, evt); err == nil {
+			return nil
+		}
+		*evt = nostr.Event{}
+	}
+	return easyjson.Unmarshal([]byte(data), evt)
+}
+
+// DecodeBytes is like Decode, but the event doesn't keep references to data, so the buffer can be reused.
+func DecodeBytes(data []byte, evt *nostr.Event) error {
+	if IsNSON(unsafeString(data)) {
+		if err := Unmarshal(string(data), evt); err == nil {
+			return nil
+		}
+		*evt = nostr.Event{}
+	}
+	return easyjson.Unmarshal(data, evt)
+}
+
+// Reader reads events from a file or stream with one event per line (JSON Lines), where each of
+// them can be either NSON or normal JSON. Empty lines are skipped.
+type Reader struct {
+	s *bufio.Scanner
+}
+
+// NewReader returns a Reader that accepts lines of up to maxLineSize bytes, or 1MB if it is zero.
+func NewReader(r io.Reader, maxLineSize int) *Reader {
+	if maxLineSize == 0 {
+		maxLineSize = 1 << 20
+	}
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 4096), maxLineSize)
+	return &Reader{s: s}
+}
+
+// Read decodes the next event into evt. It returns io.EOF when there are no more events.
+func (r *Reader) Read(evt *nostr.Event) error {
+	for r.s.Scan() {
+		line := bytes.TrimSpace(r.s.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		*evt = nostr.Event{}
+		return DecodeBytes(line, evt)
+	}
+	if err := r.s.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
@@ -4,10 +4,13 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 	"unsafe"
 
+	"github.com/mailru/easyjson"
 	"github.com/nbd-wtf/go-nostr"
 )
 
@@ -46,9 +49,11 @@ const (
 var ErrNotNSON = fmt.Errorf("not nson")
 
 func UnmarshalBytes(data []byte, evt *nostr.Event) (err error) {
-	return Unmarshal(unsafe.String(unsafe.SliceData(data), len(data)), evt)
+	return Unmarshal(unsafeString(data), evt)
 }
 
+func unsafeString(data []byte) string { return unsafe.String(unsafe.SliceData(data), len(data)) }
+
 // Unmarshal turns a NSON string into a nostr.Event struct.
 func Unmarshal(data string, evt *nostr.Event) (err error) {
 	defer func() {
@@ -58,7 +63,7 @@ func Unmarshal(data string, evt *nostr.Event) (err error) {
 	}()
 
 	// check if it's nson
-	if data[NSON_MARKER_START:NSON_MARKER_END] != ",\"nson\":" {
+	if !IsNSON(data) {
 		return ErrNotNSON
 	}
 
@@ -81,7 +86,9 @@ func Unmarshal(data string, evt *nostr.Event) (err error) {
 	// content
 	contentChars := int(binary.BigEndian.Uint16(nsonDescriptors[1:3]))
 	contentStart := kindStart + kindChars + 12 // len(`,"content":"`)
-	evt.Content, _ = strconv.Unquote(data[contentStart-1 : contentStart+contentChars+1])
+	if evt.Content, err = strconv.Unquote(data[contentStart-1 : contentStart+contentChars+1]); err != nil {
+		return fmt.Errorf("failed to decode nson content: %w", err)
+	}
 
 	// tags
 	nTags := int(nsonDescriptors[3])
@@ -100,7 +107,9 @@ func Unmarshal(data string, evt *nostr.Event) (err error) {
 			itemStart := tagsIndex + 2 // len(`["`) or len(`,"`)
 			itemChars := int(binary.BigEndian.Uint16(nsonDescriptors[nsonIndex:]))
 			nsonIndex++
-			tag[n], _ = strconv.Unquote(data[itemStart-1 : itemStart+itemChars+1])
+			if tag[n], err = strconv.Unquote(data[itemStart-1 : itemStart+itemChars+1]); err != nil {
+				return fmt.Errorf("failed to decode nson tag: %w", err)
+			}
 			tagsIndex = itemStart + itemChars + 1 // len(`"`)
 		}
 		tagsIndex += 1 // len(`]`)
@@ -115,7 +124,15 @@ func MarshalBytes(evt *nostr.Event) ([]byte, error) {
 	return unsafe.Slice(unsafe.StringData(v), len(v)), err
 }
 
+// Marshal encodes the event as NSON. Events that can't be represented in NSON (because they have
+// too many tags, huge tags or content, a created_at that isn't 10 digits long or characters that
+// would need special escaping) are encoded as normal JSON, which is fine for Decode.
 func Marshal(evt *nostr.Event) (string, error) {
+	if len(evt.ID) != 64 || len(evt.PubKey) != 64 || len(evt.Sig) != 128 ||
+		evt.CreatedAt < 1_000_000_000 || evt.CreatedAt > 9_999_999_999 || len(evt.Tags) > 255 {
+		return marshalJSON(evt)
+	}
+
 	// start building the nson descriptors (without the first byte that represents the nson size)
 	nsonBuf := make([]byte, 256)
 
@@ -129,12 +146,18 @@ func Marshal(evt *nostr.Event) (string, error) {
 	tagBuilder.WriteString(`[`)
 	for t, tag := range evt.Tags {
 		nItems := len(tag)
+		if nItems > 255 || nsonIndex+1+nItems*2 > 255 {
+			return marshalJSON(evt)
+		}
 		nsonIndex++
 		nsonBuf[nsonIndex] = uint8(nItems)
 
 		tagBuilder.WriteString(`[`)
 		for i, item := range tag {
-			v := strconv.Quote(item)
+			v, ok := quote(item)
+			if !ok {
+				return marshalJSON(evt)
+			}
 			nsonIndex++
 			binary.BigEndian.PutUint16(nsonBuf[nsonIndex:], uint16(len(v)-2))
 			nsonIndex++
@@ -155,7 +178,10 @@ func Marshal(evt *nostr.Event) (string, error) {
 	kindChars := len(kind)
 	nsonBuf[0] = uint8(kindChars)
 
-	content := strconv.Quote(evt.Content)
+	content, ok := quote(evt.Content)
+	if !ok {
+		return marshalJSON(evt)
+	}
 	contentChars := len(content) - 2
 	binary.BigEndian.PutUint16(nsonBuf[1:3], uint16(contentChars))
 
@@ -171,11 +197,7 @@ func Marshal(evt *nostr.Event) (string, error) {
 	base.WriteString(`{"id":"` + evt.ID + `","pubkey":"` + evt.PubKey + `","sig":"` + evt.Sig +
 		`","created_at":` + strconv.FormatInt(int64(evt.CreatedAt), 10) + `,"nson":"`)
 
-	nsonSizeBytes := len(nsonBuf)
-	if nsonSizeBytes > 255 {
-		return "", fmt.Errorf("can't encode to nson, there are too many tags or tag items")
-	}
-	base.WriteString(hex.EncodeToString([]byte{uint8(nsonSizeBytes)})) // nson size (bytes)
+	base.WriteString(hex.EncodeToString([]byte{uint8(len(nsonBuf))})) // nson size (bytes)
 
 	base.WriteString(hex.EncodeToString(nsonBuf)) // nson descriptors
 	base.WriteString(`","kind":` + kind + `,"content":` + content + `,"tags":`)
@@ -184,6 +206,26 @@ func Marshal(evt *nostr.Event) (string, error) {
 	return base.String(), nil
 }
 
+// quote quotes a string for NSON, which can only have things that are quoted the same way in Go
+// and in JSON and whose quoted length fits in the descriptors.
+func quote(s string) (string, bool) {
+	if !utf8.ValidString(s) {
+		return "", false
+	}
+	v := strconv.Quote(s)
+	if len(v)-2 > math.MaxUint16 ||
+		strings.Contains(v, `\x`) || strings.Contains(v, `\U`) ||
+		strings.Contains(v, `\a`) || strings.Contains(v, `\v`) {
+		return "", false
+	}
+	return v, true
+}
+
+func marshalJSON(evt *nostr.Event) (string, error) {
+	j, err := easyjson.Marshal(evt)
+	return string(j), err
+}
+
 func parseDescriptors(data string) (int, []byte) {
 	nsonSizeBytes, _ := hex.DecodeString(data[NSON_STRING_START:NSON_VALUES_START])
 	size := int(nsonSizeBytes[0]) * 2 // number of bytes is given, we x2 because the string is in hex
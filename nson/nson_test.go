@@ -1,9 +1,19 @@
 package nson
 
 import (
+	"context"
 	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
 	"github.com/mailru/easyjson"
 	"github.com/nbd-wtf/go-nostr"
 )
@@ -68,6 +78,88 @@ func TestNsonEncode(t *testing.T) {
 	}
 }
 
+func TestNsonFallback(t *testing.T) {
+	base := nostr.Event{}
+	json.Unmarshal([]byte(normalEvents[0]), &base)
+
+	manyTags := base
+	manyTags.Tags = make(nostr.Tags, 300)
+	for i := range manyTags.Tags {
+		manyTags.Tags[i] = nostr.Tag{"t", strconv.Itoa(i)}
+	}
+	longTag := base
+	longTag.Tags = nostr.Tags{{"x", strings.Repeat("z", 70000)}}
+	longContent := base
+	longContent.Content = strings.Repeat("z", 70000)
+	controlChars := base
+	controlChars.Content = "bell \a \x01 \v"
+	oldTimestamp := base
+	oldTimestamp.CreatedAt = 12345
+
+	for i, evt := range []nostr.Event{manyTags, longTag, longContent, controlChars, oldTimestamp} {
+		text, err := Marshal(&evt)
+		if err != nil {
+			t.Fatalf("%d: failed to encode: %s", i, err)
+		}
+		if IsNSON(text) {
+			t.Errorf("%d: should have fallen back to json", i)
+		}
+
+		decoded := nostr.Event{}
+		if err := Decode(text, &decoded); err != nil {
+			t.Fatalf("%d: failed to decode: %s", i, err)
+		}
+		if decoded.Content != evt.Content || decoded.CreatedAt != evt.CreatedAt || !reflect.DeepEqual(decoded.Tags, evt.Tags) {
+			t.Errorf("%d: decoded event is different", i)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	for _, jevt := range normalEvents {
+		evt := &nostr.Event{}
+		if err := Decode(jevt, evt); err != nil {
+			t.Fatalf("error decoding json: %s", err)
+		}
+		checkParsedCorrectly(t, evt, jevt)
+	}
+	for _, nevt := range nsonTestEvents {
+		buf := []byte(nevt)
+		evt := &nostr.Event{}
+		if err := DecodeBytes(buf, evt); err != nil {
+			t.Fatalf("error decoding nson: %s", err)
+		}
+		clear(buf) // the event must not be affected
+		checkParsedCorrectly(t, evt, nevt)
+	}
+
+	// nson with broken descriptors is decoded as json
+	broken := []byte(nsonTestEvents[0])
+	copy(broken[NSON_VALUES_START:], "ffff")
+	evt := &nostr.Event{}
+	if err := DecodeBytes(broken, evt); err != nil {
+		t.Fatalf("error decoding broken nson: %s", err)
+	}
+	checkParsedCorrectly(t, evt, nsonTestEvents[0])
+}
+
+func TestReader(t *testing.T) {
+	lines := strings.Join(nsonTestEvents, "\n") + "\n\n" + strings.Join(normalEvents, "\n")
+	r := NewReader(strings.NewReader(lines), 0)
+
+	expected := append(append([]string{}, nsonTestEvents...), normalEvents...)
+	for i, jevt := range expected {
+		evt := &nostr.Event{}
+		if err := r.Read(evt); err != nil {
+			t.Fatalf("line %d: %s", i, err)
+		}
+		checkParsedCorrectly(t, evt, jevt)
+	}
+	if err := r.Read(&nostr.Event{}); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
+
 func checkParsedCorrectly(t *testing.T, evt *nostr.Event, jevt string) (isBad bool) {
 	var canonical nostr.Event
 	err := json.Unmarshal([]byte(jevt), &canonical)
@@ -230,3 +322,63 @@ func BenchmarkNSONDecoding(b *testing.B) {
 		}
 	})
 }
+
+func TestCodecRelay(t *testing.T) {
+	evt := nostr.Event{Kind: 1, CreatedAt: nostr.Now(), Tags: nostr.Tags{{"t", "nson"}}, Content: "hello"}
+	evt.Sign(nostr.GeneratePrivateKey())
+
+	for _, negotiate := range []bool{true, false} {
+		codec := Codec{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			upgrader := ws.HTTPUpgrader{Protocol: func(p string) bool { return negotiate && p == Subprotocol }}
+			conn, _, _, err := upgrader.Upgrade(r, w)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			for {
+				data, err := wsutil.ReadClientText(conn)
+				if err != nil {
+					return
+				}
+				req, ok := nostr.ParseMessage(data).(*nostr.ReqEnvelope)
+				if !ok {
+					continue
+				}
+				var reply []byte
+				if negotiate {
+					reply, _ = codec.AppendEnvelope(nil, &nostr.EventEnvelope{SubscriptionID: &req.SubscriptionID, Event: evt})
+					if _, _, rest, _ := nostr.PeekEnvelope(reply); !IsNSON(string(rest)) {
+						t.Errorf("event wasn't sent as NSON: %s", reply)
+					}
+				} else {
+					reply, _ = nostr.EventEnvelope{SubscriptionID: &req.SubscriptionID, Event: evt}.MarshalJSON()
+				}
+				wsutil.WriteServerText(conn, reply)
+				eose, _ := nostr.EOSEEnvelope(req.SubscriptionID).MarshalJSON()
+				wsutil.WriteServerText(conn, eose)
+			}
+		}))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		relay, err := nostr.RelayConnect(ctx, nostr.NormalizeURL(server.URL), nostr.WithCodecs{codec})
+		if err != nil {
+			t.Fatalf("failed to connect: %s", err)
+		}
+		if _, isNSON := relay.Connection.Codec().(Codec); isNSON != negotiate {
+			t.Errorf("codec is %T, negotiated: %v", relay.Connection.Codec(), negotiate)
+		}
+
+		events, err := relay.QuerySync(ctx, nostr.Filter{Kinds: []int{1}})
+		if err != nil {
+			t.Fatalf("failed to query: %s", err)
+		}
+		if len(events) != 1 || events[0].ID != evt.ID || events[0].Content != "hello" {
+			t.Errorf("expected the event, got %v", events)
+		}
+
+		relay.Close()
+		cancel()
+		server.Close()
+	}
+}
@@ -0,0 +1,80 @@
+package nostr
+
+import (
+	"errors"
+	"time"
+)
+
+// Observer is notified of what happens in relays, so it can be turned into metrics or traces.
+// Its methods are called synchronously from the goroutines that handle the relay connections,
+// so they must return quickly. Embed NopObserver to implement only some of them.
+//
+// See Metrics for one that can be exported to Prometheus.
+type Observer interface {
+	// OnConnect is called after every connection attempt, err is nil if it succeeded.
+	OnConnect(url string, err error)
+
+	// OnDisconnect is called when a connection is closed, err is what caused it, if anything.
+	OnDisconnect(url string, err error)
+
+	// OnMessageIn and OnMessageOut are called for each websocket message received from and sent to
+	// a relay, with its size in bytes and its label ("EVENT", "EOSE" etc.). The label is empty for
+	// messages that couldn't be read and for the ones sent with Relay.Write.
+	OnMessageIn(url string, label string, size int)
+	OnMessageOut(url string, label string, size int)
+
+	// OnPublish is called when a relay answers an EVENT with an OK or when we give up waiting,
+	// err is nil if the event was accepted.
+	OnPublish(url string, latency time.Duration, err error)
+
+	// OnEOSE is called when all the stored events for a subscription were received.
+	OnEOSE(url string, subscriptionID string, elapsed time.Duration)
+
+	// OnInvalidEvent is called for each event that fails verification, see Event.Verify.
+	OnInvalidEvent(url string, reason RejectionReason)
+
+	// OnDroppedEvent is called for each event that is valid but doesn't match the filters of its
+	// subscription or doesn't pass the policy given WithValidationPolicy.
+	OnDroppedEvent(url string, reason string)
+}
+
+// NopObserver does nothing.
+type NopObserver struct{}
+
+func (_ NopObserver) OnConnect(url string, err error)                                 {}
+func (_ NopObserver) OnDisconnect(url string, err error)                              {}
+func (_ NopObserver) OnMessageIn(url string, label string, size int)                  {}
+func (_ NopObserver) OnMessageOut(url string, label string, size int)                 {}
+func (_ NopObserver) OnPublish(url string, latency time.Duration, err error)          {}
+func (_ NopObserver) OnEOSE(url string, subscriptionID string, elapsed time.Duration) {}
+func (_ NopObserver) OnInvalidEvent(url string, reason RejectionReason)               {}
+func (_ NopObserver) OnDroppedEvent(url string, reason string)                        {}
+
+var _ Observer = NopObserver{}
+
+// WithObserver makes relays notify the observer of what happens in them.
+//
+// It can be given to NewRelay or to NewSimplePool, in which case it is used by all relays in the pool.
+type WithObserver struct {
+	Observer Observer
+}
+
+func (_ WithObserver) IsRelayOption() {}
+func (_ WithObserver) IsPoolOption()  {}
+func (o WithObserver) Apply(pool *SimplePool) {
+	pool.relayOptions = append(pool.relayOptions, o)
+}
+
+var (
+	_ RelayOption = WithObserver{}
+	_ PoolOption  = WithObserver{}
+)
+
+// rejectionReason gets the reason from an error returned by Event.Verify.
+func rejectionReason(err error) RejectionReason {
+	var invalid *InvalidEventError
+	if errors.As(err, &invalid) {
+		return invalid.Reason
+	}
+	return RejectedBadSignature
+}
@@ -1,10 +1,72 @@
 package nostr
 
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"strconv"
+
+	"github.com/nbd-wtf/go-nostr/internal/tlv"
+)
+
+// Pointer is implemented by ProfilePointer, EventPointer and EntityPointer.
+type Pointer interface {
+	// AsTagReference returns what is used to refer to the thing pointed at in tags:
+	// a pubkey, an event id or an address in the "<kind>:<pubkey>:<d>" format.
+	AsTagReference() string
+
+	// AsTag returns a "p", "e" or "a" tag referencing the thing pointed at, with a relay hint if we have one.
+	AsTag() Tag
+
+	// AsFilter returns a filter that matches the event pointed at, which for profiles is their kind 0.
+	AsFilter() Filter
+
+	// AsNIP19 encodes the pointer as an nprofile, nevent or naddr, it returns an empty string if the
+	// pointer has invalid keys or ids or values too long to be encoded (more than 255 bytes).
+	// nip19.EncodePointer does the same, but returns errors.
+	AsNIP19() string
+
+	// AsURI returns the NIP-21 URI, i.e. AsNIP19 prefixed with "nostr:".
+	AsURI() string
+
+	// RelayHints are the relays where the thing pointed at can be found.
+	RelayHints() []string
+}
+
+var (
+	_ Pointer = ProfilePointer{}
+	_ Pointer = EventPointer{}
+	_ Pointer = EntityPointer{}
+)
+
 type ProfilePointer struct {
 	PublicKey string   `json:"pubkey"`
 	Relays    []string `json:"relays,omitempty"`
 }
 
+func (ep ProfilePointer) AsTagReference() string { return ep.PublicKey }
+func (ep ProfilePointer) AsTag() Tag             { return withRelayHint(Tag{"p", ep.PublicKey}, ep.Relays) }
+func (ep ProfilePointer) AsURI() string          { return "nostr:" + ep.AsNIP19() }
+func (ep ProfilePointer) RelayHints() []string   { return ep.Relays }
+
+func (ep ProfilePointer) AsFilter() Filter {
+	return Filter{Authors: []string{ep.PublicKey}, Kinds: []int{KindProfileMetadata}}
+}
+
+func (ep ProfilePointer) AsNIP19() string {
+	pubkey, err := hex.DecodeString(ep.PublicKey)
+	if err != nil || len(pubkey) != 32 {
+		return ""
+	}
+
+	enc := &tlv.Encoder{}
+	enc.Write(0, pubkey)
+	for _, url := range ep.Relays {
+		enc.Write(1, []byte(url))
+	}
+	code, _ := enc.Bech32("nprofile")
+	return code
+}
+
 type EventPointer struct {
 	ID     string   `json:"id"`
 	Relays []string `json:"relays,omitempty"`
@@ -12,9 +74,81 @@ type EventPointer struct {
 	Kind   int      `json:"kind,omitempty"`
 }
 
+func (ep EventPointer) AsTagReference() string { return ep.ID }
+func (ep EventPointer) AsTag() Tag             { return withRelayHint(Tag{"e", ep.ID}, ep.Relays) }
+func (ep EventPointer) AsFilter() Filter       { return Filter{IDs: []string{ep.ID}} }
+func (ep EventPointer) AsURI() string          { return "nostr:" + ep.AsNIP19() }
+func (ep EventPointer) RelayHints() []string   { return ep.Relays }
+
+func (ep EventPointer) AsNIP19() string {
+	id, err := hex.DecodeString(ep.ID)
+	if err != nil || len(id) != 32 {
+		return ""
+	}
+
+	enc := &tlv.Encoder{}
+	enc.Write(0, id)
+	for _, url := range ep.Relays {
+		enc.Write(1, []byte(url))
+	}
+	if pubkey, _ := hex.DecodeString(ep.Author); len(pubkey) == 32 {
+		enc.Write(2, pubkey)
+	}
+	if ep.Kind != 0 {
+		enc.Write(3, binary.BigEndian.AppendUint32(nil, uint32(ep.Kind)))
+	}
+	code, _ := enc.Bech32("nevent")
+	return code
+}
+
 type EntityPointer struct {
 	PublicKey  string   `json:"pubkey"`
 	Kind       int      `json:"kind,omitempty"`
 	Identifier string   `json:"identifier,omitempty"`
 	Relays     []string `json:"relays,omitempty"`
 }
+
+func (ep EntityPointer) AsTagReference() string {
+	return strconv.Itoa(ep.Kind) + ":" + ep.PublicKey + ":" + ep.Identifier
+}
+
+func (ep EntityPointer) AsTag() Tag           { return withRelayHint(Tag{"a", ep.AsTagReference()}, ep.Relays) }
+func (ep EntityPointer) AsURI() string        { return "nostr:" + ep.AsNIP19() }
+func (ep EntityPointer) RelayHints() []string { return ep.Relays }
+
+// AsFilter returns a filter for the event pointed at. Only addressable events (kinds 30000-39999)
+// have a "d" tag, so for replaceable kinds the filter has just the kind and the author.
+func (ep EntityPointer) AsFilter() Filter {
+	filter := Filter{
+		Kinds:   []int{ep.Kind},
+		Authors: []string{ep.PublicKey},
+	}
+	if ep.Kind >= 30000 && ep.Kind < 40000 {
+		filter.Tags = TagMap{"d": []string{ep.Identifier}}
+	}
+	return filter
+}
+
+func (ep EntityPointer) AsNIP19() string {
+	pubkey, err := hex.DecodeString(ep.PublicKey)
+	if err != nil || len(pubkey) != 32 {
+		return ""
+	}
+
+	enc := &tlv.Encoder{}
+	enc.Write(0, []byte(ep.Identifier))
+	for _, url := range ep.Relays {
+		enc.Write(1, []byte(url))
+	}
+	enc.Write(2, pubkey)
+	enc.Write(3, binary.BigEndian.AppendUint32(nil, uint32(ep.Kind)))
+	code, _ := enc.Bech32("naddr")
+	return code
+}
+
+func withRelayHint(tag Tag, relays []string) Tag {
+	if len(relays) > 0 {
+		return append(tag, relays[0])
+	}
+	return tag
+}
@@ -0,0 +1,62 @@
+package nostr
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetchPointer(t *testing.T) {
+	priv, pub := makeKeyPair(t)
+	sign := func(evt Event) *Event {
+		if err := evt.Sign(priv); err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return &evt
+	}
+
+	outbox := newStoreServer(t)
+	defer outbox.Close()
+	hinted := newStoreServer(t)
+	defer hinted.Close()
+	fallback := newStoreServer(t, sign(Event{
+		Kind: KindRelayListMetadata, CreatedAt: Now(),
+		Tags: Tags{{"r", outbox.URL, "write"}, {"r", "wss://read.example.com", "read"}},
+	}))
+	defer fallback.Close()
+
+	old := sign(Event{Kind: 30023, CreatedAt: Now() - 10, Tags: Tags{{"d", "article"}}, Content: "old"})
+	newest := sign(Event{Kind: 30023, CreatedAt: Now(), Tags: Tags{{"d", "article"}}, Content: "new"})
+	muteList := sign(Event{Kind: KindMuteList, CreatedAt: Now(), Tags: Tags{{"p", pub}}})
+	outbox.events = []*Event{old, newest, muteList}
+
+	pool := NewSimplePool(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	evt, err := pool.FetchPointer(ctx, EntityPointer{
+		PublicKey:  pub,
+		Kind:       30023,
+		Identifier: "article",
+		Relays:     []string{hinted.URL},
+	}, []string{fallback.URL})
+	if err != nil {
+		t.Fatalf("FetchPointer: %v", err)
+	}
+	if evt.Content != "new" {
+		t.Errorf("should have found the newest version, got %v", evt)
+	}
+
+	// replaceable events have no "d" tag
+	evt, err = pool.FetchPointer(ctx, EntityPointer{PublicKey: pub, Kind: KindMuteList}, []string{fallback.URL})
+	if err != nil || evt.ID != muteList.ID {
+		t.Errorf("should have found the mute list, got %v, %v", evt, err)
+	}
+
+	// an event that is nowhere
+	_, err = pool.FetchPointer(ctx, EventPointer{ID: strings.Repeat("0", 64)}, []string{fallback.URL})
+	if err == nil {
+		t.Error("shouldn't have found anything")
+	}
+}
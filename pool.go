@@ -3,7 +3,7 @@ package nostr
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"slices"
 	"strings"
 	"sync"
@@ -20,8 +20,10 @@ type SimplePool struct {
 	Relays  *xsync.MapOf[string, *Relay]
 	Context context.Context
 
-	authHandler func(*Event) error
-	cancel      context.CancelFunc
+	authHandler  func(*Event) error
+	relayOptions []RelayOption
+	logger       *slog.Logger
+	cancel       context.CancelFunc
 }
 
 type DirectedFilters struct {
@@ -47,6 +49,7 @@ func NewSimplePool(ctx context.Context, opts ...PoolOption) *SimplePool {
 
 		Context: ctx,
 		cancel:  cancel,
+		logger:  DefaultLogger,
 	}
 
 	for _, opt := range opts {
@@ -78,11 +81,19 @@ func (pool *SimplePool) EnsureRelay(url string) (*Relay, error) {
 		// already connected, unlock and return
 		return relay, nil
 	} else {
-		var err error
 		// we use this ctx here so when the pool dies everything dies
 		ctx, cancel := context.WithTimeout(pool.Context, time.Second*15)
 		defer cancel()
-		if relay, err = RelayConnect(ctx, nm); err != nil {
+
+		// keep what we already know about this relay from a previous connection
+		var limits *RelayLimits
+		if relay != nil {
+			limits = relay.Limits
+		}
+
+		relay = NewRelay(context.Background(), nm, pool.relayOptions...)
+		relay.Limits = limits
+		if err := relay.Connect(ctx); err != nil {
 			return nil, fmt.Errorf("failed to connect: %w", err)
 		}
 
@@ -201,7 +212,7 @@ func (pool *SimplePool) subMany(ctx context.Context, urls []string, filters Filt
 								goto subscribe
 							}
 						} else {
-							log.Printf("CLOSED from %s: '%s'\n", nm, reason)
+							pool.logger.Info("CLOSED", "relay", nm, "sub", sub.GetID(), "reason", reason)
 						}
 						return
 					case <-ctx.Done():
@@ -260,7 +271,7 @@ func (pool *SimplePool) subManyEose(ctx context.Context, urls []string, filters
 		subscribe:
 			sub, err := relay.Subscribe(ctx, filters)
 			if sub == nil {
-				debugLogf("error subscribing to %s with %v: %s", relay, filters, err)
+				pool.logger.Debug("error subscribing", "relay", nm, "err", err)
 				return
 			}
 
@@ -279,7 +290,7 @@ func (pool *SimplePool) subManyEose(ctx context.Context, urls []string, filters
 							goto subscribe
 						}
 					}
-					log.Printf("CLOSED from %s: '%s'\n", nm, reason)
+					pool.logger.Info("CLOSED", "relay", nm, "sub", sub.GetID(), "reason", reason)
 					return
 				case evt, more := <-sub.Events:
 					if !more {
@@ -342,3 +353,87 @@ func (pool *SimplePool) BatchedSubMany(ctx context.Context, dfs []DirectedFilter
 func (pool *SimplePool) BatchedSubManyEose(ctx context.Context, dfs []DirectedFilters) chan IncomingEvent {
 	return pool.batchedSubMany(ctx, dfs, pool.subManyEose)
 }
+
+// FetchPointer looks for the event a pointer points to (the kind 0 for profiles) first in the
+// relays hinted in the pointer, then in the author's NIP-65 write relays (if we know who the author
+// is) and finally in fallbackRelays. For profiles and addressable events the newest version
+// found at the first place that has any is returned.
+func (pool *SimplePool) FetchPointer(ctx context.Context, pointer Pointer, fallbackRelays []string) (*Event, error) {
+	filter := pointer.AsFilter()
+
+	var author string
+	switch p := pointer.(type) {
+	case ProfilePointer:
+		author = p.PublicKey
+	case EventPointer:
+		author = p.Author
+	case EntityPointer:
+		author = p.PublicKey
+	}
+
+	tried := make([]string, 0, len(pointer.RelayHints())+len(fallbackRelays))
+	try := func(relays []string) *Event {
+		untried := make([]string, 0, len(relays))
+		for _, url := range relays {
+			nm := NormalizeURL(url)
+			if nm != "" && !slices.Contains(tried, nm) && !slices.Contains(untried, nm) {
+				untried = append(untried, nm)
+			}
+		}
+		if len(untried) == 0 {
+			return nil
+		}
+		tried = append(tried, untried...)
+
+		// so everything stops if we return early
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		var newest *Event
+		for ie := range pool.SubManyEose(ctx, untried, Filters{filter}) {
+			if newest == nil || ie.Event.CreatedAt > newest.CreatedAt {
+				newest = ie.Event
+			}
+			if len(filter.IDs) > 0 {
+				// there is only one event with this id, no need to wait for the others
+				break
+			}
+		}
+		return newest
+	}
+
+	if evt := try(pointer.RelayHints()); evt != nil {
+		return evt, nil
+	}
+
+	if author != "" {
+		// the NIP-65 list may be anywhere we know of
+		listRelays := append(slices.Clone(pointer.RelayHints()), fallbackRelays...)
+		var relayList *Event
+		for ie := range pool.SubManyEose(ctx, listRelays, Filters{{Kinds: []int{KindRelayListMetadata}, Authors: []string{author}}}) {
+			if relayList == nil || ie.Event.CreatedAt > relayList.CreatedAt {
+				relayList = ie.Event
+			}
+		}
+		if relayList != nil {
+			outbox := make([]string, 0, len(relayList.Tags))
+			for _, tag := range relayList.Tags {
+				if len(tag) >= 2 && tag[0] == "r" && (len(tag) == 2 || tag[2] == "" || tag[2] == "write") {
+					outbox = append(outbox, tag[1])
+				}
+			}
+			if evt := try(outbox); evt != nil {
+				return evt, nil
+			}
+		}
+	}
+
+	if evt := try(fallbackRelays); evt != nil {
+		return evt, nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("couldn't find %s in %d relays", pointer.AsTagReference(), len(tried))
+}
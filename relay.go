@@ -5,14 +5,16 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/gobwas/ws"
 	"github.com/gobwas/ws/wsutil"
+	"github.com/mailru/easyjson"
 	"github.com/puzpuzpuz/xsync/v3"
 )
 
@@ -39,6 +41,25 @@ type Relay struct {
 	writeQueue                    chan writeRequest
 	subscriptionChannelCloseQueue chan *Subscription
 
+	// set when created WithCapabilityNegotiation
+	negotiation       *WithCapabilityNegotiation
+	subscriptionSlots chan struct{} // only when there is a MaxSubscriptions limit
+	slotsMutex        sync.Mutex
+
+	verifier *SignatureVerifier // set when created WithSignatureVerifier
+	policy   *ValidationPolicy  // set when created WithValidationPolicy
+	decoder  *WithEventDecoder  // set when created WithEventDecoder
+	codecs   WithCodecs         // set when created WithCodecs
+	observer Observer           // NopObserver unless created WithObserver
+	logger   *slog.Logger       // DefaultLogger unless created WithLogger, always with the relay URL
+	netDial  WithNetDial        // set when created WithNetDial
+
+	compression WithCompression // the zero value when not created WithCompression
+
+	// Limits are what the relay told us about itself, this is only fetched when the relay
+	// is created WithCapabilityNegotiation and will be nil if the relay didn't say anything.
+	Limits *RelayLimits
+
 	// custom things that aren't often used
 	//
 	AssumeValid bool // this will skip verifying signatures for events received from this relay
@@ -46,6 +67,7 @@ type Relay struct {
 
 type writeRequest struct {
 	msg    []byte
+	label  string
 	answer chan error
 }
 
@@ -60,6 +82,7 @@ func NewRelay(ctx context.Context, url string, opts ...RelayOption) *Relay {
 		okCallbacks:                   xsync.NewMapOf[string, func(bool, string)](),
 		writeQueue:                    make(chan writeRequest),
 		subscriptionChannelCloseQueue: make(chan *Subscription),
+		observer:                      NopObserver{},
 	}
 
 	for _, opt := range opts {
@@ -71,8 +94,32 @@ func NewRelay(ctx context.Context, url string, opts ...RelayOption) *Relay {
 					o(notice)
 				}
 			}()
+		case WithCapabilityNegotiation:
+			r.negotiation = &o
+		case WithSignatureVerifier:
+			r.verifier = o.Verifier
+		case WithValidationPolicy:
+			r.policy = o.Policy
+		case WithEventDecoder:
+			r.decoder = &o
+		case WithCodecs:
+			r.codecs = o
+		case WithObserver:
+			if o.Observer != nil {
+				r.observer = o.Observer
+			}
+		case WithLogger:
+			r.logger = o.Logger
+		case WithNetDial:
+			r.netDial = o
+		case WithCompression:
+			r.compression = o
 		}
 	}
+	if r.logger == nil {
+		r.logger = DefaultLogger
+	}
+	r.logger = r.logger.With("relay", r.URL)
 
 	return r
 }
@@ -140,7 +187,26 @@ func (r *Relay) ConnectWithTLS(ctx context.Context, tlsConfig *tls.Config) error
 		defer cancel()
 	}
 
-	conn, err := NewConnection(ctx, r.URL, r.RequestHeader, tlsConfig)
+	// fetch the relay limits while we connect, they are kept across reconnections
+	var limitsFetched chan struct{}
+	if r.negotiation != nil && r.negotiation.FetchLimits != nil && r.Limits == nil {
+		limitsFetched = make(chan struct{})
+		go func() {
+			defer close(limitsFetched)
+			limits, err := r.negotiation.FetchLimits(ctx, r.URL, r.netDial.HTTPClient())
+			if err != nil {
+				r.logger.Info("failed to fetch relay limits", "err", err)
+				return
+			}
+			r.Limits = limits
+		}()
+	}
+
+	conn, err := NewConnection(ctx, r.URL, r.RequestHeader, tlsConfig, r.codecs, r.netDial, r.compression)
+	if limitsFetched != nil {
+		<-limitsFetched
+	}
+	r.observer.OnConnect(r.URL, err)
 	if err != nil {
 		return fmt.Errorf("error opening websocket to '%s': %w", r.URL, err)
 	}
@@ -172,7 +238,7 @@ func (r *Relay) ConnectWithTLS(ctx context.Context, tlsConfig *tls.Config) error
 			case <-ticker.C:
 				err := wsutil.WriteClientMessage(r.Connection.conn, ws.OpPing, nil)
 				if err != nil {
-					InfoLogger.Printf("{%s} error writing ping: %v; closing websocket", r.URL, err)
+					r.logger.Info("error writing ping, closing websocket", "err", err)
 					r.Close() // this should trigger a context cancelation
 					return
 				}
@@ -180,6 +246,8 @@ func (r *Relay) ConnectWithTLS(ctx context.Context, tlsConfig *tls.Config) error
 				// all write requests will go through this to prevent races
 				if err := r.Connection.WriteMessage(writeRequest.msg); err != nil {
 					writeRequest.answer <- err
+				} else {
+					r.observer.OnMessageOut(r.URL, writeRequest.label, len(writeRequest.msg))
 				}
 				close(writeRequest.answer)
 			case <-r.connectionContext.Done():
@@ -189,24 +257,82 @@ func (r *Relay) ConnectWithTLS(ctx context.Context, tlsConfig *tls.Config) error
 		}
 	}()
 
+	// closed when the first AUTH challenge arrives in this connection
+	challengeReceived := make(chan struct{})
+
+	// when there is a verifier events are verified in parallel, but they are still dispatched from
+	// here in the order they came, so the EOSEs and CLOSEDs that come after them aren't dispatched first
+	var dispatchQueue chan pendingDispatch
+	if r.verifier != nil && !r.AssumeValid {
+		dispatchQueue = make(chan pendingDispatch, 256)
+		go func() {
+			for pending := range dispatchQueue {
+				if pending.verification != nil {
+					r.verifier.wait(pending.verification)
+					if !pending.verification.ok {
+						r.logInvalidEvent(pending.verification.err)
+						eventPool.Put(pending.verification.event)
+						continue
+					}
+				}
+				pending.dispatch()
+			}
+		}()
+	}
+
 	// general message reader loop
 	go func() {
 		buf := new(bytes.Buffer)
+		challenged := false
+		codec := conn.Codec()
+		_, isJSON := codec.(JSONCodec)
+
+		if dispatchQueue != nil {
+			defer close(dispatchQueue)
+		}
 
 		for {
 			buf.Reset()
 			if err := conn.ReadMessage(r.connectionContext, buf); err != nil {
+				if r.connectionContext.Err() != nil {
+					r.observer.OnDisconnect(r.URL, nil) // we closed it
+				} else {
+					r.observer.OnDisconnect(r.URL, err)
+				}
 				r.ConnectionError = err
 				r.Close()
 				break
 			}
 
 			message := buf.Bytes()
-			debugLogf("{%s} %v\n", r.URL, message)
-			envelope := ParseMessage(message)
-			if envelope == nil {
+			if r.logger.Enabled(r.connectionContext, slog.LevelDebug) {
+				r.logger.Debug("received", "message", rawMessage(message))
+			}
+
+			// fast path for EVENTs in JSON: we only decode them if they are for one of our subscriptions
+			if label, subID, rest, ok := PeekEnvelope(message); isJSON && ok && label == "EVENT" && subID != "" {
+				r.observer.OnMessageIn(r.URL, label, len(message))
+				subscription, ok := r.Subscriptions.Load(subID)
+				if !ok {
+					continue
+				}
+				evt := eventPool.Get().(*Event)
+				*evt = Event{}
+				if end := bytes.LastIndexByte(rest, ']'); end == -1 || r.decodeEvent(rest[:end], evt) != nil {
+					eventPool.Put(evt)
+					continue
+				}
+				r.handleEvent(subscription, evt, dispatchQueue)
+				continue
+			}
+
+			envelope, err := codec.DecodeEnvelope(message)
+			if err != nil {
+				r.observer.OnMessageIn(r.URL, "", len(message))
+				r.logger.Debug("failed to decode message", "err", err)
 				continue
 			}
+			r.observer.OnMessageIn(r.URL, envelope.Label(), len(message))
 
 			switch env := envelope.(type) {
 			case *NoticeEnvelope:
@@ -214,49 +340,40 @@ func (r *Relay) ConnectWithTLS(ctx context.Context, tlsConfig *tls.Config) error
 				if r.notices != nil {
 					r.notices <- string(*env)
 				} else {
-					log.Printf("NOTICE from %s: '%s'\n", r.URL, string(*env))
+					r.logger.Info("NOTICE", "message", string(*env))
 				}
 			case *AuthEnvelope:
 				if env.Challenge == nil {
 					continue
 				}
 				r.challenge = *env.Challenge
+				if !challenged {
+					challenged = true
+					close(challengeReceived)
+				}
 			case *EventEnvelope:
 				if env.SubscriptionID == nil {
 					continue
 				}
-				if subscription, ok := r.Subscriptions.Load(*env.SubscriptionID); !ok {
-					// InfoLogger.Printf("{%s} no subscription with id '%s'\n", r.URL, *env.SubscriptionID)
-					continue
-				} else {
-					// check if the event matches the desired filter, ignore otherwise
-					if !subscription.Filters.Match(&env.Event) {
-						InfoLogger.Printf("{%s} filter does not match: %v ~ %v\n", r.URL, subscription.Filters, env.Event)
-						continue
-					}
-
-					// check signature, ignore invalid, except from trusted (AssumeValid) relays
-					if !r.AssumeValid {
-						if ok, err := env.Event.CheckSignature(); !ok {
-							errmsg := ""
-							if err != nil {
-								errmsg = err.Error()
-							}
-							InfoLogger.Printf("{%s} bad signature on %s; %s\n", r.URL, env.Event.ID, errmsg)
-							continue
-						}
-					}
-
-					// dispatch this to the internal .events channel of the subscription
-					subscription.dispatchEvent(&env.Event)
+				if subscription, ok := r.Subscriptions.Load(*env.SubscriptionID); ok {
+					r.handleEvent(subscription, &env.Event, dispatchQueue)
 				}
 			case *EOSEEnvelope:
 				if subscription, ok := r.Subscriptions.Load(string(*env)); ok {
-					subscription.dispatchEose()
+					if dispatchQueue != nil {
+						dispatchQueue <- pendingDispatch{dispatch: subscription.dispatchEose}
+					} else {
+						subscription.dispatchEose()
+					}
 				}
 			case *ClosedEnvelope:
 				if subscription, ok := r.Subscriptions.Load(string(env.SubscriptionID)); ok {
-					subscription.dispatchClosed(env.Reason)
+					id, reason := string(env.SubscriptionID), env.Reason
+					if dispatchQueue != nil {
+						dispatchQueue <- pendingDispatch{dispatch: func() { subscription.dispatchClosed(id, reason) }}
+					} else {
+						subscription.dispatchClosed(id, reason)
+					}
 				}
 			case *CountEnvelope:
 				if subscription, ok := r.Subscriptions.Load(string(env.SubscriptionID)); ok && env.Count != nil && subscription.countResult != nil {
@@ -266,20 +383,131 @@ func (r *Relay) ConnectWithTLS(ctx context.Context, tlsConfig *tls.Config) error
 				if okCallback, exist := r.okCallbacks.Load(env.EventID); exist {
 					okCallback(env.OK, env.Reason)
 				} else {
-					InfoLogger.Printf("{%s} got an unexpected OK message for event %s", r.URL, env.EventID)
+					r.logger.Info("got an unexpected OK", "event", env.EventID)
 				}
 			}
 		}
 	}()
 
+	if r.Limits != nil {
+		r.applyLimits(ctx, challengeReceived)
+	}
+
 	return nil
 }
 
-// Write queues a message to be sent to the relay.
+// eventPool has events that were decoded but then dropped, events that are dispatched to
+// subscriptions are never put back here.
+var eventPool = sync.Pool{New: func() any { return &Event{} }}
+
+// decodeEvent decodes the event object from an EVENT envelope, see WithEventDecoder.
+func (r *Relay) decodeEvent(data []byte, evt *Event) error {
+	if r.decoder != nil {
+		return r.decoder.Decode(data, evt)
+	}
+	return easyjson.Unmarshal(data, evt)
+}
+
+// handleEvent checks an event received for a subscription and dispatches it if it is fine.
+func (r *Relay) handleEvent(subscription *Subscription, evt *Event, dispatchQueue chan pendingDispatch) {
+	// check if the event matches the desired filter, ignore otherwise
+	if !subscription.Filters.Match(evt) {
+		r.logger.Info("filter does not match", "sub", subscription.GetID(), "event", evt.ID, "kind", evt.Kind)
+		r.observer.OnDroppedEvent(r.URL, "filter does not match")
+		eventPool.Put(evt)
+		return
+	}
+
+	// check if the event is acceptable, before the expensive checks
+	if r.policy != nil {
+		if reason := r.policy.Validate(evt); reason != "" {
+			r.logger.Debug("dropped event", "sub", subscription.GetID(), "event", evt.ID, "kind", evt.Kind, "reason", reason)
+			r.observer.OnDroppedEvent(r.URL, reason)
+			eventPool.Put(evt)
+			return
+		}
+	}
+
+	if dispatchQueue != nil {
+		dispatchQueue <- pendingDispatch{
+			verification: r.verifier.submit(evt),
+			dispatch:     func() { subscription.dispatchEvent(evt) },
+		}
+		return
+	}
+
+	// check id and signature, ignore invalid, but only check the id from trusted
+	// (AssumeValid) relays, as that is what we use to dedupe events
+	if !r.AssumeValid {
+		if err := evt.Verify(); err != nil {
+			r.logInvalidEvent(err)
+			eventPool.Put(evt)
+			return
+		}
+	} else if !evt.CheckID() {
+		r.logInvalidEvent(&InvalidEventError{ID: evt.ID, Reason: RejectedBadID})
+		eventPool.Put(evt)
+		return
+	}
+
+	// dispatch this to the internal .events channel of the subscription
+	subscription.dispatchEvent(evt)
+}
+
+type pendingDispatch struct {
+	verification *verification // nil for things that don't have to be verified
+	dispatch     func()
+}
+
+func (r *Relay) logInvalidEvent(err error) {
+	r.observer.OnInvalidEvent(r.URL, rejectionReason(err))
+	r.logger.Info("rejected invalid event", "err", err)
+}
+
+// applyLimits prepares the connection for the limits the relay has announced.
+func (r *Relay) applyLimits(ctx context.Context, challengeReceived chan struct{}) {
+	if r.Limits.MaxSubscriptions > 0 {
+		r.subscriptionSlots = make(chan struct{}, r.Limits.MaxSubscriptions)
+	}
+
+	if r.Limits.AuthRequired && r.negotiation.Sign != nil {
+		// relays that require auth normally send their challenge as soon as we connect
+		select {
+		case <-challengeReceived:
+			if err := r.Auth(ctx, r.negotiation.Sign); err != nil {
+				r.logger.Info("failed to authenticate", "err", err)
+			}
+		case <-time.After(3 * time.Second):
+			r.logger.Info("requires auth but didn't send a challenge")
+		case <-ctx.Done():
+		}
+	}
+}
+
+// encode encodes an envelope with the codec of the current connection.
+func (r *Relay) encode(env Envelope) ([]byte, error) {
+	var codec Codec = JSONCodec{}
+	if r.Connection != nil {
+		codec = r.Connection.Codec()
+	}
+	b, err := codec.AppendEnvelope(nil, env)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", env.Label(), err)
+	}
+	return b, nil
+}
+
+// Write queues a message to be sent to the relay, it must be already encoded with the codec
+// that was negotiated for the connection, which is JSON unless the relay was created WithCodecs.
 func (r *Relay) Write(msg []byte) <-chan error {
+	return r.write(msg, "")
+}
+
+// write is like Write, label is only used for the Observer.
+func (r *Relay) write(msg []byte, label string) <-chan error {
 	ch := make(chan error)
 	select {
-	case r.writeQueue <- writeRequest{msg: msg, answer: ch}:
+	case r.writeQueue <- writeRequest{msg: msg, label: label, answer: ch}:
 	case <-r.connectionContext.Done():
 		go func() { ch <- fmt.Errorf("connection closed") }()
 	}
@@ -287,10 +515,32 @@ func (r *Relay) Write(msg []byte) <-chan error {
 }
 
 // Publish sends an "EVENT" command to the relay r as in NIP-01 and waits for an OK response.
+// The event is sent as it is, see PublishWithResult for relays that require proof-of-work.
 func (r *Relay) Publish(ctx context.Context, event Event) error {
 	return r.publish(ctx, event.ID, &EventEnvelope{Event: event})
 }
 
+// PublishWithResult is like Publish, but when the relay was created WithCapabilityNegotiation
+// and requires proof-of-work it is added to a copy of the event, which is then signed again
+// before being sent. The event that was actually sent is returned, its ID is the one the relay
+// knows it by.
+func (r *Relay) PublishWithResult(ctx context.Context, event Event) (Event, error) {
+	if r.Limits != nil && r.Limits.MinPowDifficulty > 0 &&
+		r.negotiation.GeneratePoW != nil && r.negotiation.Sign != nil {
+		event.Tags = slices.Clone(event.Tags) // don't touch the caller's tags
+		if err := r.negotiation.GeneratePoW(ctx, &event, r.Limits.MinPowDifficulty); err != nil {
+			return event, fmt.Errorf("failed to generate proof-of-work: %w", err)
+		}
+		if event.GetID() != event.ID {
+			if err := r.negotiation.Sign(&event); err != nil {
+				return event, fmt.Errorf("failed to sign event after proof-of-work: %w", err)
+			}
+		}
+	}
+
+	return event, r.publish(ctx, event.ID, &EventEnvelope{Event: event})
+}
+
 // Auth sends an "AUTH" command client->relay as in NIP-42 and waits for an OK response.
 func (r *Relay) Auth(ctx context.Context, sign func(event *Event) error) error {
 	authEvent := Event{
@@ -309,6 +559,16 @@ func (r *Relay) Auth(ctx context.Context, sign func(event *Event) error) error {
 	return r.publish(ctx, authEvent.ID, &AuthEnvelope{Event: authEvent})
 }
 
+// RejectedError is returned by Publish and Auth when the relay answers with an OK false. Reason is
+// the message from the relay, which per NIP-01 starts with a machine-readable prefix like
+// "duplicate:", "blocked:" or "auth-required:".
+type RejectedError struct {
+	EventID string
+	Reason  string
+}
+
+func (e *RejectedError) Error() string { return "msg: " + e.Reason }
+
 // publish can be used both for EVENT and for AUTH
 func (r *Relay) publish(ctx context.Context, id string, env Envelope) error {
 	var err error
@@ -329,16 +589,31 @@ func (r *Relay) publish(ctx context.Context, id string, env Envelope) error {
 	r.okCallbacks.Store(id, func(ok bool, reason string) {
 		gotOk = true
 		if !ok {
-			err = fmt.Errorf("msg: %s", reason)
+			err = &RejectedError{EventID: id, Reason: reason}
 		}
 		cancel()
 	})
 	defer r.okCallbacks.Delete(id)
 
 	// publish event
-	envb, _ := env.MarshalJSON()
-	debugLogf("{%s} sending %v\n", r.URL, envb)
-	if err := <-r.Write(envb); err != nil {
+	envb, err := r.encode(env)
+	if err != nil {
+		return err
+	}
+	if r.Limits != nil && r.Limits.MaxMessageLength > 0 && len(envb) > r.Limits.MaxMessageLength {
+		return fmt.Errorf("message has %d bytes, more than the relay accepts (%d)", len(envb), r.Limits.MaxMessageLength)
+	}
+	r.logger.Debug("sending", "event", id, "message", rawMessage(envb))
+	sent := time.Now()
+	if err := <-r.write(envb, env.Label()); err != nil {
+		return err
+	}
+
+	// from here on we have waited for an answer
+	answered := func(err error) error {
+		if env.Label() == "EVENT" {
+			r.observer.OnPublish(r.URL, time.Since(sent), err)
+		}
 		return err
 	}
 
@@ -347,12 +622,12 @@ func (r *Relay) publish(ctx context.Context, id string, env Envelope) error {
 		case <-ctx.Done():
 			// this will be called when we get an OK or when the context has been canceled
 			if gotOk {
-				return err
+				return answered(err)
 			}
-			return ctx.Err()
+			return answered(ctx.Err())
 		case <-r.connectionContext.Done():
 			// this is caused when we lose connectivity
-			return err
+			return answered(err)
 		}
 	}
 }
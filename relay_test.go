@@ -85,8 +85,12 @@ func TestPublishBlocked(t *testing.T) {
 	// connect a client and send a text note
 	rl := mustRelayConnect(ws.URL)
 	err := rl.Publish(context.Background(), textNote)
-	if err == nil {
-		t.Errorf("should have failed to publish")
+	var rejected *RejectedError
+	if !errors.As(err, &rejected) {
+		t.Fatalf("should have been rejected, got %v", err)
+	}
+	if rejected.EventID != textNote.ID || rejected.Reason != "blocked" {
+		t.Errorf("wrong rejection %v", rejected)
 	}
 }
 
@@ -189,6 +193,37 @@ var anyOriginHandshake = func(conf *websocket.Config, r *http.Request) error {
 	return nil
 }
 
+type storeServer struct {
+	*httptest.Server
+	events []*Event
+}
+
+// newStoreServer starts a fake relay that answers REQs with the matching events it has, then EOSE.
+func newStoreServer(t *testing.T, events ...*Event) *storeServer {
+	s := &storeServer{events: events}
+	s.Server = newWebsocketServer(func(conn *websocket.Conn) {
+		for {
+			var raw []json.RawMessage
+			if err := websocket.JSON.Receive(conn, &raw); err != nil {
+				return
+			}
+			var typ string
+			json.Unmarshal(raw[0], &typ)
+			if typ != "REQ" {
+				continue
+			}
+			subid, filters := parseSubscriptionMessage(t, raw)
+			for _, evt := range s.events {
+				if Filters(filters).Match(evt) {
+					websocket.JSON.Send(conn, []any{"EVENT", subid, evt})
+				}
+			}
+			websocket.JSON.Send(conn, []any{"EOSE", subid})
+		}
+	})
+	return s
+}
+
 func makeKeyPair(t *testing.T) (priv, pub string) {
 	t.Helper()
 	privkey := GeneratePrivateKey()
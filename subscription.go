@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 type Subscription struct {
@@ -40,6 +41,20 @@ type Subscription struct {
 	// this keeps track of the events we've received before the EOSE that we must dispatch before
 	// closing the EndOfStoredEvents channel
 	storedwg sync.WaitGroup
+
+	// when the relay has a MaxFilters limit we may have to send the filters in multiple REQs,
+	// the first uses the normal id and the others get a suffix. we then wait for all their EOSEs
+	// and skip events that come more than once.
+	extraIDs    []string
+	pendingEose atomic.Int32
+	seen        *seenIDs
+
+	// subscription slots taken from the relay when it has a MaxSubscriptions limit
+	slots     chan struct{}
+	heldSlots int
+
+	// when the REQs were sent, for the Observer
+	firedAt time.Time
 }
 
 type EventMessage struct {
@@ -79,6 +94,10 @@ func (sub *Subscription) start() {
 }
 
 func (sub *Subscription) dispatchEvent(evt *Event) {
+	if sub.seen != nil && !sub.seen.add(evt.ID) {
+		return
+	}
+
 	added := false
 	if !sub.eosed.Load() {
 		sub.storedwg.Add(1)
@@ -103,7 +122,13 @@ func (sub *Subscription) dispatchEvent(evt *Event) {
 }
 
 func (sub *Subscription) dispatchEose() {
+	if sub.pendingEose.Add(-1) > 0 {
+		// still waiting for the other REQs of a split subscription
+		return
+	}
+
 	if sub.eosed.CompareAndSwap(false, true) {
+		sub.Relay.observer.OnEOSE(sub.Relay.URL, sub.GetID(), time.Since(sub.firedAt))
 		go func() {
 			sub.storedwg.Wait()
 			sub.EndOfStoredEvents <- struct{}{}
@@ -111,9 +136,14 @@ func (sub *Subscription) dispatchEose() {
 	}
 }
 
-func (sub *Subscription) dispatchClosed(reason string) {
+// dispatchClosed handles a CLOSED for one of the REQs of this subscription, id. A split
+// subscription is incomplete without any of its REQs, so the others are closed too.
+func (sub *Subscription) dispatchClosed(id string, reason string) {
 	if sub.closed.CompareAndSwap(false, true) {
 		go func() {
+			if len(sub.extraIDs) > 0 {
+				sub.closeREQs(id)
+			}
 			sub.ClosedReason <- reason
 		}()
 	}
@@ -128,20 +158,42 @@ func (sub *Subscription) Unsub() {
 	// mark subscription as closed and send a CLOSE to the relay (naïve sync.Once implementation)
 	if sub.live.CompareAndSwap(true, false) {
 		sub.Close()
+		sub.releaseSlots()
 	}
 
 	// remove subscription from our map
 	sub.Relay.Subscriptions.Delete(sub.GetID())
+	for _, id := range sub.extraIDs {
+		sub.Relay.Subscriptions.Delete(id)
+	}
 }
 
 // Close just sends a CLOSE message. You probably want Unsub() instead.
 func (sub *Subscription) Close() {
+	sub.closeREQs("")
+}
+
+// closeREQs sends a CLOSE for each of the REQs of this subscription except skip.
+func (sub *Subscription) closeREQs(skip string) {
 	if sub.Relay.IsConnected() {
-		id := sub.GetID()
-		closeMsg := CloseEnvelope(id)
-		closeb, _ := (&closeMsg).MarshalJSON()
-		debugLogf("{%s} sending %v", sub.Relay.URL, closeb)
-		<-sub.Relay.Write(closeb)
+		for _, id := range append([]string{sub.GetID()}, sub.extraIDs...) {
+			if id == skip {
+				continue
+			}
+			closeMsg := CloseEnvelope(id)
+			closeb, err := sub.Relay.encode(&closeMsg)
+			if err != nil {
+				continue
+			}
+			sub.Relay.logger.Debug("sending", "sub", id, "message", rawMessage(closeb))
+			<-sub.Relay.write(closeb, closeMsg.Label())
+		}
+	}
+}
+
+func (sub *Subscription) releaseSlots() {
+	for ; sub.heldSlots > 0; sub.heldSlots-- {
+		<-sub.slots
 	}
 }
 
@@ -153,22 +205,109 @@ func (sub *Subscription) Sub(_ context.Context, filters Filters) {
 }
 
 // Fire sends the "REQ" command to the relay.
+//
+// If the relay has announced limits (see WithCapabilityNegotiation) the filters may be adjusted
+// and split across multiple REQs, and Fire may block until the relay can take another subscription.
+// It fails if the filters would need more REQs than the relay allows subscriptions at once.
 func (sub *Subscription) Fire() error {
 	id := sub.GetID()
 
-	var reqb []byte
-	if sub.countResult == nil {
-		reqb, _ = ReqEnvelope{id, sub.Filters}.MarshalJSON()
-	} else {
-		reqb, _ = CountEnvelope{id, sub.Filters, nil}.MarshalJSON()
+	chunks := []Filters{sub.Filters}
+	if limits := sub.Relay.Limits; limits != nil {
+		filters := limits.clamp(sub.Filters)
+		if sub.countResult == nil {
+			// counts can't be added up, so we never split those
+			chunks = limits.split(filters)
+		} else {
+			chunks = []Filters{filters}
+		}
 	}
-	debugLogf("{%s} sending %v", sub.Relay.URL, reqb)
 
-	sub.live.Store(true)
-	if err := <-sub.Relay.Write(reqb); err != nil {
+	if slots := sub.Relay.subscriptionSlots; slots != nil && len(chunks) > cap(slots) {
 		sub.cancel()
-		return fmt.Errorf("failed to write: %w", err)
+		return fmt.Errorf("filters need %d REQs but the relay only allows %d subscriptions", len(chunks), cap(slots))
+	}
+
+	for _, extraID := range sub.extraIDs {
+		sub.Relay.Subscriptions.Delete(extraID)
+	}
+	sub.extraIDs = sub.extraIDs[:0]
+	for i := 1; i < len(chunks); i++ {
+		extraID := id + ":" + strconv.Itoa(i)
+		sub.extraIDs = append(sub.extraIDs, extraID)
+		sub.Relay.Subscriptions.Store(extraID, sub)
+	}
+	if len(chunks) > 1 && sub.seen == nil {
+		sub.seen = &seenIDs{}
+	}
+	sub.pendingEose.Store(int32(len(chunks)))
+
+	if slots := sub.Relay.subscriptionSlots; slots != nil && sub.heldSlots == 0 {
+		n := len(chunks)
+		if err := sub.Relay.acquireSubscriptionSlots(sub.Context, slots, n); err != nil {
+			sub.cancel()
+			return fmt.Errorf("gave up waiting for a subscription slot: %w", err)
+		}
+		sub.slots = slots
+		sub.heldSlots = n
+	}
+
+	sub.live.Store(true)
+	sub.firedAt = time.Now()
+	for i, filters := range chunks {
+		reqID := id
+		if i > 0 {
+			reqID = sub.extraIDs[i-1]
+		}
+
+		var env Envelope = &ReqEnvelope{reqID, filters}
+		if sub.countResult != nil {
+			env = &CountEnvelope{reqID, filters, nil}
+		}
+		reqb, err := sub.Relay.encode(env)
+		if err != nil {
+			sub.cancel()
+			return err
+		}
+		sub.Relay.logger.Debug("sending", "sub", reqID, "message", rawMessage(reqb))
+
+		if err := <-sub.Relay.write(reqb, env.Label()); err != nil {
+			sub.cancel()
+			return fmt.Errorf("failed to write: %w", err)
+		}
 	}
 
 	return nil
 }
+
+// maxSeenIDs is how many event ids a split subscription keeps in each generation of its seenIDs,
+// events that come again from another REQ after more than that many others will be duplicated.
+const maxSeenIDs = 10_000
+
+// seenIDs remembers the ids of the most recent events, between maxSeenIDs and twice that many:
+// when the current set is full it replaces the previous one and a new set is started.
+type seenIDs struct {
+	mu       sync.Mutex
+	current  map[string]struct{}
+	previous map[string]struct{}
+}
+
+// add reports whether id is new and remembers it.
+func (s *seenIDs) add(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.current[id]; ok {
+		return false
+	}
+	if _, ok := s.previous[id]; ok {
+		return false
+	}
+
+	if s.current == nil || len(s.current) >= maxSeenIDs {
+		s.previous = s.current
+		s.current = make(map[string]struct{}, 64)
+	}
+	s.current[id] = struct{}{}
+	return true
+}
@@ -3,6 +3,7 @@ package nostr
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -100,3 +101,22 @@ func TestNestedSubscriptions(t *testing.T) {
 		}
 	}
 }
+
+func TestSeenIDs(t *testing.T) {
+	seen := &seenIDs{}
+	if !seen.add("a") || seen.add("a") {
+		t.Fatal("a should only be new the first time")
+	}
+	for i := 0; i < 3*maxSeenIDs; i++ {
+		seen.add(strconv.Itoa(i))
+	}
+	if len(seen.current)+len(seen.previous) > 2*maxSeenIDs {
+		t.Errorf("too many ids kept: %d", len(seen.current)+len(seen.previous))
+	}
+	if !seen.add("a") {
+		t.Errorf("a should have been forgotten")
+	}
+	if seen.add(strconv.Itoa(3*maxSeenIDs - 1)) {
+		t.Errorf("recent ids should be remembered")
+	}
+}
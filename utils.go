@@ -17,6 +17,24 @@ func IsValidRelayURL(u string) bool {
 	if len(strings.Split(parsed.Host, ".")) < 2 {
 		return false
 	}
+	if host := strings.ToLower(parsed.Hostname()); strings.HasSuffix(host, ".onion") {
+		return isValidOnionHost(host)
+	}
+	return true
+}
+
+// isValidOnionHost checks if the host is a version 3 onion address, possibly with subdomains.
+func isValidOnionHost(host string) bool {
+	labels := strings.Split(strings.TrimSuffix(host, ".onion"), ".")
+	address := labels[len(labels)-1]
+	if len(address) != 56 {
+		return false
+	}
+	for _, c := range address {
+		if (c < 'a' || c > 'z') && (c < '2' || c > '7') {
+			return false
+		}
+	}
 	return true
 }
 
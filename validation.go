@@ -0,0 +1,128 @@
+package nostr
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Validator looks at an event received from a relay and returns a reason for it to be dropped,
+// or an empty string if the event is fine. Reasons are used as keys for counting the dropped
+// events, so they should be short and not depend on the event.
+//
+// See nip13.MinDifficultyValidator for one that requires proof-of-work.
+type Validator func(evt *Event) (reason string)
+
+// ValidationPolicy is a chain of validators that all events must pass, along with counters of
+// how many events were dropped by each reason. The same policy can be shared by many relays,
+// see WithValidationPolicy.
+type ValidationPolicy struct {
+	Validators []Validator
+
+	mutex   sync.Mutex
+	dropped map[string]int64
+}
+
+func NewValidationPolicy(validators ...Validator) *ValidationPolicy {
+	return &ValidationPolicy{Validators: validators, dropped: make(map[string]int64)}
+}
+
+// Validate runs the event through all validators and returns the reason given by the first one
+// that rejects it, counting it as dropped, or an empty string.
+func (p *ValidationPolicy) Validate(evt *Event) string {
+	for _, validator := range p.Validators {
+		if reason := validator(evt); reason != "" {
+			p.mutex.Lock()
+			if p.dropped == nil {
+				// the policy may have been made without NewValidationPolicy
+				p.dropped = make(map[string]int64)
+			}
+			p.dropped[reason]++
+			p.mutex.Unlock()
+			return reason
+		}
+	}
+	return ""
+}
+
+// Dropped returns how many events were dropped so far by each reason.
+func (p *ValidationPolicy) Dropped() map[string]int64 {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	dropped := make(map[string]int64, len(p.dropped))
+	for reason, count := range p.dropped {
+		dropped[reason] = count
+	}
+	return dropped
+}
+
+// MaxFutureSkew drops events with a created_at more than skew into the future.
+func MaxFutureSkew(skew time.Duration) Validator {
+	return func(evt *Event) string {
+		if evt.CreatedAt.Time().After(time.Now().Add(skew)) {
+			return "created_at too far in the future"
+		}
+		return ""
+	}
+}
+
+// MaxTags drops events that have more than max tags.
+func MaxTags(max int) Validator {
+	return func(evt *Event) string {
+		if len(evt.Tags) > max {
+			return fmt.Sprintf("more than %d tags", max)
+		}
+		return ""
+	}
+}
+
+// MaxContentLength drops events whose content is longer than max bytes.
+func MaxContentLength(max int) Validator {
+	return func(evt *Event) string {
+		if len(evt.Content) > max {
+			return fmt.Sprintf("content longer than %d", max)
+		}
+		return ""
+	}
+}
+
+// KindAllowlist drops events of all kinds except the given ones.
+func KindAllowlist(kinds ...int) Validator {
+	return func(evt *Event) string {
+		if !slices.Contains(kinds, evt.Kind) {
+			return "kind not allowed"
+		}
+		return ""
+	}
+}
+
+// PubKeyBlocklist drops events from the given pubkeys.
+func PubKeyBlocklist(pubkeys ...string) Validator {
+	return func(evt *Event) string {
+		if slices.Contains(pubkeys, evt.PubKey) {
+			return "pubkey blocked"
+		}
+		return ""
+	}
+}
+
+// WithValidationPolicy makes relays drop the events that don't pass the policy before they
+// reach any subscription. This happens before their signatures are verified.
+//
+// It can be given to NewRelay or to NewSimplePool, in which case it is used by all relays in the pool.
+type WithValidationPolicy struct {
+	Policy *ValidationPolicy
+}
+
+func (_ WithValidationPolicy) IsRelayOption() {}
+func (_ WithValidationPolicy) IsPoolOption()  {}
+func (o WithValidationPolicy) Apply(pool *SimplePool) {
+	pool.relayOptions = append(pool.relayOptions, o)
+}
+
+var (
+	_ RelayOption = WithValidationPolicy{}
+	_ PoolOption  = WithValidationPolicy{}
+)
@@ -0,0 +1,70 @@
+package nostr
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidationPolicy(t *testing.T) {
+	priv, _ := makeKeyPair(t)
+	blockedPriv, blockedPub := makeKeyPair(t)
+	sign := func(evt Event, priv string) *Event {
+		if err := evt.Sign(priv); err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return &evt
+	}
+
+	store := newStoreServer(t,
+		sign(Event{Kind: KindTextNote, CreatedAt: Now(), Content: "good"}, priv),
+		sign(Event{Kind: KindTextNote, CreatedAt: Now() + 3600, Content: "future"}, priv),
+		sign(Event{Kind: KindTextNote, CreatedAt: Now(), Content: "tags", Tags: Tags{{"t", "a"}, {"t", "b"}, {"t", "c"}}}, priv),
+		sign(Event{Kind: KindTextNote, CreatedAt: Now(), Content: strings.Repeat("long", 100)}, priv),
+		sign(Event{Kind: KindReaction, CreatedAt: Now(), Content: "+"}, priv),
+		sign(Event{Kind: KindTextNote, CreatedAt: Now(), Content: "blocked"}, blockedPriv),
+	)
+	defer store.Close()
+
+	policy := NewValidationPolicy(
+		MaxFutureSkew(time.Minute),
+		MaxTags(2),
+		MaxContentLength(100),
+		KindAllowlist(KindTextNote),
+		PubKeyBlocklist(blockedPub),
+	)
+	pool := NewSimplePool(context.Background(), WithValidationPolicy{policy})
+	rl, err := pool.EnsureRelay(store.URL)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	events, err := rl.QuerySync(ctx, Filter{})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(events) != 1 || events[0].Content != "good" {
+		t.Errorf("only the good event should have passed, got %v", events)
+	}
+
+	expected := map[string]int64{
+		"created_at too far in the future": 1,
+		"more than 2 tags":                 1,
+		"content longer than 100":          1,
+		"kind not allowed":                 1,
+		"pubkey blocked":                   1,
+	}
+	if dropped := policy.Dropped(); !reflect.DeepEqual(dropped, expected) {
+		t.Errorf("dropped counts are %v", dropped)
+	}
+
+	// policies can be made without NewValidationPolicy too
+	literal := &ValidationPolicy{Validators: []Validator{KindAllowlist(KindReaction)}}
+	if reason := literal.Validate(events[0]); reason != "kind not allowed" || literal.Dropped()[reason] != 1 {
+		t.Errorf("literal policy gave %q and %v", reason, literal.Dropped())
+	}
+}
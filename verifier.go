@@ -0,0 +1,178 @@
+package nostr
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// SignatureVerifier checks event signatures on a pool of goroutines and remembers the events it
+// has found to be valid, so the same event coming from many relays is only verified once.
+//
+// The same verifier can be shared by many relays, see WithSignatureVerifier.
+type SignatureVerifier struct {
+	ctx  context.Context
+	jobs chan *verification
+
+	mutex     sync.Mutex
+	cacheSize int
+	cache     map[string]*list.Element
+	recent    *list.List // of cache keys, most recently used first
+}
+
+type verification struct {
+	event   *Event
+	ok      bool
+	err     error
+	done    chan struct{}
+	claimed atomic.Bool // set by whoever verifies it, a worker or wait
+}
+
+// run verifies the event and closes done, unless someone else has already taken the job.
+func (job *verification) run(v *SignatureVerifier) {
+	if !job.claimed.CompareAndSwap(false, true) {
+		return
+	}
+	job.ok, job.err = v.Verify(job.event)
+	close(job.done)
+}
+
+// NewSignatureVerifier starts workers goroutines (runtime.NumCPU() if zero) that will verify
+// signatures until ctx is canceled, and a cache of cacheSize ids (100,000 if zero).
+// After ctx is canceled events are still verified, but on the goroutine that asks for it.
+func NewSignatureVerifier(ctx context.Context, workers int, cacheSize int) *SignatureVerifier {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if cacheSize <= 0 {
+		cacheSize = 100_000
+	}
+
+	v := &SignatureVerifier{
+		ctx:       ctx,
+		jobs:      make(chan *verification, workers*16),
+		cacheSize: cacheSize,
+		cache:     make(map[string]*list.Element, cacheSize),
+		recent:    list.New(),
+	}
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				select {
+				case job := <-v.jobs:
+					job.run(v)
+				case <-ctx.Done():
+					// don't leave anyone waiting for what was already queued
+					for {
+						select {
+						case job := <-v.jobs:
+							job.run(v)
+						default:
+							return
+						}
+					}
+				}
+			}
+		}()
+	}
+
+	return v
+}
+
+// Verify does the same checks as Event.Verify, on the calling goroutine, unless the event was
+// verified before. Errors are of type *InvalidEventError.
+func (v *SignatureVerifier) Verify(evt *Event) (bool, error) {
+	hash := sha256.Sum256(evt.Serialize())
+	if err := evt.verifyStructure(hash[:]); err != nil {
+		return false, err
+	}
+
+	// the sig is part of the key so an event with a bad sig can't pass for one we've seen
+	key := string(hash[:]) + evt.Sig
+
+	v.mutex.Lock()
+	if elem, ok := v.cache[key]; ok {
+		v.recent.MoveToFront(elem)
+		v.mutex.Unlock()
+		return true, nil
+	}
+	v.mutex.Unlock()
+
+	if err := evt.verifySignature(hash[:]); err != nil {
+		return false, err
+	}
+
+	v.mutex.Lock()
+	if _, ok := v.cache[key]; !ok {
+		v.cache[key] = v.recent.PushFront(key)
+		if v.recent.Len() > v.cacheSize {
+			oldest := v.recent.Back()
+			v.recent.Remove(oldest)
+			delete(v.cache, oldest.Value.(string))
+		}
+	}
+	v.mutex.Unlock()
+
+	return true, nil
+}
+
+// VerifyBatch verifies all events in parallel and returns whether each of them is valid.
+func (v *SignatureVerifier) VerifyBatch(events []*Event) []bool {
+	verifications := make([]*verification, len(events))
+	for i, evt := range events {
+		verifications[i] = v.submit(evt)
+	}
+
+	results := make([]bool, len(events))
+	for i, job := range verifications {
+		v.wait(job)
+		results[i] = job.ok
+	}
+	return results
+}
+
+// submit queues an event to be verified by the workers, the result will be available when done is closed.
+func (v *SignatureVerifier) submit(evt *Event) *verification {
+	job := &verification{event: evt, done: make(chan struct{})}
+	select {
+	case v.jobs <- job:
+	case <-v.ctx.Done():
+		job.run(v)
+	}
+	return job
+}
+
+// wait blocks until the job is done. If the workers are gone it verifies the event itself, as
+// a job can still end up in the queue after they have drained it.
+func (v *SignatureVerifier) wait(job *verification) {
+	select {
+	case <-job.done:
+	case <-v.ctx.Done():
+		job.run(v)
+		<-job.done
+	}
+}
+
+// WithSignatureVerifier makes relays verify the signatures of the events they receive with
+// the given verifier instead of on their reader goroutine, one by one. Events are still
+// delivered to subscriptions before the EOSE or CLOSED that came after them.
+//
+// It can be given to NewRelay or to NewSimplePool, in which case it is used by all relays in the pool.
+type WithSignatureVerifier struct {
+	Verifier *SignatureVerifier
+}
+
+func (_ WithSignatureVerifier) IsRelayOption() {}
+func (_ WithSignatureVerifier) IsPoolOption()  {}
+func (o WithSignatureVerifier) Apply(pool *SimplePool) {
+	pool.relayOptions = append(pool.relayOptions, o)
+}
+
+var (
+	_ RelayOption = WithSignatureVerifier{}
+	_ PoolOption  = WithSignatureVerifier{}
+)
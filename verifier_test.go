@@ -0,0 +1,96 @@
+package nostr
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignatureVerifier(t *testing.T) {
+	priv, _ := makeKeyPair(t)
+	events := make([]*Event, 20)
+	for i := range events {
+		events[i] = &Event{Kind: KindTextNote, CreatedAt: Now(), Content: strings.Repeat("x", i)}
+		if err := events[i].Sign(priv); err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+	}
+	// same id and sig as a valid event, but different content
+	forged := *events[3]
+	forged.Content = "forged"
+	events = append(events, &forged)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	verifier := NewSignatureVerifier(ctx, 4, 10)
+
+	for round := 0; round < 2; round++ { // the second time they are all in the cache
+		results := verifier.VerifyBatch(events)
+		for i, ok := range results {
+			if ok != (i < 20) {
+				t.Errorf("round %d: event %d valid = %v", round, i, ok)
+			}
+		}
+	}
+	if verifier.recent.Len() != 10 {
+		t.Errorf("cache should be limited to 10, has %d", verifier.recent.Len())
+	}
+
+	// now through a relay, the forged event must not come out
+	store := newStoreServer(t, events...)
+	defer store.Close()
+	rl, err := RelayConnect(context.Background(), store.URL, WithSignatureVerifier{verifier})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer rl.Close()
+
+	received, err := rl.QuerySync(ctx, Filter{Kinds: []int{KindTextNote}})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(received) != 20 {
+		t.Fatalf("expected 20 events, got %d", len(received))
+	}
+	for _, evt := range received {
+		if evt.Content == "forged" {
+			t.Error("got the forged event")
+		}
+	}
+}
+
+func TestSignatureVerifierCanceled(t *testing.T) {
+	priv, _ := makeKeyPair(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	verifier := NewSignatureVerifier(ctx, 1, 10)
+
+	// queued before and after the workers stop
+	jobs := make([]*verification, 10)
+	for i := range jobs {
+		evt := &Event{Kind: KindTextNote, CreatedAt: Now(), Content: strings.Repeat("x", i)}
+		evt.Sign(priv)
+		jobs[i] = &verification{event: evt, done: make(chan struct{})}
+		verifier.jobs <- jobs[i]
+		if i == 4 {
+			cancel()
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for _, job := range jobs {
+			verifier.wait(job)
+			if !job.ok {
+				t.Errorf("event %s should be valid", job.event.Content)
+			}
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("jobs queued when the verifier was canceled were never done")
+	}
+}